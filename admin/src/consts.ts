@@ -12,6 +12,7 @@ export const statusColorMapping: statusColorMapping = {
   [SchedulerStatus.Cancel]: { backgroundColor: 'pink' },
   [SchedulerStatus.Success]: { backgroundColor: 'green', color: 'white' },
   [SchedulerStatus.Skipped_Unused]: { backgroundColor: 'gray', color: 'white' },
+  [SchedulerStatus.PartialSuccess]: { backgroundColor: 'olive', color: 'white' },
 };
 
 export const nodeStatusColorMapping = {
@@ -7,6 +7,7 @@ export enum SchedulerStatus {
   Cancel,
   Success,
   Skipped_Unused,
+  PartialSuccess,
 }
 
 export type Status = {
@@ -1,6 +1,7 @@
 package dagu
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -9,6 +10,9 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -22,6 +26,7 @@ import (
 	"github.com/yohamta/dagu/internal/models"
 	"github.com/yohamta/dagu/internal/reporter"
 	"github.com/yohamta/dagu/internal/scheduler"
+	"github.com/yohamta/dagu/internal/settings"
 	"github.com/yohamta/dagu/internal/sock"
 	"github.com/yohamta/dagu/internal/utils"
 )
@@ -33,6 +38,7 @@ type Agent struct {
 
 	scheduler    *scheduler.Scheduler
 	graph        *scheduler.ExecutionGraph
+	graphMu      sync.RWMutex
 	logFilename  string
 	logFile      *os.File
 	reporter     *reporter.Reporter
@@ -41,11 +47,21 @@ type Agent struct {
 	dbWriter     *database.Writer
 	socketServer *sock.Server
 	requestId    string
+	// definition is the YAML of the definition of the DAG recorded in
+	// the status.
+	definition string
+	// handlerOutputs is the outputs of the handlers read once after they
+	// finished.
+	handlerOutputs   map[string]string
+	handlerOutputsMu sync.RWMutex
 }
 
 type AgentConfig struct {
 	DAG *dag.DAG
 	Dry bool
+	// Schedule is the expression of the schedule that triggered the run.
+	// It's empty if the run was not started by the scheduler.
+	Schedule string
 }
 
 type RetryConfig struct {
@@ -69,6 +85,7 @@ func (a *Agent) Run() error {
 	}
 	setup := []func() error{
 		a.checkIsRunning,
+		a.setupDefinition,
 		a.setupDatabase,
 		a.setupSocketServer,
 		a.setupLogFile,
@@ -94,6 +111,8 @@ func (a *Agent) Status() *models.Status {
 	)
 	status.RequestId = a.requestId
 	status.Log = a.logFilename
+	status.Definition = a.definition
+	status.Schedule = a.Schedule
 	if node := a.scheduler.HandlerNode(constants.OnExit); node != nil {
 		status.OnExit = models.FromNode(node)
 	}
@@ -106,9 +125,192 @@ func (a *Agent) Status() *models.Status {
 	if node := a.scheduler.HandlerNode(constants.OnCancel); node != nil {
 		status.OnCancel = models.FromNode(node)
 	}
+	a.handlerOutputsMu.RLock()
+	status.HandlerOutputs = a.handlerOutputs
+	a.handlerOutputsMu.RUnlock()
 	return status
 }
 
+// StepStatus is a snapshot of the state of a step.
+type StepStatus struct {
+	Name       string
+	Status     scheduler.NodeStatus
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// StepStatuses returns a snapshot of the step statuses of the workflow.
+// It is safe to call while the workflow is running.
+func (a *Agent) StepStatuses() []StepStatus {
+	a.graphMu.RLock()
+	g := a.graph
+	a.graphMu.RUnlock()
+
+	ret := []StepStatus{}
+	if g == nil {
+		return ret
+	}
+	for _, n := range g.Nodes() {
+		ret = append(ret, StepStatus{
+			Name:       n.Name,
+			Status:     n.ReadStatus(),
+			StartedAt:  n.ReadStartedAt(),
+			FinishedAt: n.ReadFinishedAt(),
+		})
+	}
+	return ret
+}
+
+// RunStatus is a snapshot of a running DAG.
+type RunStatus struct {
+	Name      string
+	RequestId string
+	StartedAt time.Time
+	// CurrentSteps are the names of the running steps.
+	CurrentSteps []string
+}
+
+// Status returns the snapshots of the DAGs in the directory that are
+// running, ordered by the time they started. Each DAG runs in its own
+// process, so the status is read from the socket of the running DAG.
+func Status(dir string) ([]RunStatus, error) {
+	dags, _, err := controller.GetDAGs(dir)
+	if err != nil {
+		return nil, err
+	}
+	ret := []RunStatus{}
+	for _, d := range dags {
+		if d.Status == nil || d.Status.Status != scheduler.SchedulerStatus_Running {
+			continue
+		}
+		startedAt, _ := utils.ParseTime(d.Status.StartedAt)
+		rs := RunStatus{
+			Name:         d.DAG.Name,
+			RequestId:    d.Status.RequestId,
+			StartedAt:    startedAt,
+			CurrentSteps: []string{},
+		}
+		for _, n := range d.Status.Nodes {
+			if n.Status == scheduler.NodeStatus_Running {
+				rs.CurrentSteps = append(rs.CurrentSteps, n.Name)
+			}
+		}
+		ret = append(ret, rs)
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].StartedAt.Before(ret[j].StartedAt)
+	})
+	return ret, nil
+}
+
+// RunStep runs a single step of the DAG in isolation with the environment
+// and the parameters of the DAG. The dependencies of the step are not run,
+// so it fails if the step refers to the output of an upstream step that is
+// not available. The nodes returned by the previous runs of the upstream
+// steps can be given to make their outputs available to the step. d is
+// not modified.
+func RunStep(ctx context.Context, d *dag.DAG, stepName string, upstream ...*models.Node) (*models.Node, error) {
+	var step *dag.Step
+	for _, s := range d.Steps {
+		if s.Name == stepName {
+			step = s
+			break
+		}
+	}
+	if step == nil {
+		return nil, fmt.Errorf("step was not found: %s", stepName)
+	}
+
+	s := *step
+	s.Depends = nil
+	s.Variables = append(append([]string{}, step.Variables...), upstreamOutputs(upstream)...)
+	if err := checkUpstreamOutputs(d, step, s.Variables); err != nil {
+		return nil, err
+	}
+	g, err := scheduler.NewExecutionGraph(&s)
+	if err != nil {
+		return nil, err
+	}
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	sc := &scheduler.Scheduler{
+		Config: &scheduler.Config{
+			LogDir:    path.Join(d.LogDir, utils.ValidFilename(d.Name, "_")),
+			RequestId: id.String(),
+		}}
+
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			sc.Cancel(g)
+		case <-finished:
+		}
+	}()
+
+	err = sc.Schedule(g, nil)
+	return models.FromNode(g.Nodes()[0]), err
+}
+
+// upstreamOutputs returns the output variables of the nodes as the
+// "KEY=value" pairs.
+func upstreamOutputs(nodes []*models.Node) []string {
+	ret := []string{}
+	for _, n := range nodes {
+		if n == nil || n.Step == nil || n.Output == "" || n.OutputVariables == nil {
+			continue
+		}
+		if v, ok := n.OutputVariables.Load(n.Output); ok {
+			ret = append(ret, v.(string))
+		}
+	}
+	return ret
+}
+
+// checkUpstreamOutputs returns an error if the step refers to the output
+// variable of an upstream step which is not set in the variables.
+func checkUpstreamOutputs(d *dag.DAG, step *dag.Step, variables []string) error {
+	steps := map[string]*dag.Step{}
+	for _, s := range d.Steps {
+		steps[s.Name] = s
+	}
+	refs := strings.Join(append([]string{step.CmdWithArgs, step.Script, step.Stdout, step.Stderr},
+		step.Args...), " ")
+
+	env := dag.NewEnvironment(variables...)
+	visited := map[string]bool{}
+	upstream := append([]string{}, step.Depends...)
+	for len(upstream) > 0 {
+		name := upstream[0]
+		upstream = upstream[1:]
+		if visited[name] {
+			continue
+		}
+		visited[name] = true
+		s, ok := steps[name]
+		if !ok {
+			continue
+		}
+		upstream = append(upstream, s.Depends...)
+		if s.Output == "" {
+			continue
+		}
+		re := regexp.MustCompile(fmt.Sprintf(`\$(%s\b|\{%s\})`,
+			regexp.QuoteMeta(s.Output), regexp.QuoteMeta(s.Output)))
+		if !re.MatchString(refs) {
+			continue
+		}
+		if _, ok := env.Lookup(s.Output); !ok {
+			return fmt.Errorf("output %s of the upstream step %s is not available",
+				s.Output, s.Name)
+		}
+	}
+	return nil
+}
+
 // Signal sends the signal to the processes running
 // if processes do not terminate after MaxCleanUp time, it will send KILL signal.
 func (a *Agent) Signal(sig os.Signal) {
@@ -153,15 +355,17 @@ func (a *Agent) init() {
 	logDir := path.Join(a.DAG.LogDir, utils.ValidFilename(a.DAG.Name, "_"))
 	a.scheduler = &scheduler.Scheduler{
 		Config: &scheduler.Config{
-			LogDir:        logDir,
-			MaxActiveRuns: a.DAG.MaxActiveRuns,
-			Delay:         a.DAG.Delay,
-			Dry:           a.Dry,
-			OnExit:        a.DAG.HandlerOn.Exit,
-			OnSuccess:     a.DAG.HandlerOn.Success,
-			OnFailure:     a.DAG.HandlerOn.Failure,
-			OnCancel:      a.DAG.HandlerOn.Cancel,
-			RequestId:     a.requestId,
+			LogDir:         logDir,
+			MaxActiveRuns:  a.DAG.MaxActiveRuns,
+			Delay:          a.DAG.Delay,
+			Dry:            a.Dry,
+			OnExit:         a.DAG.HandlerOn.Exit,
+			OnSuccess:      a.DAG.HandlerOn.Success,
+			OnFailure:      a.DAG.HandlerOn.Failure,
+			OnCancel:       a.DAG.HandlerOn.Cancel,
+			RequestId:      a.requestId,
+			Timeout:        a.DAG.Timeout,
+			HandlerTimeout: a.DAG.HandlerTimeout,
 		}}
 	a.reporter = &reporter.Reporter{
 		Config: &reporter.Config{
@@ -171,6 +375,7 @@ func (a *Agent) init() {
 					Port: a.DAG.Smtp.Port,
 				},
 			},
+			StateDir: settings.MustGet(settings.SETTING__MAIL_STATE_DIR),
 		}}
 	a.logFilename = filepath.Join(
 		logDir,
@@ -182,14 +387,26 @@ func (a *Agent) init() {
 }
 
 func (a *Agent) setupGraph() (err error) {
+	var g *scheduler.ExecutionGraph
 	if a.RetryConfig != nil && a.RetryConfig.Status != nil {
 		log.Printf("setup for retry")
-		return a.setupRetry()
+		g, err = a.setupRetry()
+	} else {
+		g, err = scheduler.NewExecutionGraph(a.DAG.Steps...)
 	}
-	a.graph, err = scheduler.NewExecutionGraph(a.DAG.Steps...)
+	a.graphMu.Lock()
+	defer a.graphMu.Unlock()
+	a.graph = g
 	return
 }
 
+// setupDefinition records the definition of the DAG as it's run so that
+// the version can be loaded from the history later.
+func (a *Agent) setupDefinition() (err error) {
+	a.definition, err = a.DAG.MarshalDefinition()
+	return err
+}
+
 func (a *Agent) setupLogFile() (err error) {
 	dir := path.Dir(a.logFilename)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -199,13 +416,12 @@ func (a *Agent) setupLogFile() (err error) {
 	return
 }
 
-func (a *Agent) setupRetry() (err error) {
+func (a *Agent) setupRetry() (*scheduler.ExecutionGraph, error) {
 	nodes := []*scheduler.Node{}
 	for _, n := range a.RetryConfig.Status.Nodes {
 		nodes = append(nodes, n.ToNode())
 	}
-	a.graph, err = scheduler.NewExecutionGraphForRetry(nodes...)
-	return
+	return scheduler.NewExecutionGraphForRetry(nodes...)
 }
 
 func (a *Agent) setupRequestId() error {
@@ -221,12 +437,29 @@ func (a *Agent) setupDatabase() (err error) {
 	a.database = &database.Database{
 		Config: database.DefaultConfig(),
 	}
-	a.dbWriter, a.dbFile, err = a.database.NewWriter(a.DAG.Location, time.Now(), a.requestId)
+	a.scheduler.PrevOutputs = a.prevOutputs()
+	// the history is cleaned before the new file is created so that
+	// histRetentionDays 0 doesn't remove the status of this run.
 	utils.LogErr("clean old history data",
 		a.database.RemoveOld(a.DAG.Location, a.DAG.HistRetentionDays))
+	a.dbWriter, a.dbFile, err = a.database.NewWriter(a.DAG.Location, time.Now(), a.requestId)
 	return
 }
 
+// prevOutputs returns the outputs of the steps that alert on output
+// change in the latest run.
+func (a *Agent) prevOutputs() map[string]string {
+	ret := map[string]string{}
+	for _, f := range a.database.ReadStatusHist(a.DAG.Location, 1) {
+		for _, n := range f.Status.Nodes {
+			if n.OutputValue != "" {
+				ret[n.Name] = n.OutputValue
+			}
+		}
+	}
+	return ret
+}
+
 func (a *Agent) setupSocketServer() (err error) {
 	a.socketServer, err = sock.NewServer(
 		&sock.Config{
@@ -239,7 +472,7 @@ func (a *Agent) setupSocketServer() (err error) {
 func (a *Agent) checkPreconditions() error {
 	if len(a.DAG.Preconditions) > 0 {
 		log.Printf("checking preconditions for \"%s\"", a.DAG.Name)
-		if err := dag.EvalConditions(a.DAG.Preconditions); err != nil {
+		if err := dag.EvalConditions(a.DAG.Preconditions, a.DAG.Environment()); err != nil {
 			a.scheduler.Cancel(a.graph)
 			return err
 		}
@@ -302,6 +535,7 @@ func (a *Agent) run() error {
 	}()
 
 	lastErr := a.scheduler.Schedule(a.graph, done)
+	a.setHandlerOutputs()
 	status := a.Status()
 
 	log.Println("schedule finished.")
@@ -309,6 +543,7 @@ func (a *Agent) run() error {
 
 	a.reporter.ReportSummary(status, lastErr)
 	utils.LogErr("send email", a.reporter.SendMail(a.DAG, status, lastErr))
+	utils.LogErr("send webhooks", a.reporter.SendWebhooks(a.DAG, status, lastErr))
 
 	utils.LogErr("close data file", a.dbWriter.Close())
 	utils.LogErr("data compaction", a.database.Compact(a.DAG.Location, a.dbFile))
@@ -316,6 +551,46 @@ func (a *Agent) run() error {
 	return lastErr
 }
 
+// maxHandlerOutput is the max size of a handler output kept in the history.
+const maxHandlerOutput = 64 * 1024
+
+// setHandlerOutputs reads the logs of the handler steps finished and
+// keeps them for the status.
+func (a *Agent) setHandlerOutputs() {
+	ret := a.readHandlerOutputs()
+	a.handlerOutputsMu.Lock()
+	a.handlerOutputs = ret
+	a.handlerOutputsMu.Unlock()
+}
+
+// readHandlerOutputs reads the logs of the handler steps finished.
+func (a *Agent) readHandlerOutputs() map[string]string {
+	ret := map[string]string{}
+	for _, name := range []string{
+		constants.OnExit, constants.OnSuccess, constants.OnFailure, constants.OnCancel,
+	} {
+		node := a.scheduler.HandlerNode(name)
+		if node == nil || node.Log == "" {
+			continue
+		}
+		switch node.ReadStatus() {
+		case scheduler.NodeStatus_Success, scheduler.NodeStatus_Error:
+		default:
+			continue
+		}
+		b, err := os.ReadFile(node.Log)
+		if err != nil {
+			log.Printf("failed to read the log of %s: %v", name, err)
+			continue
+		}
+		if len(b) > maxHandlerOutput {
+			b = b[len(b)-maxHandlerOutput:]
+		}
+		ret[name] = string(b)
+	}
+	return ret
+}
+
 func (a *Agent) dryRun() error {
 	done := make(chan *scheduler.Node)
 	defer func() {
@@ -332,6 +607,7 @@ func (a *Agent) dryRun() error {
 	log.Printf("***** Starting DRY-RUN *****")
 
 	lastErr := a.scheduler.Schedule(a.graph, done)
+	a.setHandlerOutputs()
 	status := a.Status()
 	a.reporter.ReportSummary(status, lastErr)
 
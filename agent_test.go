@@ -1,6 +1,8 @@
 package dagu
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"net/url"
 	"os"
@@ -10,8 +12,10 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"github.com/yohamta/dagu/internal/constants"
 	"github.com/yohamta/dagu/internal/controller"
 	"github.com/yohamta/dagu/internal/dag"
+	"github.com/yohamta/dagu/internal/database"
 	"github.com/yohamta/dagu/internal/models"
 	"github.com/yohamta/dagu/internal/scheduler"
 	"github.com/yohamta/dagu/internal/settings"
@@ -91,6 +95,68 @@ func TestDryRun(t *testing.T) {
 	require.Equal(t, scheduler.SchedulerStatus_Success, status.Status)
 }
 
+func TestStepStatuses(t *testing.T) {
+	a, _ := testDAGAsync(t, "step_statuses.yaml")
+
+	seen := []scheduler.NodeStatus{}
+	require.Eventually(t, func() bool {
+		statuses := a.StepStatuses()
+		if len(statuses) != 2 {
+			return false
+		}
+		s := statuses[1].Status
+		if len(seen) == 0 || seen[len(seen)-1] != s {
+			seen = append(seen, s)
+		}
+		return s == scheduler.NodeStatus_Success
+	}, time.Second*3, time.Millisecond*50)
+
+	require.Equal(t, []scheduler.NodeStatus{
+		scheduler.NodeStatus_None,
+		scheduler.NodeStatus_Running,
+		scheduler.NodeStatus_Success,
+	}, seen)
+
+	statuses := a.StepStatuses()
+	require.Equal(t, "2", statuses[1].Name)
+	require.False(t, statuses[1].StartedAt.IsZero())
+	require.True(t, statuses[1].FinishedAt.After(statuses[0].FinishedAt))
+}
+
+func TestStatus(t *testing.T) {
+	dir := path.Join(testdataDir, "status")
+	a, _ := testDAGAsync(t, "status/status_a.yaml")
+	time.Sleep(time.Millisecond * 50)
+
+	// the other DAG runs in its own process as started by the scheduler
+	d := testLoadDAG(t, "status/status_b.yaml")
+	controller.New(d).StartAsync(path.Join(utils.MustGetwd(), "bin/dagu"), "", "")
+
+	var runs []RunStatus
+	require.Eventually(t, func() bool {
+		var err error
+		runs, err = Status(dir)
+		require.NoError(t, err)
+		return len(runs) == 2 &&
+			len(runs[0].CurrentSteps) == 1 && len(runs[1].CurrentSteps) == 1 &&
+			runs[1].CurrentSteps[0] == "b2"
+	}, time.Second*3, time.Millisecond*50)
+
+	require.Equal(t, "status_a", runs[0].Name)
+	require.Equal(t, []string{"a1"}, runs[0].CurrentSteps)
+	require.Equal(t, a.requestId, runs[0].RequestId)
+	require.Equal(t, "status_b", runs[1].Name)
+	require.Equal(t, []string{"b2"}, runs[1].CurrentSteps)
+	require.NotEmpty(t, runs[1].RequestId)
+	require.False(t, runs[1].StartedAt.Before(runs[0].StartedAt))
+
+	require.Eventually(t, func() bool {
+		runs, err := Status(dir)
+		require.NoError(t, err)
+		return len(runs) == 0
+	}, time.Second*3, time.Millisecond*50)
+}
+
 func TestCancelDAG(t *testing.T) {
 	for _, abort := range []func(*Agent){
 		func(a *Agent) { a.Signal(syscall.SIGTERM) },
@@ -160,6 +226,20 @@ func TestOnExit(t *testing.T) {
 	require.Equal(t, scheduler.NodeStatus_Success, status.OnExit.Status)
 }
 
+func TestOnExitOutput(t *testing.T) {
+	d := testLoadDAG(t, "on_exit_output.yaml")
+	a := &Agent{AgentConfig: &AgentConfig{DAG: d}}
+	require.NoError(t, a.Run())
+
+	status, err := controller.New(d).GetLastStatus()
+	require.NoError(t, err)
+	require.Equal(t, "cleanup done\n", status.HandlerOutputs[constants.OnExit])
+
+	// the outputs are read once after the handlers finished
+	require.NoError(t, os.Remove(status.OnExit.Log))
+	require.Equal(t, "cleanup done\n", a.Status().HandlerOutputs[constants.OnExit])
+}
+
 func TestRetry(t *testing.T) {
 	d := testLoadDAG(t, "retry.yaml")
 
@@ -273,6 +353,40 @@ func (h *mockResponseWriter) WriteHeader(statusCode int) {
 	h.status = statusCode
 }
 
+func TestOutputChange(t *testing.T) {
+	d := testLoadDAG(t, "output_change.yaml")
+
+	// nothing to compare on the first run
+	status, err := testDAG(t, d)
+	require.NoError(t, err)
+	require.Equal(t, scheduler.SchedulerStatus_Success, status.Status)
+	require.NotEmpty(t, status.Nodes[0].OutputValue)
+	require.Equal(t, "same", status.Nodes[1].OutputValue)
+
+	status, err = testDAG(t, d)
+	require.Error(t, err)
+	require.Equal(t, scheduler.SchedulerStatus_Error, status.Status)
+	require.Equal(t, scheduler.NodeStatus_Error, status.Nodes[0].Status)
+	require.Contains(t, status.Nodes[0].Error, "CHANGING_OUTPUT changed")
+	require.Equal(t, scheduler.NodeStatus_Success, status.Nodes[1].Status)
+}
+
+func TestStepPreconditions(t *testing.T) {
+	d := testLoadDAG(t, "step_preconditions.yaml")
+	status, err := testDAG(t, d)
+	require.NoError(t, err)
+	require.Equal(t, scheduler.SchedulerStatus_Success, status.Status)
+
+	require.Equal(t, scheduler.NodeStatus_Success, status.Nodes[0].Status)
+	require.Equal(t, scheduler.NodeStatus_Skipped, status.Nodes[1].Status)
+	require.Equal(t, &dag.ConditionResult{
+		Condition: "${FOO}",
+		Expected:  "BAZ",
+		Actual:    "BAR",
+	}, status.Nodes[1].SkipReason)
+	require.Equal(t, scheduler.NodeStatus_Success, status.Nodes[2].Status)
+}
+
 func testDAG(t *testing.T, d *dag.DAG) (*models.Status, error) {
 	t.Helper()
 	a := &Agent{AgentConfig: &AgentConfig{
@@ -282,6 +396,142 @@ func testDAG(t *testing.T, d *dag.DAG) (*models.Status, error) {
 	return a.Status(), err
 }
 
+func TestOutputDepends(t *testing.T) {
+	// B is defined first but expanded after A produced the output
+	d := testLoadDAG(t, "output_depends.yaml")
+	status, err := testDAG(t, d)
+	require.NoError(t, err)
+	require.Equal(t, scheduler.SchedulerStatus_Success, status.Status)
+	greeting, _ := d.Steps[0].OutputVariables.Load("OUTPUT_DEPENDS_GREETING")
+	require.Equal(t, "OUTPUT_DEPENDS_GREETING=hello world", greeting)
+	require.Empty(t, os.Getenv("OUTPUT_DEPENDS_RESULT"))
+}
+
+func TestLoadVersion(t *testing.T) {
+	file := path.Join(t.TempDir(), "version.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(`env:
+  - GREETING: hello
+steps:
+  - name: "1"
+    command: echo ${GREETING}
+  - name: "2"
+    command: echo world
+    depends: ["1"]
+`), 0644))
+
+	cl := &dag.Loader{}
+	orig, err := cl.Load(file, "")
+	require.NoError(t, err)
+	status, err := testDAG(t, orig)
+	require.NoError(t, err)
+
+	// the file is changed after the run
+	require.NoError(t, os.WriteFile(file, []byte(`steps:
+  - name: "1"
+    command: echo changed
+`), 0644))
+	current, err := cl.Load(file, "")
+	require.NoError(t, err)
+	require.Len(t, current.Steps, 1)
+
+	db := &database.Database{Config: database.DefaultConfig()}
+	cl = &dag.Loader{ReadDefinition: db.ReadDefinition}
+	v, err := cl.LoadVersion(current, status.RequestId)
+	require.NoError(t, err)
+	require.Equal(t, file, v.Location)
+	require.Equal(t, orig.Name, v.Name)
+	require.Len(t, v.Steps, 2)
+	for i, s := range orig.Steps {
+		require.Equal(t, s.Name, v.Steps[i].Name)
+		require.Equal(t, s.CmdWithArgs, v.Steps[i].CmdWithArgs)
+		require.Equal(t, s.Depends, v.Steps[i].Depends)
+	}
+	require.Contains(t, v.Env, "GREETING=hello")
+
+	_, err = cl.LoadVersion(current, "unknown")
+	require.Error(t, err)
+	_, err = (&dag.Loader{}).LoadVersion(current, status.RequestId)
+	require.Error(t, err)
+}
+
+type testKeyring map[string]string
+
+func (k testKeyring) Resolve(ref string) (string, error) {
+	if v, ok := k[ref]; ok {
+		return v, nil
+	}
+	return "", fmt.Errorf("not found: %s", ref)
+}
+
+func TestDefinitionWithoutSecrets(t *testing.T) {
+	dag.RegisterSecretProvider("keyring", testKeyring{"myapp/token": "s3cr3t-t0ken"})
+
+	file := path.Join(t.TempDir(), "secret.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(`env:
+  - TOKEN: "@keyring:myapp/token"
+  - AUTH: "Bearer ${TOKEN}"
+  - COMMAND: "`+"`echo hidden`"+`"
+steps:
+  - name: "1"
+    command: "true"
+    env:
+      - STEP_TOKEN: "@keyring:myapp/token"
+`), 0644))
+
+	d, err := (&dag.Loader{}).Load(file, "")
+	require.NoError(t, err)
+	require.Contains(t, d.Env, "TOKEN=s3cr3t-t0ken")
+	status, err := testDAG(t, d)
+	require.NoError(t, err)
+
+	require.NotContains(t, status.Definition, "s3cr3t-t0ken")
+	require.NotContains(t, status.Definition, "COMMAND: hidden")
+	require.Contains(t, status.Definition, "@keyring:myapp/token")
+
+	// the version keeps the references as they are written
+	db := &database.Database{Config: database.DefaultConfig()}
+	cl := &dag.Loader{ReadDefinition: db.ReadDefinition}
+	v, err := cl.LoadVersion(d, status.RequestId)
+	require.NoError(t, err)
+	require.Contains(t, v.Env, "TOKEN=@keyring:myapp/token")
+	require.Contains(t, v.Env, "COMMAND=`echo hidden`")
+	for _, e := range v.Env {
+		require.NotContains(t, e, "s3cr3t-t0ken")
+	}
+}
+
+func TestRunStep(t *testing.T) {
+	d := testLoadDAG(t, "run_step.yaml")
+
+	// the output of the upstream step is not available yet
+	_, err := RunStep(context.Background(), d, "3")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "RUN_STEP_RESULT")
+
+	// the failing dependency is not run
+	env := append([]string{}, d.Env...)
+	upstream, err := RunStep(context.Background(), d, "2")
+	require.NoError(t, err)
+	require.Equal(t, "2", upstream.Name)
+	require.Equal(t, scheduler.NodeStatus_Success, upstream.Status)
+	require.Equal(t, env, d.Env)
+	require.Empty(t, os.Getenv("RUN_STEP_RESULT"))
+
+	// the output is given by the caller, not taken from the process env
+	os.Setenv("RUN_STEP_RESULT", "hello")
+	_, err = RunStep(context.Background(), d, "3")
+	os.Unsetenv("RUN_STEP_RESULT")
+	require.Error(t, err)
+
+	node, err := RunStep(context.Background(), d, "3", upstream)
+	require.NoError(t, err)
+	require.Equal(t, scheduler.NodeStatus_Success, node.Status)
+	require.Equal(t, env, d.Env)
+
+	_, err = RunStep(context.Background(), d, "not_existing")
+	require.Error(t, err)
+}
+
 func testLoadDAG(t *testing.T, name string) *dag.DAG {
 	file := path.Join(testdataDir, name)
 	cl := &dag.Loader{}
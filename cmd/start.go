@@ -12,7 +12,7 @@ import (
 func newStartCommand() *cli.Command {
 	return &cli.Command{
 		Name:  "start",
-		Usage: "dagu start [--params=\"<params>\"] <DAG file>",
+		Usage: "dagu start [--params=\"<params>\"] [--schedule=<schedule>] <DAG file>",
 		Flags: append(
 			globalFlags,
 			&cli.StringFlag{
@@ -21,21 +21,32 @@ func newStartCommand() *cli.Command {
 				Value:    "",
 				Required: false,
 			},
+			&cli.StringFlag{
+				Name:     "schedule",
+				Usage:    "schedule that triggered the run, set by the scheduler",
+				Value:    "",
+				Required: false,
+			},
 		),
 		Action: func(c *cli.Context) error {
 			d, err := loadDAG(c, c.Args().Get(0), strings.Trim(c.String("params"), "\""))
 			if err != nil {
 				return err
 			}
-			return start(d)
+			return startScheduled(d, c.String("schedule"))
 		},
 	}
 }
 
 func start(d *dag.DAG) error {
+	return startScheduled(d, "")
+}
+
+func startScheduled(d *dag.DAG, schedule string) error {
 	a := &dagu.Agent{AgentConfig: &dagu.AgentConfig{
-		DAG: d,
-		Dry: false,
+		DAG:      d,
+		Dry:      false,
+		Schedule: schedule,
 	}}
 
 	listenSignals(func(sig os.Signal) {
@@ -11,6 +11,23 @@ const (
 	OnExit    = "onExit"
 )
 
+const (
+	// EnvRepeatIndex is the env name of the iteration index of a repeating step.
+	EnvRepeatIndex = "DAGU_REPEAT_INDEX"
+	// EnvStatus is the env name of the status of the run given to the handlers.
+	EnvStatus = "DAGU_STATUS"
+	// EnvFailedSteps is the env name of the comma separated names of the
+	// failed steps given to the handlers.
+	EnvFailedSteps = "DAGU_FAILED_STEPS"
+	// EnvError is the env name of the error of the run given to the handlers.
+	EnvError = "DAGU_ERROR"
+	// EnvStepDurationFormat is the format of the env name of the duration
+	// of a step in seconds given to the handlers. The placeholder is the
+	// step name in uppercase with the other characters than letters and
+	// digits replaced by underscores.
+	EnvStepDurationFormat = "DAGU_STEP_%s_DURATION"
+)
+
 const (
 	TimeFormat = "2006-01-02 15:04:05"
 	TimeEmpty  = "-"
@@ -34,7 +34,7 @@ func GetDAGs(dir string) (dags []*DAGStatus, errs []string, err error) {
 	utils.LogErr("read DAGs directory", err)
 	dr := NewDAGReader()
 	for _, fi := range fis {
-		if utils.MatchExtension(fi.Name(), dag.EXTENSIONS) {
+		if utils.MatchExtension(fi.Name(), dag.EXTENSIONS) && !dag.IsProjectFile(fi.Name()) {
 			dag, err := dr.ReadDAG(filepath.Join(dir, fi.Name()), true)
 			utils.LogErr("read DAG config", err)
 			if dag != nil {
@@ -72,7 +72,7 @@ func GrepDAGs(dir string, pattern string) (ret []*GrepResult, errs []string, err
 	}
 	utils.LogErr("read DAGs directory", err)
 	for _, fi := range fis {
-		if utils.MatchExtension(fi.Name(), dag.EXTENSIONS) {
+		if utils.MatchExtension(fi.Name(), dag.EXTENSIONS) && !dag.IsProjectFile(fi.Name()) {
 			fn := filepath.Join(dir, fi.Name())
 			utils.LogErr("read DAG file", err)
 			m, err := grep.Grep(fn, fmt.Sprintf("(?i)%s", pattern), opts)
@@ -151,6 +151,16 @@ func (c *Controller) Start(bin string, workDir string, params string) error {
 	if params != "" {
 		args = append(args, fmt.Sprintf("--params=\"%s\"", params))
 	}
+	return c.start(bin, workDir, args)
+}
+
+// StartScheduled starts the DAG by the schedule of the expression, which
+// is recorded in the history of the run.
+func (c *Controller) StartScheduled(bin string, workDir string, schedule string) error {
+	return c.start(bin, workDir, []string{"start", fmt.Sprintf("--schedule=%s", schedule)})
+}
+
+func (c *Controller) start(bin string, workDir string, args []string) error {
 	args = append(args, c.Location)
 	cmd := exec.Command(bin, args...)
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Pgid: 0}
@@ -250,6 +260,10 @@ func (c *Controller) GetStatusHist(n int) []*models.StatusFile {
 	return ret
 }
 
+func (c *Controller) EstimatedDuration() (time.Duration, error) {
+	return defaultDb().EstimatedDuration(c.Location)
+}
+
 func (c *Controller) UpdateStatus(status *models.Status) error {
 	client := sock.Client{Addr: c.SockAddr()}
 	res, err := client.Request("GET", "/status")
@@ -0,0 +1,102 @@
+package dag
+
+import (
+	"fmt"
+	"time"
+)
+
+// BusinessDaySchedule is a schedule that fires at the time of the nth
+// business day of every month. Saturdays, Sundays and the holidays are
+// not counted as business days.
+type BusinessDaySchedule struct {
+	Day    int
+	Hour   int
+	Minute int
+	// Holidays are the dates in the form of "YYYY-MM-DD".
+	Holidays []string
+	// Location is the time zone of the schedule. The time zone of the
+	// given time is used if it's nil.
+	Location *time.Location
+}
+
+// maxBusinessDay is the max number of business days in a month.
+const maxBusinessDay = 23
+
+func newBusinessDaySchedule(day int, at string, holidays []string, tz string) (*BusinessDaySchedule, error) {
+	if day < 1 || day > maxBusinessDay {
+		return nil, fmt.Errorf("schedule businessDay must be between 1 and %d", maxBusinessDay)
+	}
+	s := &BusinessDaySchedule{Day: day, Holidays: holidays}
+	if at != "" {
+		t, err := time.Parse("15:04", at)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule time: %s", at)
+		}
+		s.Hour, s.Minute = t.Hour(), t.Minute()
+	}
+	for _, h := range holidays {
+		if _, err := time.Parse("2006-01-02", h); err != nil {
+			return nil, fmt.Errorf("invalid schedule holiday: %s", h)
+		}
+	}
+	if tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule tz: %s", tz)
+		}
+		s.Location = loc
+	}
+	return s, nil
+}
+
+// Next returns the next time the schedule fires after the given time.
+func (s *BusinessDaySchedule) Next(t time.Time) time.Time {
+	loc := s.Location
+	if loc == nil {
+		loc = t.Location()
+	}
+	t = t.In(loc)
+	month := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+	// the holidays may leave too few business days in every month,
+	// so give up after three years.
+	for i := 0; i < 36; i++ {
+		if next, ok := s.inMonth(month); ok && next.After(t) {
+			return next
+		}
+		month = month.AddDate(0, 1, 0)
+	}
+	return time.Time{}
+}
+
+// Expression returns the string representation of the schedule.
+func (s *BusinessDaySchedule) Expression() string {
+	return fmt.Sprintf("businessDay %d %02d:%02d", s.Day, s.Hour, s.Minute)
+}
+
+func (s *BusinessDaySchedule) inMonth(month time.Time) (time.Time, bool) {
+	n := 0
+	for d := month; d.Month() == month.Month(); d = d.AddDate(0, 0, 1) {
+		if !s.isBusinessDay(d) {
+			continue
+		}
+		n++
+		if n == s.Day {
+			return time.Date(d.Year(), d.Month(), d.Day(),
+				s.Hour, s.Minute, 0, 0, d.Location()), true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (s *BusinessDaySchedule) isBusinessDay(d time.Time) bool {
+	if d.Weekday() == time.Saturday || d.Weekday() == time.Sunday {
+		return false
+	}
+	date := d.Format("2006-01-02")
+	for _, h := range s.Holidays {
+		if h == date {
+			return false
+		}
+	}
+	return true
+}
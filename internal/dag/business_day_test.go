@@ -0,0 +1,68 @@
+package dag
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBusinessDayScheduleNext(t *testing.T) {
+	date := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+	}
+	for _, test := range []struct {
+		Name     string
+		Holidays []string
+		From     time.Time
+		Want     time.Time
+	}{
+		{"1st on Monday", nil, date(2022, 8, 1, 0, 0), date(2022, 8, 3, 8, 0)},
+		{"1st on Tuesday", nil, date(2022, 11, 1, 0, 0), date(2022, 11, 3, 8, 0)},
+		{"1st on Wednesday", nil, date(2022, 6, 1, 0, 0), date(2022, 6, 3, 8, 0)},
+		{"1st on Thursday", nil, date(2022, 9, 1, 0, 0), date(2022, 9, 5, 8, 0)},
+		{"1st on Friday", nil, date(2022, 7, 1, 0, 0), date(2022, 7, 5, 8, 0)},
+		{"1st on Saturday", nil, date(2022, 10, 1, 0, 0), date(2022, 10, 5, 8, 0)},
+		{"1st on Sunday", nil, date(2022, 5, 1, 0, 0), date(2022, 5, 4, 8, 0)},
+		{"holiday", []string{"2022-07-04"}, date(2022, 7, 1, 0, 0), date(2022, 7, 6, 8, 0)},
+		{"after the fire time", nil, date(2022, 6, 3, 8, 0), date(2022, 7, 5, 8, 0)},
+		{"next year", nil, date(2022, 12, 6, 0, 0), date(2023, 1, 4, 8, 0)},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			s, err := newBusinessDaySchedule(3, "08:00", test.Holidays, "")
+			require.NoError(t, err)
+			require.Equal(t, test.Want, s.Next(test.From))
+		})
+	}
+}
+
+func TestBusinessDayScheduleTimezone(t *testing.T) {
+	s, err := newBusinessDaySchedule(1, "09:30", nil, "Asia/Tokyo")
+	require.NoError(t, err)
+
+	// 2022-08-01 00:00 UTC is 09:00 on the 1st business day in Tokyo
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	next := s.Next(time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC))
+	require.Equal(t, time.Date(2022, 8, 1, 9, 30, 0, 0, loc), next)
+
+	next = s.Next(time.Date(2022, 8, 1, 1, 0, 0, 0, time.UTC))
+	require.Equal(t, time.Date(2022, 9, 1, 9, 30, 0, 0, loc), next)
+}
+
+func TestBusinessDayScheduleError(t *testing.T) {
+	for _, test := range []struct {
+		Day      int
+		Time     string
+		Holidays []string
+		Tz       string
+	}{
+		{Day: 0},
+		{Day: 24},
+		{Day: 1, Time: "25:00"},
+		{Day: 1, Holidays: []string{"2022/07/04"}},
+		{Day: 1, Tz: "Invalid/Zone"},
+	} {
+		_, err := newBusinessDaySchedule(test.Day, test.Time, test.Holidays, test.Tz)
+		require.Error(t, err)
+	}
+}
@@ -0,0 +1,78 @@
+package dag
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// shellBuiltins are the commands that are not looked up on PATH.
+var shellBuiltins = map[string]bool{
+	"alias": true, "bg": true, "cd": true, "command": true, "echo": true,
+	"eval": true, "exec": true, "exit": true, "export": true, "false": true,
+	"fg": true, "jobs": true, "kill": true, "printf": true, "pwd": true,
+	"read": true, "set": true, "shift": true, "source": true, "test": true,
+	"trap": true, "true": true, "type": true, "ulimit": true, "umask": true,
+	"unset": true, "wait": true, ".": true, ":": true, "[": true,
+}
+
+// CheckCommands returns an error for each step whose command can't be
+// found on PATH. The PATH of the env of the step is used if it's set.
+// It's meant to be a pre-flight check, so the steps of the other
+// executors and the commands with variables are not checked.
+func (c *DAG) CheckCommands() []error {
+	var errs []error
+	_ = c.WalkSteps(func(step *Step) error {
+		if step.Executor != "" && step.Executor != "command" {
+			return nil
+		}
+		cmd := step.Command
+		if cmd == "" || shellBuiltins[cmd] || strings.ContainsAny(cmd, "$`") {
+			return nil
+		}
+		if err := lookPath(cmd, step.Dir, envPath(step.Variables)); err != nil {
+			errs = append(errs, fmt.Errorf("step %s: %w", step.Name, err))
+		}
+		return nil
+	})
+	return errs
+}
+
+// envPath returns the last PATH of the variables or the PATH of the
+// process if it's not set.
+func envPath(variables []string) string {
+	p := os.Getenv("PATH")
+	for _, v := range variables {
+		if strings.HasPrefix(v, "PATH=") {
+			p = strings.TrimPrefix(v, "PATH=")
+		}
+	}
+	return p
+}
+
+func lookPath(cmd, dir, pathEnv string) error {
+	if strings.Contains(cmd, "/") {
+		if !filepath.IsAbs(cmd) {
+			cmd = filepath.Join(dir, cmd)
+		}
+		if isExecutable(cmd) {
+			return nil
+		}
+		return fmt.Errorf("command not found: %s", cmd)
+	}
+	for _, d := range filepath.SplitList(pathEnv) {
+		if d == "" {
+			d = "."
+		}
+		if isExecutable(filepath.Join(d, cmd)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("command not found in PATH: %s", cmd)
+}
+
+func isExecutable(file string) bool {
+	fi, err := os.Stat(file)
+	return err == nil && !fi.IsDir() && fi.Mode()&0111 != 0
+}
@@ -0,0 +1,46 @@
+package dag
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckCommands(t *testing.T) {
+	l := &Loader{}
+	d, err := l.LoadData([]byte(`steps:
+  - name: "1"
+    command: "ls -l"
+  - name: "2"
+    command: "echo hello"
+  - name: "3"
+    command: "not_existing_binary_xyz --help"
+  - name: "4"
+    command: "$HOME/bin/tool"
+  - name: "5"
+    executor: http
+    command: "GET https://example.com"
+`))
+	require.NoError(t, err)
+	errs := d.CheckCommands()
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs[0], "step 3: command not found in PATH: not_existing_binary_xyz")
+
+	// the PATH of the env is respected
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(dir, "my_tool"), []byte("#!/bin/sh\n"), 0755))
+	d, err = l.LoadData([]byte(`env:
+  - PATH: ` + dir + `
+steps:
+  - name: "1"
+    command: "my_tool"
+  - name: "2"
+    command: "ls"
+`))
+	require.NoError(t, err)
+	errs = d.CheckCommands()
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs[0], "step 2: command not found in PATH: ls")
+}
@@ -10,6 +10,16 @@ import (
 type Condition struct {
 	Condition string
 	Expected  string
+	Disk      *DiskCondition
+	// Shell is the shell to run the commands in the condition, e.g. bash.
+	// The commands are run directly if it's empty.
+	Shell string
+}
+
+// DiskCondition represents a condition on free disk space.
+type DiskCondition struct {
+	Path      string
+	MinFreeGB int
 }
 
 // ConditionResult represents an evaluated result of a condition.
@@ -19,9 +29,30 @@ type ConditionResult struct {
 	Actual    string
 }
 
-// Eval evaluates the condition.
-func (c *Condition) Eval() (*ConditionResult, error) {
-	ret, err := utils.ParseVariable(c.Condition)
+// ConditionError is returned when a condition evaluates to a value
+// different from the expected one.
+type ConditionError struct {
+	ConditionResult
+}
+
+func (e *ConditionError) Error() string {
+	return fmt.Sprintf(
+		"condition was not met. Condition=%s Expected=%s Actual=%s",
+		e.Condition, e.Expected, e.Actual)
+}
+
+// Eval evaluates the condition. The variables are expanded with env, or
+// with the process environment if env is nil. With the shell, the
+// variables in the commands in backticks are expanded by the shell.
+func (c *Condition) Eval(env *Environment) (*ConditionResult, error) {
+	var ret string
+	var err error
+	if c.Shell != "" {
+		ret, err = utils.ParseCommandWithShell(
+			utils.ExpandOutsideCommands(c.Condition, env.Expand), c.Shell, env.MarshalForExec())
+	} else {
+		ret, err = utils.ParseCommand(env.Expand(c.Condition))
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -32,26 +63,27 @@ func (c *Condition) Eval() (*ConditionResult, error) {
 	}, nil
 }
 
-// EvalCondition evaluates a single condition.
-func EvalCondition(c *Condition) error {
-	r, err := c.Eval()
+// EvalCondition evaluates a single condition with env.
+func EvalCondition(c *Condition, env *Environment) error {
+	if c.Disk != nil {
+		return evalDiskCondition(c.Disk)
+	}
+	r, err := c.Eval(env)
 	if err != nil {
 		return fmt.Errorf(
 			"failed to evaluate condition. Condition=%s Error=%v",
 			c.Condition, err)
 	}
 	if r.Expected != r.Actual {
-		return fmt.Errorf(
-			"condition was not met. Condition=%s Expected=%s Actual=%s",
-			r.Condition, r.Expected, r.Actual)
+		return &ConditionError{ConditionResult: *r}
 	}
 	return err
 }
 
-// EvalConditions evaluates a list of conditions.
-func EvalConditions(cond []*Condition) error {
+// EvalConditions evaluates a list of conditions with env.
+func EvalConditions(cond []*Condition, env *Environment) error {
 	for _, c := range cond {
-		err := EvalCondition(c)
+		err := EvalCondition(c, env)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd
+
+package dag
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func evalDiskCondition(c *DiskCondition) error {
+	return fmt.Errorf(
+		"failed to evaluate disk condition. Path=%s Error=disk condition is not supported on %s",
+		c.Path, runtime.GOOS)
+}
@@ -2,6 +2,7 @@ package dag
 
 import (
 	"os"
+	"os/exec"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -13,7 +14,7 @@ func TestCondition(t *testing.T) {
 			Condition: "`echo 1`",
 			Expected:  "1",
 		}
-		ret, err := c.Eval()
+		ret, err := c.Eval(nil)
 		require.NoError(t, err)
 		require.Equal(t, ret.Condition, c.Condition)
 		require.Equal(t, ret.Expected, c.Expected)
@@ -25,7 +26,7 @@ func TestCondition(t *testing.T) {
 			Condition: "${TEST_CONDITION}",
 			Expected:  "100",
 		}
-		ret, err := c.Eval()
+		ret, err := c.Eval(nil)
 		require.NoError(t, err)
 		require.Equal(t, ret.Condition, c.Condition)
 		require.Equal(t, ret.Expected, c.Expected)
@@ -33,6 +34,61 @@ func TestCondition(t *testing.T) {
 	}
 }
 
+func TestConditionShell(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+	os.Setenv("TEST_CONDITION_SHELL", "Dagu")
+	c := &Condition{
+		Condition: "`[[ abc == a* ]] && echo ${TEST_CONDITION_SHELL,,}`",
+		Expected:  "dagu",
+		Shell:     "bash",
+	}
+	require.NoError(t, EvalCondition(c, nil))
+
+	// bash syntax doesn't work without the shell
+	c.Shell = ""
+	require.Error(t, EvalCondition(c, nil))
+
+	l := &Loader{}
+	d, err := l.LoadData([]byte(`preconditions:
+  - condition: "` + "`echo $0`" + `"
+    expected: bash
+    shell: bash
+steps:
+  - name: "1"
+    command: "true"
+`))
+	require.NoError(t, err)
+	require.Equal(t, "bash", d.Preconditions[0].Shell)
+	require.NoError(t, EvalConditions(d.Preconditions, nil))
+}
+
+func TestConditionEnv(t *testing.T) {
+	env := NewEnvironment("TEST_CONDITION_ENV=dagu")
+	c := &Condition{
+		Condition: "${TEST_CONDITION_ENV}",
+		Expected:  "dagu",
+	}
+	require.NoError(t, EvalCondition(c, env))
+	require.Error(t, EvalCondition(c, nil))
+
+	c = &Condition{
+		Condition: "`echo $TEST_CONDITION_ENV`",
+		Expected:  "dagu",
+		Shell:     "sh",
+	}
+	require.NoError(t, EvalCondition(c, env))
+
+	// the variables outside the commands are expanded as well
+	c = &Condition{
+		Condition: "$TEST_CONDITION_ENV-`echo $TEST_CONDITION_ENV`",
+		Expected:  "dagu-dagu",
+		Shell:     "sh",
+	}
+	require.NoError(t, EvalCondition(c, env))
+}
+
 func TestEvalConditions(t *testing.T) {
 	for scenario, test := range map[string]struct {
 		Conditions []*Condition
@@ -66,7 +122,7 @@ func TestEvalConditions(t *testing.T) {
 		},
 	} {
 		t.Run(scenario, func(t *testing.T) {
-			err := EvalConditions(test.Conditions)
+			err := EvalConditions(test.Conditions, nil)
 			if test.Want {
 				require.NoError(t, err)
 			} else {
@@ -81,9 +137,22 @@ func TestConditionError(t *testing.T) {
 		Condition: "`invalid`",
 		Expected:  "1",
 	}
-	_, err := c.Eval()
+	_, err := c.Eval(nil)
 	require.Error(t, err)
 
-	err = EvalCondition(c)
+	err = EvalCondition(c, nil)
 	require.Error(t, err)
 }
+
+func TestDiskCondition(t *testing.T) {
+	dir := t.TempDir()
+
+	c := &Condition{Disk: &DiskCondition{Path: dir, MinFreeGB: 0}}
+	require.NoError(t, EvalCondition(c, nil))
+
+	c = &Condition{Disk: &DiskCondition{Path: dir, MinFreeGB: 1 << 30}}
+	require.Error(t, EvalCondition(c, nil))
+
+	c = &Condition{Disk: &DiskCondition{Path: "/not/existing/path", MinFreeGB: 0}}
+	require.Error(t, EvalCondition(c, nil))
+}
@@ -0,0 +1,24 @@
+//go:build linux || darwin || freebsd
+
+package dag
+
+import (
+	"fmt"
+	"syscall"
+)
+
+func evalDiskCondition(c *DiskCondition) error {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(c.Path, &stat); err != nil {
+		return fmt.Errorf(
+			"failed to evaluate disk condition. Path=%s Error=%v",
+			c.Path, err)
+	}
+	free := float64(uint64(stat.Bavail)*uint64(stat.Bsize)) / (1 << 30)
+	if free < float64(c.MinFreeGB) {
+		return fmt.Errorf(
+			"disk condition was not met. Path=%s MinFreeGB=%d FreeGB=%.2f",
+			c.Path, c.MinFreeGB, free)
+	}
+	return nil
+}
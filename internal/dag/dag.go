@@ -1,12 +1,17 @@
 package dag
 
 import (
+	"bytes"
 	"crypto/md5"
 	"fmt"
+	"io/fs"
 	"os"
 	"path"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/mattn/go-shellwords"
@@ -15,18 +20,25 @@ import (
 	"github.com/yohamta/dagu/internal/settings"
 	"github.com/yohamta/dagu/internal/utils"
 	"golang.org/x/sys/unix"
+	"gopkg.in/yaml.v2"
 )
 
 // DAG represents a DAG configuration.
 type DAG struct {
-	Location          string
-	Group             string
-	Name              string
-	Schedule          []*Schedule
-	StopSchedule      []*Schedule
-	RestartSchedule   []*Schedule
-	Description       string
-	Env               []string
+	Location        string
+	Group           string
+	Name            string
+	Schedule        []*Schedule
+	EnableSeconds   bool
+	StopSchedule    []*Schedule
+	RestartSchedule []*Schedule
+	// TimeZone is the timezone of the schedules given by schedule.tz or
+	// the CRON_TZ= prefix. It's nil when the local time is used.
+	TimeZone    *time.Location
+	Description string
+	Env         []string
+	// Dotenv are the paths of the dotenv files loaded into Env.
+	Dotenv            []string
 	LogDir            string
 	HandlerOn         HandlerOn
 	Steps             []*Step
@@ -38,16 +50,70 @@ type DAG struct {
 	RestartWait       time.Duration
 	HistRetentionDays int
 	Preconditions     []*Condition
-	MaxActiveRuns     int
-	Params            []string
-	DefaultParams     string
-	MaxCleanUpTime    time.Duration
-	Tags              []string
+	// MaxActiveRuns is the max number of the steps running at the same
+	// time. It's unlimited if 0.
+	MaxActiveRuns int
+	Params        []string
+	DefaultParams string
+	// EnvOverridesParams makes the variables of env take precedence over
+	// the named parameters of the same name. By default, parameters win.
+	EnvOverridesParams bool
+	// RuntimeParams are the parameters given at runtime which override
+	// DefaultParams. It is empty when the default parameters are used.
+	RuntimeParams  string
+	MaxCleanUpTime time.Duration
+	Tags           []string
+	// Timeout is the max duration of the steps. The handlers are not
+	// included and they have their own budget of HandlerTimeout.
+	Timeout        time.Duration
+	HandlerTimeout time.Duration
+	// Umask is the umask of the step processes. The umask of the dagu
+	// process is inherited if it's nil.
+	Umask *int
+	// Queue makes the scheduler queue the start of the DAG while it's
+	// running instead of skipping it. QueueLimit is the max number of
+	// the queued starts.
+	Queue      bool
+	QueueLimit int
+	// SkipIfSuccessful makes the scheduler skip a scheduled start if the
+	// DAG succeeded since the previous scheduled time.
+	SkipIfSuccessful bool
+	// CatchUp makes the scheduler start the DAG once on startup if a
+	// scheduled start was missed since the last run.
+	CatchUp bool
+	// WorkingDir is the directory the steps without dir run in. A
+	// relative path is resolved from the directory of the DAG file.
+	WorkingDir string
+	// OnChange is the URL of the webhook the scheduler posts the diff to
+	// when it detects the DAG file changed.
+	OnChange string
+	// Webhooks are the endpoints the result of a run is posted to.
+	Webhooks []*Webhook
+
+	// histRetentionSet is true if histRetentionDays is specified, so that
+	// 0 is not replaced by the default.
+	histRetentionSet bool
+
+	// rawEnv are the values of Env as written in the definition, which
+	// are resolved from secrets or commands. They are written back in
+	// the definition instead of the evaluated values.
+	rawEnv map[string]string
+
+	// baseConfig is the base config the DAG was loaded with, which is one
+	// of the inputs of Checksum.
+	baseConfig string
+
+	// values derived from DefaultParams kept for CloneFresh
+	baseEnv         []string
+	defaultParams   []string
+	defaultParamEnv []string
 }
 
 type Schedule struct {
 	Expression string
 	Parsed     cron.Schedule
+	// Jitter is the max random delay of the start.
+	Jitter time.Duration
 }
 
 type HandlerOn struct {
@@ -60,10 +126,20 @@ type HandlerOn struct {
 type MailOn struct {
 	Failure bool
 	Success bool
+	// Retry sends a mail whenever a step is scheduled for a retry.
+	Retry       bool
+	MinInterval time.Duration
+	// ExceptExitCodes are the exit codes of the failures that don't
+	// trigger the failure mail.
+	ExceptExitCodes []int
 }
 
 var EXTENSIONS = []string{".yaml", ".yml"}
 
+// HistRetentionForever is the histRetentionDays to retain the history
+// forever. 0 means the history of the previous runs is not retained.
+const HistRetentionForever = -1
+
 func ReadConfig(file string) (string, error) {
 	b, err := os.ReadFile(file)
 	return string(b), err
@@ -104,15 +180,64 @@ func (c *DAG) SockAddr() string {
 
 func (c *DAG) Clone() *DAG {
 	ret := *c
+	if c.MailOn != nil {
+		mailOn := *c.MailOn
+		ret.MailOn = &mailOn
+	}
 	return &ret
 }
 
+// CloneFresh returns a copy of the DAG with the runtime state of a prior
+// run cleared. The parameters and the environment variables derived from
+// RuntimeParams are reset to the ones of the definition, and the steps
+// are copied without the output variables of the run.
+func (c *DAG) CloneFresh() *DAG {
+	ret := c.Clone()
+	if c.RuntimeParams != "" {
+		ret.RuntimeParams = ""
+		ret.Params = append([]string{}, c.defaultParams...)
+		ret.Env = append(append([]string{}, c.baseEnv...), c.defaultParamEnv...)
+	}
+	var freshStep func(s *Step) *Step
+	freshStep = func(s *Step) *Step {
+		if s == nil {
+			return nil
+		}
+		step := *s
+		if c.RuntimeParams != "" {
+			step.Variables = append(ret.runEnv(), s.Env...)
+		}
+		step.OutputVariables = nil
+		step.OnSuccess = freshStep(s.OnSuccess)
+		step.OnFailure = freshStep(s.OnFailure)
+		return &step
+	}
+	ret.Steps = make([]*Step, 0, len(c.Steps))
+	for _, s := range c.Steps {
+		ret.Steps = append(ret.Steps, freshStep(s))
+	}
+	ret.HandlerOn = HandlerOn{
+		Failure: freshStep(c.HandlerOn.Failure),
+		Success: freshStep(c.HandlerOn.Success),
+		Cancel:  freshStep(c.HandlerOn.Cancel),
+		Exit:    freshStep(c.HandlerOn.Exit),
+	}
+	return ret
+}
+
 func (c *DAG) String() string {
 	ret := "{\n"
 	ret = fmt.Sprintf("%s\tName: %s\n", ret, c.Name)
 	ret = fmt.Sprintf("%s\tDescription: %s\n", ret, strings.TrimSpace(c.Description))
-	ret = fmt.Sprintf("%s\tEnv: %v\n", ret, strings.Join(c.Env, ", "))
+	ret = fmt.Sprintf("%s\tParams: %v\n", ret, RedactSecrets(strings.Join(c.Params, ", ")))
+	ret = fmt.Sprintf("%s\tEnv: %v\n", ret, RedactSecrets(strings.Join(c.Env, ", ")))
 	ret = fmt.Sprintf("%s\tLogDir: %v\n", ret, c.LogDir)
+	if c.SkipIfSuccessful {
+		ret = fmt.Sprintf("%s\tSkipIfSuccessful: %v\n", ret, c.SkipIfSuccessful)
+	}
+	if c.CatchUp {
+		ret = fmt.Sprintf("%s\tCatchUp: %v\n", ret, c.CatchUp)
+	}
 	for i, s := range c.Steps {
 		ret = fmt.Sprintf("%s\tStep%d: %v\n", ret, i, s)
 	}
@@ -120,51 +245,301 @@ func (c *DAG) String() string {
 	return ret
 }
 
-func (c *DAG) setup() {
+// MarshalDefinition returns the YAML of the definition of the DAG with
+// the evaluated values. It's recorded in the history of a run to load
+// the DAG as it was run later. The variables resolved from secrets or
+// commands are written as they are in the DAG file, not their values.
+func (c *DAG) MarshalDefinition() (string, error) {
+	b, err := yaml.Marshal(c.toDefinition())
+	return string(b), err
+}
+
+// toDefinition converts the DAG back into the definition struct so that
+// it can be marshaled to YAML again. Values are the evaluated ones except
+// the variables resolved from secrets or commands. The definition types
+// are internal, so MarshalDefinition is the API outside the package.
+func (c *DAG) toDefinition() *configDefinition {
+	def := &configDefinition{
+		Name:           c.Name,
+		Group:          c.Group,
+		Description:    c.Description,
+		Schedule:       scheduleToDefinition(c),
+		EnableSeconds:  c.EnableSeconds,
+		LogDir:         c.LogDir,
+		Smtp:           smtpConfigDef{},
+		DelaySec:       int(c.Delay / time.Second),
+		RestartWaitSec: int(c.RestartWait / time.Second),
+		Preconditions:  conditionsToDefinition(c.Preconditions),
+		Params:         c.DefaultParams,
+		Tags:           strings.Join(c.Tags, ","),
+
+		EnvOverridesParams: c.EnvOverridesParams,
+		TimeoutSec:         int(c.Timeout / time.Second),
+		HandlerTimeoutSec:  int(c.HandlerTimeout / time.Second),
+		Umask:              c.UmaskString(),
+		Queue:              c.Queue,
+		QueueLimit:         c.QueueLimit,
+		SkipIfSuccessful:   c.SkipIfSuccessful,
+		CatchUp:            c.CatchUp,
+		OnChange:           c.OnChange,
+		WorkingDir:         c.WorkingDir,
+	}
+	histRetentionDays := c.HistRetentionDays
+	def.HistRetentionDays = &histRetentionDays
+	maxCleanUpTimeSec := int(c.MaxCleanUpTime / time.Second)
+	def.MaxCleanUpTimeSec = &maxCleanUpTimeSec
+
+	params := map[string]bool{}
+	for _, p := range c.Params {
+		if strings.Contains(p, "=") {
+			params[p] = true
+		}
+	}
+	env := []string{}
+	for _, e := range c.Env {
+		if !params[e] {
+			env = append(env, e)
+		}
+	}
+	def.Env = envToDefinition(env, c.rawEnv)
+
+	for _, step := range c.Steps {
+		def.Steps = append(def.Steps, step.toDefinition())
+	}
+	def.HandlerOn = handerOnDef{
+		Exit:    c.HandlerOn.Exit.toDefinition(),
+		Success: c.HandlerOn.Success.toDefinition(),
+		Failure: c.HandlerOn.Failure.toDefinition(),
+		Cancel:  c.HandlerOn.Cancel.toDefinition(),
+	}
+	if c.MailOn != nil {
+		def.MailOn = &mailOnDef{
+			Failure:         c.MailOn.Failure,
+			Success:         c.MailOn.Success,
+			Retry:           c.MailOn.Retry,
+			MinIntervalSec:  int(c.MailOn.MinInterval / time.Second),
+			ExceptExitCodes: c.MailOn.ExceptExitCodes,
+		}
+	}
+	if c.Smtp != nil {
+		def.Smtp = smtpConfigDef{Host: c.Smtp.Host, Port: c.Smtp.Port}
+	}
+	if c.ErrorMail != nil {
+		def.ErrorMail = mailConfigDef(*c.ErrorMail)
+	}
+	if c.InfoMail != nil {
+		def.InfoMail = mailConfigDef(*c.InfoMail)
+	}
+	def.Webhooks = c.webhooksToDefinition()
+	if c.MaxActiveRuns > 0 {
+		maxActiveRuns := c.MaxActiveRuns
+		def.MaxActiveRuns = &maxActiveRuns
+	}
+	return def
+}
+
+func scheduleToDefinition(c *DAG) interface{} {
+	var businessDay *BusinessDaySchedule
+	starts := []*Schedule{}
+	for _, s := range c.Schedule {
+		if bs, ok := s.Parsed.(*BusinessDaySchedule); ok {
+			businessDay = bs
+			continue
+		}
+		starts = append(starts, s)
+	}
+	exprs := func(schedules []*Schedule) []interface{} {
+		ret := []interface{}{}
+		for _, s := range schedules {
+			ret = append(ret, s.Expression)
+		}
+		return ret
+	}
+	jitter := time.Duration(0)
+	if len(c.Schedule) > 0 {
+		jitter = c.Schedule[0].Jitter
+	}
+	if len(c.StopSchedule) == 0 && len(c.RestartSchedule) == 0 &&
+		jitter == 0 && businessDay == nil {
+		if len(starts) == 0 {
+			return nil
+		}
+		return exprs(starts)
+	}
+	ret := map[interface{}]interface{}{}
+	for k, v := range map[string][]*Schedule{
+		scheduleStart:   starts,
+		scheduleStop:    c.StopSchedule,
+		scheduleRestart: c.RestartSchedule,
+	} {
+		if len(v) > 0 {
+			ret[k] = exprs(v)
+		}
+	}
+	if jitter > 0 {
+		ret[scheduleJitter] = int(jitter / time.Second)
+	}
+	if businessDay != nil {
+		ret[scheduleBusinessDay] = businessDay.Day
+		ret[scheduleTime] = fmt.Sprintf("%02d:%02d", businessDay.Hour, businessDay.Minute)
+		if len(businessDay.Holidays) > 0 {
+			holidays := []interface{}{}
+			for _, h := range businessDay.Holidays {
+				holidays = append(holidays, h)
+			}
+			ret[scheduleHolidays] = holidays
+		}
+		if businessDay.Location != nil {
+			ret[scheduleTz] = businessDay.Location.String()
+		}
+	}
+	return ret
+}
+
+func conditionsToDefinition(cond []*Condition) []*conditionDef {
+	ret := []*conditionDef{}
+	for _, c := range cond {
+		def := &conditionDef{
+			Condition: c.Condition,
+			Expected:  c.Expected,
+			Shell:     c.Shell,
+		}
+		if c.Disk != nil {
+			def.Disk = &diskConditionDef{
+				Path:      c.Disk.Path,
+				MinFreeGB: c.Disk.MinFreeGB,
+			}
+		}
+		ret = append(ret, def)
+	}
+	return ret
+}
+
+// setup sets the default values. The steps without dir run in the
+// workingDir, or the defaultDir if it's not set, which is the current
+// directory if it's empty. Relative dirs are resolved from defaultDir.
+func (c *DAG) setup(defaultDir string) {
 	if c.LogDir == "" {
 		c.LogDir = path.Join(settings.MustGet(settings.SETTING__LOGS_DIR), "dags")
 	}
-	if c.HistRetentionDays == 0 {
+	if c.HistRetentionDays == 0 && !c.histRetentionSet {
 		c.HistRetentionDays = 30
 	}
 	if c.MaxCleanUpTime == 0 {
 		c.MaxCleanUpTime = time.Second * 60
 	}
-	dir := path.Dir(c.Location)
-	for _, step := range c.Steps {
-		c.setupStep(step, dir)
-	}
-	if c.HandlerOn.Exit != nil {
-		c.setupStep(c.HandlerOn.Exit, dir)
+	if c.WorkingDir != "" && !path.IsAbs(c.WorkingDir) && defaultDir != "" {
+		c.WorkingDir = path.Join(defaultDir, c.WorkingDir)
 	}
-	if c.HandlerOn.Success != nil {
-		c.setupStep(c.HandlerOn.Success, dir)
+	_ = c.WalkSteps(func(step *Step) error {
+		c.setupStep(step, defaultDir)
+		return nil
+	})
+}
+
+// Environment returns the environment the DAG runs with: the variables
+// of env and the parameters, which are expanded as $1, $2, ..., $@ and $#.
+func (c *DAG) Environment() *Environment {
+	return NewEnvironment(c.runEnv()...)
+}
+
+func (c *DAG) runEnv() []string {
+	return append(append([]string{}, c.Env...), paramsEnv(c.Params)...)
+}
+
+// WalkSteps calls fn for each step, the hooks of the steps, and the
+// handler steps of the DAG. It stops walking and returns the error if
+// fn returns an error.
+func (c *DAG) WalkSteps(fn func(*Step) error) error {
+	for _, step := range c.Steps {
+		for _, s := range []*Step{step, step.OnSuccess, step.OnFailure} {
+			if s == nil {
+				continue
+			}
+			if err := fn(s); err != nil {
+				return err
+			}
+		}
 	}
-	if c.HandlerOn.Failure != nil {
-		c.setupStep(c.HandlerOn.Failure, dir)
+	for _, step := range []*Step{
+		c.HandlerOn.Exit,
+		c.HandlerOn.Success,
+		c.HandlerOn.Failure,
+		c.HandlerOn.Cancel,
+	} {
+		if step == nil {
+			continue
+		}
+		if err := fn(step); err != nil {
+			return err
+		}
 	}
-	if c.HandlerOn.Cancel != nil {
-		c.setupStep(c.HandlerOn.Cancel, dir)
+	return nil
+}
+
+// UmaskString returns the umask as an octal string, e.g. "022".
+// It returns an empty string if the umask is not set.
+func (c *DAG) UmaskString() string {
+	if c.Umask == nil {
+		return ""
 	}
+	return fmt.Sprintf("%03o", *c.Umask)
 }
 
 func (c *DAG) setupStep(step *Step, defaultDir string) {
-	if step.Dir == "" {
-		step.Dir = path.Dir(c.Location)
+	switch {
+	case step.Dir == "" && c.WorkingDir != "":
+		step.Dir = c.WorkingDir
+	case step.Dir == "":
+		step.Dir = defaultDir
+	case !path.IsAbs(step.Dir) && defaultDir != "":
+		step.Dir = path.Join(defaultDir, step.Dir)
+	}
+	if step.Umask == nil {
+		step.Umask = c.Umask
 	}
 }
 
+// assertDirs returns an error if the dir of a step doesn't exist and
+// it's not created on run.
+func (c *DAG) assertDirs() error {
+	return c.WalkSteps(func(step *Step) error {
+		if step.Dir == "" || step.CreateDir {
+			return nil
+		}
+		fi, err := os.Stat(step.Dir)
+		if err != nil {
+			return fmt.Errorf("directory of step %s does not exist: %s", step.Name, step.Dir)
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("dir of step %s is not a directory: %s", step.Name, step.Dir)
+		}
+		return nil
+	})
+}
+
 type BuildDAGOptions struct {
 	headOnly   bool
 	parameters string
 	noEval     bool
-	noSetenv   bool
+	// noSetup skips setting up the directories of the DAG.
+	noSetup    bool
 	defaultEnv map[string]string
+	// fsys is the file system to read the files of the DAG from.
+	// The OS file system is used if it's nil.
+	fsys fs.FS
 }
 
 type builder struct {
 	BuildDAGOptions
 	baseConfig *DAG
+	env        *Environment
+	// file is the path of the DAG file being built. It is empty when
+	// the DAG is built from data.
+	file string
+	// envKeys are the variables of env which named parameters must not
+	// override when envOverridesParams is set.
+	envKeys map[string]bool
 }
 
 type buildStep struct {
@@ -172,10 +547,21 @@ type buildStep struct {
 	Headline bool
 }
 
-var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+// The parsers accept the descriptors, e.g. "@daily" and "@every 1h30m",
+// in addition to the cron fields.
+var (
+	cronParser = cron.NewParser(
+		cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+	cronParserWithSeconds = cron.NewParser(
+		cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+)
 
 func (b *builder) buildFromDefinition(def *configDefinition, baseConfig *DAG) (d *DAG, err error) {
 	b.baseConfig = baseConfig
+	b.env = NewEnvironment()
+	if baseConfig != nil {
+		b.env = NewEnvironment(baseConfig.Env...)
+	}
 
 	d = &DAG{}
 	d.Init()
@@ -187,20 +573,35 @@ func (b *builder) buildFromDefinition(def *configDefinition, baseConfig *DAG) (d
 	d.Group = def.Group
 	d.Description = def.Description
 	if def.MailOn != nil {
+		if def.MailOn.MinIntervalSec < 0 {
+			return nil, fmt.Errorf("mailOn.minIntervalSec must not be negative: %d",
+				def.MailOn.MinIntervalSec)
+		}
 		d.MailOn = &MailOn{
-			Failure: def.MailOn.Failure,
-			Success: def.MailOn.Success,
+			Failure:         def.MailOn.Failure,
+			Success:         def.MailOn.Success,
+			Retry:           def.MailOn.Retry,
+			MinInterval:     time.Second * time.Duration(def.MailOn.MinIntervalSec),
+			ExceptExitCodes: def.MailOn.ExceptExitCodes,
 		}
 	}
 	d.Delay = time.Second * time.Duration(def.DelaySec)
 	d.RestartWait = time.Second * time.Duration(def.RestartWaitSec)
 	d.Tags = parseTags(def.Tags)
+	d.SkipIfSuccessful = def.SkipIfSuccessful
+	d.CatchUp = def.CatchUp
+	d.OnChange = def.OnChange
+	d.WorkingDir = b.expandEnv(def.WorkingDir)
 
 	for _, bs := range []buildStep{
 		{
 			BuildFn:  b.buildSchedule,
 			Headline: true,
 		},
+		{
+			BuildFn:  b.buildQueue,
+			Headline: true,
+		},
 		{
 			BuildFn: b.buildEnvVariables,
 		},
@@ -223,10 +624,13 @@ func (b *builder) buildFromDefinition(def *configDefinition, baseConfig *DAG) (d
 			BuildFn: buildSmtpConfigFromDefinition,
 		},
 		{
-			BuildFn: buildErrorMailConfig,
+			BuildFn: b.buildErrorMailConfig,
 		},
 		{
-			BuildFn: buildInfoMailConfig,
+			BuildFn: b.buildInfoMailConfig,
+		},
+		{
+			BuildFn: b.buildWebhooks,
 		},
 	} {
 		if (b.headOnly && bs.Headline) || !b.headOnly {
@@ -243,12 +647,26 @@ const (
 	scheduleStart   = "start"
 	scheduleStop    = "stop"
 	scheduleRestart = "restart"
+	scheduleAt      = "at"
+	scheduleTz      = "tz"
+	scheduleCron    = "cron"
+	scheduleJitter  = "jitterSec"
+
+	scheduleBusinessDay = "businessDay"
+	scheduleTime        = "time"
+	scheduleHolidays    = "holidays"
 )
 
 func (b *builder) buildSchedule(def *configDefinition, d *DAG) error {
 	starts := []string{}
 	stops := []string{}
 	restarts := []string{}
+	ats := []string{}
+	tz := ""
+	jitterSec := 0
+	businessDay := 0
+	businessDayTime := ""
+	holidays := []string{}
 
 	switch (def.Schedule).(type) {
 	case string:
@@ -268,11 +686,62 @@ func (b *builder) buildSchedule(def *configDefinition, d *DAG) error {
 			}
 			kk := k.(string)
 			switch kk {
-			case scheduleStart, scheduleStop, scheduleRestart:
+			case scheduleAt:
+				switch vv := v.(type) {
+				case string:
+					ats = append(ats, vv)
+				case []interface{}:
+					for _, a := range vv {
+						if aa, ok := a.(string); ok {
+							ats = append(ats, aa)
+						} else {
+							return fmt.Errorf("schedule at must be a string or an array of strings")
+						}
+					}
+				default:
+					return fmt.Errorf("schedule at must be a string or an array of strings")
+				}
+			case scheduleTz:
+				if vv, ok := v.(string); ok {
+					tz = vv
+				} else {
+					return fmt.Errorf("schedule tz must be a string")
+				}
+			case scheduleJitter:
+				if vv, ok := v.(int); ok && vv >= 0 {
+					jitterSec = vv
+				} else {
+					return fmt.Errorf("schedule jitterSec must be a non-negative integer")
+				}
+			case scheduleBusinessDay:
+				if vv, ok := v.(int); ok {
+					businessDay = vv
+				} else {
+					return fmt.Errorf("schedule businessDay must be an integer")
+				}
+			case scheduleTime:
+				if vv, ok := v.(string); ok {
+					businessDayTime = vv
+				} else {
+					return fmt.Errorf("schedule time must be a string")
+				}
+			case scheduleHolidays:
+				vv, ok := v.([]interface{})
+				if !ok {
+					return fmt.Errorf("schedule holidays must be an array of strings")
+				}
+				for _, h := range vv {
+					if hh, ok := h.(string); ok {
+						holidays = append(holidays, hh)
+					} else {
+						return fmt.Errorf("schedule holidays must be an array of strings")
+					}
+				}
+			case scheduleStart, scheduleCron, scheduleStop, scheduleRestart:
 				switch (v).(type) {
 				case string:
 					switch kk {
-					case scheduleStart:
+					case scheduleStart, scheduleCron:
 						starts = append(starts, v.(string))
 					case scheduleStop:
 						stops = append(stops, v.(string))
@@ -283,7 +752,7 @@ func (b *builder) buildSchedule(def *configDefinition, d *DAG) error {
 					for _, vv := range v.([]interface{}) {
 						if vvv, ok := vv.(string); ok {
 							switch kk {
-							case scheduleStart:
+							case scheduleStart, scheduleCron:
 								starts = append(starts, vvv)
 							case scheduleStop:
 								stops = append(stops, vvv)
@@ -298,36 +767,176 @@ func (b *builder) buildSchedule(def *configDefinition, d *DAG) error {
 					return fmt.Errorf("schedule must be a string or an array of strings")
 				}
 			default:
-				return fmt.Errorf("schedule key must be start or stop")
+				return fmt.Errorf("schedule key must be start, stop, restart, cron, at, tz, jitterSec, businessDay, time or holidays")
 			}
 		}
 	case nil:
 	default:
 		return fmt.Errorf("invalid schedule type: %T", def.Schedule)
 	}
+	if tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return fmt.Errorf("invalid schedule tz: %s", tz)
+		}
+		d.TimeZone = loc
+		starts = withTimeZone(starts, tz)
+		stops = withTimeZone(stops, tz)
+		restarts = withTimeZone(restarts, tz)
+	}
+	for _, a := range ats {
+		expr, err := parseAtTime(a, tz, def.EnableSeconds)
+		if err != nil {
+			return err
+		}
+		starts = append(starts, expr)
+	}
+	parser := cronParser
+	if def.EnableSeconds {
+		parser = cronParserWithSeconds
+	}
+	d.EnableSeconds = def.EnableSeconds
 	var err error
-	d.Schedule, err = parseSchedule(starts)
+	d.Schedule, err = parseSchedule(parser, starts)
 	if err != nil {
 		return err
 	}
-	d.StopSchedule, err = parseSchedule(stops)
+	if businessDay != 0 || businessDayTime != "" || len(holidays) > 0 {
+		s, err := newBusinessDaySchedule(businessDay, businessDayTime, holidays, tz)
+		if err != nil {
+			return err
+		}
+		d.Schedule = append(d.Schedule, &Schedule{
+			Expression: s.Expression(),
+			Parsed:     s,
+		})
+	}
+	for _, s := range d.Schedule {
+		s.Jitter = time.Second * time.Duration(jitterSec)
+	}
+	d.StopSchedule, err = parseSchedule(parser, stops)
 	if err != nil {
 		return err
 	}
-	d.RestartSchedule, err = parseSchedule(restarts)
-	return err
+	d.RestartSchedule, err = parseSchedule(parser, restarts)
+	if err != nil {
+		return err
+	}
+	if d.TimeZone == nil {
+		// the timezone of the inline CRON_TZ= prefix of the first schedule
+		for _, s := range d.Schedule {
+			if loc, ok := scheduleTimeZone(s.Expression); ok {
+				d.TimeZone = loc
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// withTimeZone prefixes the cron expressions with CRON_TZ= of the
+// timezone unless they have their own.
+func withTimeZone(exprs []string, tz string) []string {
+	ret := []string{}
+	for _, e := range exprs {
+		if _, _, ok := cutTimeZone(e); !ok {
+			e = fmt.Sprintf("CRON_TZ=%s %s", tz, e)
+		}
+		ret = append(ret, e)
+	}
+	return ret
+}
+
+// cutTimeZone splits the CRON_TZ= or TZ= prefix of the cron expression.
+func cutTimeZone(expr string) (tz, rest string, ok bool) {
+	for _, prefix := range []string{"CRON_TZ=", "TZ="} {
+		if strings.HasPrefix(expr, prefix) {
+			kv := strings.SplitN(strings.TrimPrefix(expr, prefix), " ", 2)
+			if len(kv) == 2 {
+				return kv[0], kv[1], true
+			}
+			return kv[0], "", true
+		}
+	}
+	return "", expr, false
+}
+
+// scheduleTimeZone returns the location of the CRON_TZ= prefix of the
+// cron expression.
+func scheduleTimeZone(expr string) (*time.Location, bool) {
+	tz, _, ok := cutTimeZone(expr)
+	if !ok {
+		return nil, false
+	}
+	loc, err := time.LoadLocation(tz)
+	return loc, err == nil
+}
+
+// defaultQueueLimit is the max number of the queued starts of a DAG
+// when queueLimit is not specified.
+const defaultQueueLimit = 1
+
+func (b *builder) buildQueue(def *configDefinition, d *DAG) error {
+	if def.QueueLimit < 0 {
+		return fmt.Errorf("queueLimit must not be negative: %d", def.QueueLimit)
+	}
+	d.Queue = def.Queue
+	d.QueueLimit = def.QueueLimit
+	if d.Queue && d.QueueLimit == 0 {
+		d.QueueLimit = defaultQueueLimit
+	}
+	return nil
+}
+
+// envToDefinition converts the "KEY=value" pairs to the list of
+// mappings of the env field. The values in raw are used instead of the
+// evaluated ones so that secrets are not written, and the other values
+// are redacted.
+func envToDefinition(pairs []string, raw map[string]string) []interface{} {
+	env := []interface{}{}
+	for _, e := range pairs {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		val, ok := raw[kv[0]]
+		if !ok {
+			val = RedactSecrets(kv[1])
+		}
+		env = append(env, map[interface{}]interface{}{kv[0]: val})
+	}
+	return env
 }
 
 func (b *builder) buildEnvVariables(def *configDefinition, d *DAG) (err error) {
-	var env map[string]string
-	env, err = b.loadVariables(def.Env, b.defaultEnv)
+	var dotenv *Environment
+	d.Dotenv, dotenv, err = b.loadDotenv(def.Dotenv)
+	if err != nil {
+		return err
+	}
+	var env *Environment
+	env, d.rawEnv, err = b.loadVariables(def.Env, b.defaultEnv)
 	if err == nil {
-		d.Env = buildConfigEnv(env)
+		d.Env = env.MarshalForExec()
+		for _, e := range dotenv.Pairs() {
+			key := strings.SplitN(e, "=", 2)[0]
+			if _, ok := env.Lookup(key); !ok {
+				d.Env = append(d.Env, e)
+			}
+		}
 		if b.baseConfig != nil {
 			for _, e := range b.baseConfig.Env {
 				key := strings.SplitN(e, "=", 2)[0]
-				if _, ok := env[key]; !ok {
+				_, ok := env.Lookup(key)
+				_, inDotenv := dotenv.Lookup(key)
+				if !ok && !inDotenv {
 					d.Env = append(d.Env, e)
+					if raw, ok := b.baseConfig.rawEnv[key]; ok {
+						if d.rawEnv == nil {
+							d.rawEnv = map[string]string{}
+						}
+						d.rawEnv[key] = raw
+					}
 				}
 			}
 		}
@@ -336,15 +945,35 @@ func (b *builder) buildEnvVariables(def *configDefinition, d *DAG) (err error) {
 }
 
 func (b *builder) buildLogdir(def *configDefinition, d *DAG) (err error) {
-	d.LogDir, err = utils.ParseVariable(def.LogDir)
+	d.LogDir, err = b.parseVariable(def.LogDir)
 	return err
 }
 
 func (b *builder) buildParameters(def *configDefinition, d *DAG) (err error) {
-	d.DefaultParams = def.Params
+	d.DefaultParams, err = paramsString(def.Params)
+	if err != nil {
+		return err
+	}
+	d.EnvOverridesParams = def.EnvOverridesParams
+	if def.EnvOverridesParams {
+		b.envKeys = map[string]bool{}
+		for _, e := range d.Env {
+			b.envKeys[strings.SplitN(e, "=", 2)[0]] = true
+		}
+	}
 	p := d.DefaultParams
 	if b.parameters != "" {
 		p = b.parameters
+		d.RuntimeParams = b.parameters
+		d.baseEnv = append([]string{}, d.Env...)
+		// evaluate the default parameters in a separate environment so
+		// that they don't leak into the runtime ones.
+		fb := *b
+		fb.env = NewEnvironment(b.env.Pairs()...)
+		d.defaultParams, d.defaultParamEnv, err = fb.parseParameters(d.DefaultParams, !b.noEval)
+		if err != nil {
+			return err
+		}
 	}
 	var envs []string
 	d.Params, envs, err = b.parseParameters(p, !b.noEval)
@@ -354,50 +983,126 @@ func (b *builder) buildParameters(def *configDefinition, d *DAG) (err error) {
 	return
 }
 
+// stepID returns the identifier of the step derived from its name and
+// position, which is stable across loads of the same DAG.
+func stepID(name string, index int) string {
+	h := md5.Sum([]byte(fmt.Sprintf("%d:%s", index, name)))
+	return fmt.Sprintf("%x", h[:6])
+}
+
 func (b *builder) buildHandlers(def *configDefinition, d *DAG) (err error) {
 	if def.HandlerOn.Exit != nil {
 		def.HandlerOn.Exit.Name = constants.OnExit
-		if d.HandlerOn.Exit, err = b.buildStep(d.Env, def.HandlerOn.Exit); err != nil {
+		if d.HandlerOn.Exit, err = b.buildStep(d.runEnv(), def.HandlerOn.Exit); err != nil {
 			return err
 		}
 	}
 
 	if def.HandlerOn.Success != nil {
 		def.HandlerOn.Success.Name = constants.OnSuccess
-		if d.HandlerOn.Success, err = b.buildStep(d.Env, def.HandlerOn.Success); err != nil {
+		if d.HandlerOn.Success, err = b.buildStep(d.runEnv(), def.HandlerOn.Success); err != nil {
 			return
 		}
 	}
 
 	if def.HandlerOn.Failure != nil {
 		def.HandlerOn.Failure.Name = constants.OnFailure
-		if d.HandlerOn.Failure, err = b.buildStep(d.Env, def.HandlerOn.Failure); err != nil {
+		if d.HandlerOn.Failure, err = b.buildStep(d.runEnv(), def.HandlerOn.Failure); err != nil {
 			return
 		}
 	}
 
 	if def.HandlerOn.Cancel != nil {
 		def.HandlerOn.Cancel.Name = constants.OnCancel
-		if d.HandlerOn.Cancel, err = b.buildStep(d.Env, def.HandlerOn.Cancel); err != nil {
+		if d.HandlerOn.Cancel, err = b.buildStep(d.runEnv(), def.HandlerOn.Cancel); err != nil {
 			return
 		}
 	}
+	for _, h := range []*Step{
+		d.HandlerOn.Exit, d.HandlerOn.Success, d.HandlerOn.Failure, d.HandlerOn.Cancel,
+	} {
+		if h != nil && h.ID == "" {
+			h.ID = h.Name
+		}
+	}
 	return nil
 }
 
 func (b *builder) buildConfig(def *configDefinition, d *DAG) (err error) {
 	if def.HistRetentionDays != nil {
+		if *def.HistRetentionDays < HistRetentionForever {
+			return fmt.Errorf("histRetentionDays must be %d (retain forever) or greater: %d",
+				HistRetentionForever, *def.HistRetentionDays)
+		}
 		d.HistRetentionDays = *def.HistRetentionDays
+		d.histRetentionSet = true
 	}
 	d.Preconditions = loadPreCondition(def.Preconditions)
-	d.MaxActiveRuns = def.MaxActiveRuns
+	if def.MaxActiveRuns != nil {
+		if *def.MaxActiveRuns < 1 {
+			return fmt.Errorf("maxActiveRuns must be 1 or greater: %d", *def.MaxActiveRuns)
+		}
+		d.MaxActiveRuns = *def.MaxActiveRuns
+	}
 
 	if def.MaxCleanUpTimeSec != nil {
 		d.MaxCleanUpTime = time.Second * time.Duration(*def.MaxCleanUpTimeSec)
 	}
+	if def.TimeoutSec < 0 || def.HandlerTimeoutSec < 0 {
+		return fmt.Errorf("timeoutSec and handlerTimeoutSec must not be negative")
+	}
+	d.Timeout = time.Second * time.Duration(def.TimeoutSec)
+	d.HandlerTimeout = time.Second * time.Duration(def.HandlerTimeoutSec)
+	if def.Umask != "" {
+		u, err := strconv.ParseUint(def.Umask, 8, 32)
+		if err != nil || u > 0777 {
+			return fmt.Errorf("umask must be an octal number from 000 to 777: %s", def.Umask)
+		}
+		umask := int(u)
+		d.Umask = &umask
+	}
 	return nil
 }
 
+// paramsString returns the parameters in the string form. A mapping is
+// converted to the named parameters in the order of the keys, e.g.
+// {FOO: bar, BAZ: qux} becomes `BAZ="qux" FOO="bar"`.
+func paramsString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case map[interface{}]interface{}:
+		keys := []string{}
+		vals := map[string]string{}
+		for k, val := range v {
+			ks, ok := k.(string)
+			if !ok {
+				return "", fmt.Errorf("invalid key of params: %v", k)
+			}
+			keys = append(keys, ks)
+			if val != nil {
+				vals[ks] = fmt.Sprint(val)
+			}
+		}
+		sort.Strings(keys)
+		escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+		params := []string{}
+		for _, k := range keys {
+			params = append(params, fmt.Sprintf(`%s="%s"`, k, escaper.Replace(vals[k])))
+		}
+		return strings.Join(params, " "), nil
+	default:
+		return "", fmt.Errorf("params must be a string or a mapping: %v", value)
+	}
+}
+
+// parseParameters parses the parameters from left to right. Each parameter
+// is set to the build environment before the next one is evaluated, so a
+// parameter can refer to the parameters defined before it. A named
+// parameter overrides the variable of env of the same name unless
+// envOverridesParams is set.
 func (b *builder) parseParameters(value string, eval bool) (
 	params []string,
 	envs []string,
@@ -414,130 +1119,379 @@ func (b *builder) parseParameters(value string, eval bool) (
 	}
 
 	ret := []string{}
+	b.setParamsSummary(ret)
 	for i, v := range parsed {
 		if eval {
-			v, err = utils.ParseCommand(os.ExpandEnv(v))
+			v, err = b.parseVariable(v)
 			if err != nil {
 				return nil, nil, err
 			}
 		}
-		if !b.noSetenv {
-			if strings.Contains(v, "=") {
-				parts := strings.SplitN(v, "=", 2)
-				os.Setenv(parts[0], parts[1])
+		if strings.Contains(v, "=") {
+			parts := strings.SplitN(v, "=", 2)
+			if !b.envKeys[parts[0]] {
+				b.env.Set(parts[0], parts[1])
 				envs = append(envs, v)
 			}
-			err = os.Setenv(strconv.Itoa(i+1), v)
-			if err != nil {
-				return nil, nil, err
-			}
 		}
+		b.env.Set(strconv.Itoa(i+1), v)
 		ret = append(ret, v)
+		b.setParamsSummary(ret)
 	}
 	return ret, envs, nil
 }
 
+// setParamsSummary sets $@ (all the parameters joined by a space)
+// and $# (the number of the parameters) as in shell scripts.
+func (b *builder) setParamsSummary(params []string) {
+	b.env.Set("@", strings.Join(params, " "))
+	b.env.Set("#", strconv.Itoa(len(params)))
+}
+
+// paramsEnv returns the parameters as the variables of the positional
+// parameters and the ones set by setParamsSummary.
+func paramsEnv(params []string) []string {
+	ret := []string{}
+	for i, p := range params {
+		ret = append(ret, fmt.Sprintf("%d=%s", i+1, p))
+	}
+	return append(ret,
+		fmt.Sprintf("@=%s", strings.Join(params, " ")),
+		fmt.Sprintf("#=%d", len(params)))
+}
+
 type envVariable struct {
 	key string
 	val string
+	// unordered is true for the variables of a map, which have no order
+	// in the definition.
+	unordered bool
 }
 
+// loadVariables evaluates the variables in order. Each of them is
+// expanded once with the environment built so far, so that referring
+// to prior entries keeps the cost linear in the size of the block.
+// The variables of a map are evaluated in the order of the names.
 func (b *builder) loadVariables(strVariables interface{}, defaults map[string]string) (
-	map[string]string, error,
+	*Environment, map[string]string, error,
 ) {
 	var vals []*envVariable = []*envVariable{}
-	for k, v := range defaults {
-		vals = append(vals, &envVariable{k, v})
+	keys := make([]string, 0, len(defaults))
+	for k := range defaults {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		vals = append(vals, &envVariable{k, defaults[k], true})
 	}
 
-	loadFn := func(a []*envVariable, m map[interface{}]interface{}) ([]*envVariable, error) {
+	loadFn := func(a []*envVariable, m map[interface{}]interface{}, unordered bool) ([]*envVariable, error) {
+		keys := []string{}
 		for k, v := range m {
 			if ks, ok := k.(string); ok {
-				if vs, ok := v.(string); ok {
-					a = append(a, &envVariable{ks, vs})
-				} else {
+				if _, ok := v.(string); !ok {
 					return a, fmt.Errorf("invalid value for env %s", ks)
 				}
+				keys = append(keys, ks)
 			}
 		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			a = append(a, &envVariable{k, m[k].(string), unordered})
+		}
 		return a, nil
 	}
 
 	var err error
 	if a, ok := strVariables.(map[interface{}]interface{}); ok {
-		vals, err = loadFn(vals, a)
+		vals, err = loadFn(vals, a, true)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 
 	if a, ok := strVariables.([]interface{}); ok {
 		for _, v := range a {
 			if aa, ok := v.(map[interface{}]interface{}); ok {
-				vals, err = loadFn(vals, aa)
+				vals, err = loadFn(vals, aa, false)
 				if err != nil {
-					return nil, err
+					return nil, nil, err
 				}
 			}
 		}
 	}
 
-	vars := map[string]string{}
-	for _, v := range vals {
-		parsed, err := utils.ParseVariable(v.val)
-		if err != nil {
-			return nil, err
+	vars := NewEnvironment()
+	var raw map[string]string
+	set := func(v *envVariable, val string) {
+		if v.unordered {
+			vars.SetUnordered(v.key, val)
+		} else {
+			vars.Set(v.key, val)
+		}
+		b.env.Set(v.key, val)
+	}
+	// keep the value as written if it's resolved from a secret or a
+	// command, or contains a secret by a reference to other variables.
+	setRaw := func(v *envVariable) {
+		if raw == nil {
+			raw = map[string]string{}
 		}
-		vars[v.key] = parsed
-		if !b.noSetenv {
-			err = os.Setenv(v.key, parsed)
+		raw[v.key] = v.val
+	}
+	for _, v := range vals {
+		if !b.noEval {
+			secret, ok, err := resolveSecret(v.val)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
+			if ok {
+				set(v, secret)
+				setRaw(v)
+				continue
+			}
+		}
+		parsed, err := b.parseVariable(v.val)
+		if err != nil {
+			return nil, nil, err
+		}
+		set(v, parsed)
+		if !b.noEval && (strings.Contains(v.val, "`") || RedactSecrets(parsed) != parsed) {
+			setRaw(v)
 		}
 	}
-	return vars, nil
+	return vars, raw, nil
 }
 
 func (b *builder) buildStepsFromDefinition(def *configDefinition, d *DAG) error {
 	ret := []*Step{}
-	for _, stepDef := range def.Steps {
-		step, err := b.buildStep(d.Env, stepDef)
+	names := map[string]bool{}
+	ids := map[string]bool{}
+	for i, stepDef := range def.Steps {
+		step, err := b.buildStep(d.runEnv(), stepDef)
 		if err != nil {
 			return err
 		}
+		if names[step.Name] {
+			return fmt.Errorf("duplicate step name: %s", step.Name)
+		}
+		names[step.Name] = true
+		if step.ID == "" {
+			step.ID = stepID(step.Name, i)
+		}
+		if ids[step.ID] {
+			return fmt.Errorf("duplicate step id: %s", step.ID)
+		}
+		ids[step.ID] = true
 		ret = append(ret, step)
 	}
+	if err := expandTagDepends(ret); err != nil {
+		return err
+	}
+	if err := assertNoCycle(ret); err != nil {
+		return err
+	}
 	d.Steps = ret
 	return nil
 }
 
+// assertNoCycle returns an error naming the steps of the first cycle
+// found in the dependencies of the steps, e.g. "cycle detected: a -> b -> a".
+func assertNoCycle(steps []*Step) error {
+	byName := map[string]*Step{}
+	for _, s := range steps {
+		byName[s.Name] = s
+	}
+	const (
+		visiting = iota + 1
+		visited
+	)
+	state := map[string]int{}
+	trail := []string{}
+	var visit func(s *Step) error
+	visit = func(s *Step) error {
+		state[s.Name] = visiting
+		trail = append(trail, s.Name)
+		for _, dep := range s.Depends {
+			next, ok := byName[dep]
+			if !ok {
+				continue
+			}
+			switch state[dep] {
+			case visiting:
+				for i, n := range trail {
+					if n == dep {
+						cycle := append(append([]string{}, trail[i:]...), dep)
+						return fmt.Errorf("cycle detected: %s", strings.Join(cycle, " -> "))
+					}
+				}
+			case visited:
+			default:
+				if err := visit(next); err != nil {
+					return err
+				}
+			}
+		}
+		trail = trail[:len(trail)-1]
+		state[s.Name] = visited
+		return nil
+	}
+	for _, s := range steps {
+		if state[s.Name] == 0 {
+			if err := visit(s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dependsTagPrefix is the prefix of a depends entry to depend on all
+// the steps with the tag, e.g. "tag:extract".
+const dependsTagPrefix = "tag:"
+
+// expandTagDepends replaces the "tag:<name>" entries in the depends of
+// the steps with the names of the other steps with the tag.
+func expandTagDepends(steps []*Step) error {
+	tagged := map[string][]string{}
+	for _, s := range steps {
+		for _, t := range s.Tags {
+			tagged[t] = append(tagged[t], s.Name)
+		}
+	}
+	for _, s := range steps {
+		deps := []string{}
+		seen := map[string]bool{}
+		for _, dep := range s.Depends {
+			names := []string{dep}
+			if strings.HasPrefix(dep, dependsTagPrefix) {
+				tag := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(dep, dependsTagPrefix)))
+				names = tagged[tag]
+				if len(names) == 0 {
+					return fmt.Errorf("step %s depends on tag %s, but no step has the tag", s.Name, tag)
+				}
+			}
+			for _, n := range names {
+				if n == s.Name && n != dep || seen[n] {
+					continue
+				}
+				seen[n] = true
+				deps = append(deps, n)
+			}
+		}
+		if len(s.Depends) > 0 {
+			s.Depends = deps
+		}
+	}
+	return nil
+}
+
 func (b *builder) buildStep(variables []string, def *stepDef) (*Step, error) {
 	if err := assertStepDef(def); err != nil {
 		return nil, err
 	}
 	step := &Step{}
+	step.ID = def.Id
 	step.Name = def.Name
-	step.Description = def.Description
-	step.CmdWithArgs = def.Command
-	step.Command, step.Args = utils.SplitCommand(step.CmdWithArgs, false)
+	step.Meta = def.Meta
+	step.Tags = parseTags(def.Tags)
+	description, err := renderDescription(def.Description, def.Meta)
+	if err != nil {
+		return nil, err
+	}
+	step.Description = description
+	switch cmd := def.Command.(type) {
+	case string:
+		step.CmdWithArgs = cmd
+		step.Command, step.Args = utils.SplitCommand(step.CmdWithArgs, false)
+	case []interface{}:
+		if step.CmdArgv, err = parseCommandArgv(cmd); err != nil {
+			return nil, fmt.Errorf("step %s: %w", step.Name, err)
+		}
+		step.Command, step.Args = step.CmdArgv[0], append([]string{}, step.CmdArgv[1:]...)
+	default:
+		return nil, fmt.Errorf("invalid command type of step %s: %T", step.Name, def.Command)
+	}
+	if def.ArgsFile != "" {
+		step.ArgsFile = def.ArgsFile
+		if step.FileArgs, err = b.loadArgsFile(def.ArgsFile); err != nil {
+			return nil, err
+		}
+		step.Args = append(step.Args, step.FileArgs...)
+	}
 	step.Script = def.Script
 	step.Stdout = b.expandEnv(def.Stdout)
 	step.Stderr = b.expandEnv(def.Stderr)
-	step.Output = def.Output
-	step.Dir = b.expandEnv(def.Dir)
+	if def.Stdin != "" && def.StdinFile != "" {
+		return nil, fmt.Errorf("stdin and stdinFile must not be specified together")
+	}
+	step.Stdin = b.expandEnv(def.Stdin)
+	step.StdinFile = b.expandEnv(def.StdinFile)
+	for _, a := range def.Artifacts {
+		a = b.expandEnv(a)
+		if _, err := path.Match(a, ""); err != nil {
+			return nil, fmt.Errorf("invalid artifacts pattern %s: %w", a, err)
+		}
+		step.Artifacts = append(step.Artifacts, a)
+	}
+	if err := buildStepOutput(step, def.Output); err != nil {
+		return nil, err
+	}
+	if err := b.buildStepDir(step, def.Dir); err != nil {
+		return nil, err
+	}
 	step.Executor = def.Executor
 	step.ExecutorConfig = def.ExecutorConfig
 	step.Variables = variables
+	if def.Env != nil {
+		// the variables of the step are evaluated in a separate
+		// environment so that they don't leak into the other steps.
+		fb := *b
+		fb.env = NewEnvironment(b.env.Pairs()...)
+		env, raw, err := fb.loadVariables(def.Env, nil)
+		if err != nil {
+			return nil, err
+		}
+		step.Env = env.MarshalForExec()
+		step.rawEnv = raw
+		step.Variables = append(append([]string{}, variables...), step.Env...)
+	}
+	if step.Executor == ExecutorHTTP {
+		if step.HTTP, err = buildHTTPConfig(step); err != nil {
+			return nil, err
+		}
+	}
 	step.Depends = def.Depends
 	if def.ContinueOn != nil {
 		step.ContinueOn.Skipped = def.ContinueOn.Skipped
 		step.ContinueOn.Failure = def.ContinueOn.Failure
+		for _, code := range def.ContinueOn.ExitCode {
+			if code < 0 {
+				return nil, fmt.Errorf("continueOn.exitCode must not be negative: %d", code)
+			}
+		}
+		step.ContinueOn.ExitCode = def.ContinueOn.ExitCode
 	}
 	if def.RetryPolicy != nil {
+		if _, err := regexp.Compile(def.RetryPolicy.RetryOnOutput); err != nil {
+			return nil, fmt.Errorf("invalid retryOnOutput: %w", err)
+		}
+		if def.RetryPolicy.MaxIntervalSec < 0 || def.RetryPolicy.JitterMaxSec < 0 ||
+			def.RetryPolicy.MaxElapsedSec < 0 {
+			return nil, fmt.Errorf("maxIntervalSec, jitterMaxSec and maxElapsedSec must not be negative")
+		}
+		if def.RetryPolicy.Limit < 0 {
+			return nil, fmt.Errorf("retryPolicy.limit must not be negative: %d",
+				def.RetryPolicy.Limit)
+		}
 		step.RetryPolicy = &RetryPolicy{
-			Limit:    def.RetryPolicy.Limit,
-			Interval: time.Second * time.Duration(def.RetryPolicy.IntervalSec),
+			Limit:              def.RetryPolicy.Limit,
+			Interval:           time.Second * time.Duration(def.RetryPolicy.IntervalSec),
+			MaxInterval:        time.Second * time.Duration(def.RetryPolicy.MaxIntervalSec),
+			JitterMax:          time.Second * time.Duration(def.RetryPolicy.JitterMaxSec),
+			RetryOnOutput:      def.RetryPolicy.RetryOnOutput,
+			ExponentialBackoff: def.RetryPolicy.ExponentialBackoff,
+			MaxElapsed:         time.Second * time.Duration(def.RetryPolicy.MaxElapsedSec),
 		}
 	}
 	if def.RepeatPolicy != nil {
@@ -552,16 +1506,253 @@ func (b *builder) buildStep(variables []string, def *stepDef) (*Step, error) {
 		}
 		step.SignalOnStop = sigDef
 	}
+	if step.Timeout, err = parseStepTimeout(def.Timeout); err != nil {
+		return nil, err
+	}
+	if def.Limits != nil {
+		if def.Limits.MemoryMB < 0 || def.Limits.Nofile < 0 {
+			return nil, fmt.Errorf("limits must not be negative")
+		}
+		step.Limits = &Limits{
+			MemoryMB: def.Limits.MemoryMB,
+			Nofile:   def.Limits.Nofile,
+		}
+	}
 	step.MailOnError = def.MailOnError
+	step.RunAs = def.RunAs
 	step.Preconditions = loadPreCondition(def.Preconditions)
+	if step.OnSuccess, err = b.buildStepHook(step, def.OnSuccess, "onSuccess"); err != nil {
+		return nil, err
+	}
+	if step.OnFailure, err = b.buildStepHook(step, def.OnFailure, "onFailure"); err != nil {
+		return nil, err
+	}
 	return step, nil
 }
 
+// buildStepHook builds the hook of the step. The hook sees the env of
+// the step and is named after the step unless it has its own name.
+func (b *builder) buildStepHook(step *Step, def *stepDef, kind string) (*Step, error) {
+	if def == nil {
+		return nil, nil
+	}
+	if def.OnSuccess != nil || def.OnFailure != nil {
+		return nil, fmt.Errorf("%s of step %s must not have hooks", kind, step.Name)
+	}
+	// the name is set on a copy not to change the definition of the step.
+	hookDef := *def
+	if hookDef.Name == "" {
+		hookDef.Name = fmt.Sprintf("%s.%s", step.Name, kind)
+	}
+	hook, err := b.buildStep(step.Variables, &hookDef)
+	if err != nil {
+		return nil, fmt.Errorf("%s of step %s: %w", kind, step.Name, err)
+	}
+	if hook.ID == "" {
+		hook.ID = hook.Name
+	}
+	return hook, nil
+}
+
+// parseCommandArgv returns the command given as a list of the command and
+// the arguments. The elements must be scalar values.
+func parseCommandArgv(values []interface{}) ([]string, error) {
+	argv := []string{}
+	for _, v := range values {
+		switch t := v.(type) {
+		case string, bool, int, int8, int16, int32, int64,
+			uint, uint8, uint16, uint32, uint64:
+			argv = append(argv, fmt.Sprint(t))
+		case float32:
+			argv = append(argv, strconv.FormatFloat(float64(t), 'f', -1, 32))
+		case float64:
+			// fmt.Sprint formats large floats with an exponent, e.g. 1e+06.
+			argv = append(argv, strconv.FormatFloat(t, 'f', -1, 64))
+		default:
+			return nil, fmt.Errorf("invalid command argument: %v", v)
+		}
+	}
+	if argv[0] == "" {
+		return nil, fmt.Errorf("the command of the list must not be empty")
+	}
+	return argv, nil
+}
+
+// parseStepTimeout parses the timeout of a step, which is either a
+// duration string like "30s" or an integer of seconds.
+func parseStepTimeout(v interface{}) (time.Duration, error) {
+	var ret time.Duration
+	switch t := v.(type) {
+	case nil:
+	case int:
+		ret = time.Second * time.Duration(t)
+	case string:
+		var err error
+		if ret, err = time.ParseDuration(t); err != nil {
+			return 0, fmt.Errorf("invalid timeout: %s", t)
+		}
+	default:
+		return 0, fmt.Errorf("invalid timeout type: %T", v)
+	}
+	if ret < 0 {
+		return 0, fmt.Errorf("timeout must not be negative: %s", ret)
+	}
+	return ret, nil
+}
+
+// loadArgsFile loads the arguments from the JSON or YAML file containing
+// an array of strings. A relative path is resolved from the directory of
+// the DAG file.
+func (b *builder) loadArgsFile(file string) ([]string, error) {
+	file = b.expandEnv(file)
+	if !path.IsAbs(file) && b.file != "" {
+		file = path.Join(path.Dir(b.file), file)
+	}
+	var data []byte
+	var err error
+	if b.fsys != nil {
+		data, err = fs.ReadFile(b.fsys, file)
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read argsFile: %w", err)
+	}
+	var values []interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("argsFile must contain an array of arguments: %w", err)
+	}
+	args := []string{}
+	for _, v := range values {
+		switch vv := v.(type) {
+		case string:
+			args = append(args, b.expandEnv(vv))
+		case int, float64, bool:
+			args = append(args, fmt.Sprint(vv))
+		default:
+			return nil, fmt.Errorf("invalid argument in argsFile: %v", v)
+		}
+	}
+	return args, nil
+}
+
+// renderDescription renders the description as a template with the metadata.
+func renderDescription(description string, meta map[string]string) (string, error) {
+	if !strings.Contains(description, "{{") {
+		return description, nil
+	}
+	tmpl, err := template.New("description").Option("missingkey=error").Parse(description)
+	if err != nil {
+		return "", fmt.Errorf("invalid description template: %w", err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, struct{ Meta map[string]string }{Meta: meta})
+	if err != nil {
+		return "", fmt.Errorf("failed to render description: %w", err)
+	}
+	return buf.String(), nil
+}
+
+func (b *builder) buildStepDir(step *Step, dir interface{}) error {
+	switch v := dir.(type) {
+	case nil:
+	case string:
+		step.Dir = b.expandEnv(v)
+	case map[interface{}]interface{}:
+		for k, vv := range v {
+			switch k {
+			case "path":
+				p, ok := vv.(string)
+				if !ok {
+					return fmt.Errorf("dir path must be a string")
+				}
+				step.Dir = b.expandEnv(p)
+			case "create":
+				c, ok := vv.(bool)
+				if !ok {
+					return fmt.Errorf("dir create must be a boolean")
+				}
+				step.CreateDir = c
+			default:
+				return fmt.Errorf("dir key must be path or create")
+			}
+		}
+	default:
+		return fmt.Errorf("invalid dir type: %T", dir)
+	}
+	return nil
+}
+
+// outputNameRegexp is the pattern of the output variable names, which
+// must be valid environment variable names.
+var outputNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// buildStepOutput sets the output options of the step. The output is
+// either the variable name or a map with name, encoding, maxBytes, and
+// alertOnChange.
+func buildStepOutput(step *Step, output interface{}) error {
+	switch v := output.(type) {
+	case nil:
+	case string:
+		step.Output = v
+	case map[interface{}]interface{}:
+		for k, vv := range v {
+			switch k {
+			case "name":
+				n, ok := vv.(string)
+				if !ok {
+					return fmt.Errorf("output name must be a string")
+				}
+				step.Output = n
+			case "encoding":
+				e, ok := vv.(string)
+				if !ok || e != OutputEncodingBase64 {
+					return fmt.Errorf("output encoding must be %s", OutputEncodingBase64)
+				}
+				step.OutputEncoding = e
+			case "maxBytes":
+				m, ok := vv.(int)
+				if !ok || m < 0 {
+					return fmt.Errorf("output maxBytes must be a non-negative integer")
+				}
+				step.OutputMaxBytes = m
+			case "alertOnChange":
+				a, ok := vv.(bool)
+				if !ok {
+					return fmt.Errorf("output alertOnChange must be a boolean")
+				}
+				step.OutputAlertOnChange = a
+			default:
+				return fmt.Errorf("output key must be name, encoding, maxBytes, or alertOnChange")
+			}
+		}
+		if step.Output == "" {
+			return fmt.Errorf("output name must be specified")
+		}
+	default:
+		return fmt.Errorf("invalid output type: %T", output)
+	}
+	if step.Output != "" && !outputNameRegexp.MatchString(step.Output) {
+		return fmt.Errorf("invalid output name: %s", step.Output)
+	}
+	return nil
+}
+
 func (b *builder) expandEnv(val string) string {
 	if b.noEval {
 		return val
 	}
-	return os.ExpandEnv(val)
+	return b.env.Expand(val)
+}
+
+// parseVariable expands the variables with the build environment
+// and substitutes commands in the value. The commands are not run and
+// kept as they are if noEval is set.
+func (b *builder) parseVariable(val string) (string, error) {
+	if b.noEval {
+		return b.env.Expand(val), nil
+	}
+	return utils.ParseCommand(b.env.Expand(val))
 }
 
 func buildSmtpConfigFromDefinition(def *configDefinition, d *DAG) (err error) {
@@ -572,39 +1763,42 @@ func buildSmtpConfigFromDefinition(def *configDefinition, d *DAG) (err error) {
 	return nil
 }
 
-func buildErrorMailConfig(def *configDefinition, d *DAG) (err error) {
-	d.ErrorMail, err = buildMailConfigFromDefinition(def.ErrorMail)
+func (b *builder) buildErrorMailConfig(def *configDefinition, d *DAG) (err error) {
+	d.ErrorMail, err = b.buildMailConfigFromDefinition(def.ErrorMail)
 	return
 }
 
-func buildInfoMailConfig(def *configDefinition, d *DAG) (err error) {
-	d.InfoMail, err = buildMailConfigFromDefinition(def.InfoMail)
+func (b *builder) buildInfoMailConfig(def *configDefinition, d *DAG) (err error) {
+	d.InfoMail, err = b.buildMailConfigFromDefinition(def.InfoMail)
 	return
 }
 
-func buildMailConfigFromDefinition(def mailConfigDef) (*MailConfig, error) {
+func (b *builder) buildMailConfigFromDefinition(def mailConfigDef) (*MailConfig, error) {
 	d := &MailConfig{}
-	d.From = def.From
-	d.To = def.To
+	d.From = b.expandEnv(def.From)
+	d.To = b.expandEnv(def.To)
 	d.Prefix = def.Prefix
-	return d, nil
-}
-
-func buildConfigEnv(vars map[string]string) []string {
-	ret := []string{}
-	for k, v := range vars {
-		ret = append(ret, fmt.Sprintf("%s=%s", k, v))
+	if def.To != "" && strings.TrimSpace(d.To) == "" {
+		return nil, fmt.Errorf("no recipients: %s expanded to empty", def.To)
 	}
-	return ret
+	return d, nil
 }
 
 func loadPreCondition(cond []*conditionDef) []*Condition {
 	ret := []*Condition{}
 	for _, v := range cond {
-		ret = append(ret, &Condition{
+		c := &Condition{
 			Condition: v.Condition,
 			Expected:  v.Expected,
-		})
+			Shell:     v.Shell,
+		}
+		if v.Disk != nil {
+			c.Disk = &DiskCondition{
+				Path:      v.Disk.Path,
+				MinFreeGB: v.Disk.MinFreeGB,
+			}
+		}
+		ret = append(ret, c)
 	}
 	return ret
 }
@@ -621,10 +1815,25 @@ func parseTags(value string) []string {
 	return ret
 }
 
-func parseSchedule(values []string) ([]*Schedule, error) {
+func parseSchedule(parser cron.Parser, values []string) ([]*Schedule, error) {
 	ret := []*Schedule{}
 	for _, v := range values {
-		paresed, err := cronParser.Parse(v)
+		var loc *time.Location
+		if tz, _, ok := cutTimeZone(v); ok {
+			var err error
+			if loc, err = time.LoadLocation(tz); err != nil {
+				return nil, fmt.Errorf("invalid timezone %s in schedule %s", tz, v)
+			}
+		}
+		_, expr, _ := cutTimeZone(v)
+		if every, ok, err := parseEvery(expr, loc); ok {
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, &Schedule{Expression: v, Parsed: every})
+			continue
+		}
+		paresed, err := parser.Parse(v)
 		if err != nil {
 			return nil, fmt.Errorf("invalid schedule: %s", err)
 		}
@@ -636,6 +1845,27 @@ func parseSchedule(values []string) ([]*Schedule, error) {
 	return ret, nil
 }
 
+// parseAtTime converts a daily time of the form "HH:MM" into the
+// equivalent cron expression in the timezone. The expression has the
+// seconds field if withSeconds is true.
+func parseAtTime(value, tz string, withSeconds bool) (string, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return "", fmt.Errorf("invalid schedule at: %s", value)
+	}
+	expr := fmt.Sprintf("%d %d * * *", t.Minute(), t.Hour())
+	if withSeconds {
+		expr = "0 " + expr
+	}
+	if tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil {
+			return "", fmt.Errorf("invalid schedule tz: %s", tz)
+		}
+		expr = fmt.Sprintf("CRON_TZ=%s %s", tz, expr)
+	}
+	return expr, nil
+}
+
 func assertDef(def *configDefinition) error {
 	if len(def.Steps) == 0 {
 		return fmt.Errorf("at least one step must be specified")
@@ -647,8 +1877,17 @@ func assertStepDef(def *stepDef) error {
 	if def.Name == "" {
 		return fmt.Errorf("step name must be specified")
 	}
-	if def.Command == "" {
+	switch cmd := def.Command.(type) {
+	case nil:
 		return fmt.Errorf("step command must be specified")
+	case string:
+		if cmd == "" {
+			return fmt.Errorf("step command must be specified")
+		}
+	case []interface{}:
+		if len(cmd) == 0 {
+			return fmt.Errorf("step command must be specified")
+		}
 	}
 	return nil
 }
@@ -1,14 +1,19 @@
 package dag
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/yohamta/dagu/internal/settings"
 	"github.com/yohamta/dagu/internal/utils"
+	"gopkg.in/yaml.v2"
 )
 
 var (
@@ -54,6 +59,30 @@ func TestConfigReadClone(t *testing.T) {
 	require.Equal(t, d, dd)
 }
 
+func TestCloneFresh(t *testing.T) {
+	l := &Loader{}
+	file := path.Join(testdataDir, "clone_fresh.yaml")
+
+	orig, err := l.Load(file, "")
+	require.NoError(t, err)
+
+	d, err := l.Load(file, "NAME=runtime")
+	require.NoError(t, err)
+	require.Equal(t, "NAME=runtime", d.RuntimeParams)
+	require.Equal(t, []string{"NAME=runtime"}, d.Params)
+	require.Contains(t, d.Env, "NAME=runtime")
+
+	fresh := d.CloneFresh()
+	require.Equal(t, "", fresh.RuntimeParams)
+	require.Equal(t, orig.Params, fresh.Params)
+	require.Equal(t, orig.Env, fresh.Env)
+	require.Equal(t, orig.DefaultParams, fresh.DefaultParams)
+	require.Equal(t, orig.Steps, fresh.Steps)
+
+	// the original DAG is not modified
+	require.Equal(t, []string{"NAME=runtime"}, d.Params)
+}
+
 func TestToString(t *testing.T) {
 	l := &Loader{}
 
@@ -62,6 +91,38 @@ func TestToString(t *testing.T) {
 
 	ret := d.String()
 	require.Contains(t, ret, "Name: default")
+
+	registerSecretValue("s3cr3t-string-test")
+	d = &DAG{
+		Name:   "test",
+		Params: []string{"1=x", "NAME=y"},
+		Env:    []string{"FOO=bar", "TOKEN=s3cr3t-string-test"},
+	}
+	ret = d.String()
+	require.Contains(t, ret, "Name: test")
+	require.Contains(t, ret, "Params: 1=x, NAME=y")
+	require.Contains(t, ret, "Env: FOO=bar, TOKEN=*****")
+	require.NotContains(t, ret, "s3cr3t-string-test")
+
+	// a multi-line description
+	file := path.Join(t.TempDir(), "description.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(`description: |
+  Daily report.
+  Sends the summary to the team.
+steps:
+  - name: "1"
+    command: "true"
+`), 0644))
+	description := "Daily report.\nSends the summary to the team."
+	d, err = l.Load(file, "")
+	require.NoError(t, err)
+	require.Contains(t, d.String(), "Description: "+description)
+	require.Equal(t, d.Description, d.Clone().Description)
+
+	d, err = l.LoadHeadOnly(file)
+	require.NoError(t, err)
+	require.Equal(t, description+"\n", d.Description)
+	require.Contains(t, d.String(), "Description: "+description)
 }
 
 func TestReadConfig(t *testing.T) {
@@ -91,6 +152,18 @@ func TestConfigLoadHeadOnly(t *testing.T) {
 
 	require.Equal(t, d.Name, "default")
 	require.True(t, len(d.Steps) == 0)
+
+	// the variables are not evaluated
+	d, err = l.LoadHeadOnly(path.Join(testdataDir, "head_only.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, "head_only", d.Name)
+	require.Equal(t, "report of `date`", d.Description)
+	require.Equal(t, []string{"daily", "report"}, d.Tags)
+	require.Empty(t, d.Env)
+	require.Empty(t, d.Params)
+
+	_, err = l.Load(path.Join(testdataDir, "head_only.yaml"), "")
+	require.Error(t, err)
 }
 
 func TestLoadInvalidConfigError(t *testing.T) {
@@ -152,8 +225,42 @@ func TestLoadEnv(t *testing.T) {
 		_, err = b.buildFromDefinition(def, nil)
 		require.NoError(t, err)
 
-		require.Equal(t, c.want, os.Getenv(c.key))
+		v, ok := b.env.Lookup(c.key)
+		require.True(t, ok)
+		require.Equal(t, c.want, v)
+	}
+}
+
+func TestLoadLargeEnv(t *testing.T) {
+	const n = 10000
+	d, err := (&Loader{}).LoadData(largeEnvData(n))
+	require.NoError(t, err)
+	require.Len(t, d.Env, n+1)
+	require.Equal(t, "VAR_0=0", d.Env[0])
+	require.Equal(t, fmt.Sprintf("VAR_%d=0:%d", n-1, n-1), d.Env[n-1])
+	require.Equal(t, fmt.Sprintf("LAST=0:%d", n-1), d.Env[n])
+}
+
+func BenchmarkLoadLargeEnv(b *testing.B) {
+	data := largeEnvData(10000)
+	for i := 0; i < b.N; i++ {
+		if _, err := (&Loader{}).LoadData(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// largeEnvData returns a DAG with n env entries that refer to the
+// first one, followed by one that refers to the last of them.
+func largeEnvData(n int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("env:\n  - VAR_0: \"0\"\n")
+	for i := 1; i < n; i++ {
+		fmt.Fprintf(&buf, "  - VAR_%d: \"${VAR_0}:%d\"\n", i, i)
 	}
+	fmt.Fprintf(&buf, "  - LAST: \"${VAR_%d}\"\n", n-1)
+	buf.WriteString("steps:\n  - name: \"1\"\n    command: \"true\"\n")
+	return buf.Bytes()
 }
 
 func TestParseParameter(t *testing.T) {
@@ -190,6 +297,21 @@ func TestParseParameter(t *testing.T) {
 				"2": "x",
 			},
 		},
+		{
+			Params: "x yy zzz",
+			Want: map[string]string{
+				"@": "x yy zzz",
+				"#": "3",
+			},
+		},
+		{
+			Params: "a \"b c\" D=$#:$@",
+			Want: map[string]string{
+				"@": "a b c D=2:a b c",
+				"#": "3",
+				"D": "2:a b c",
+			},
+		},
 		{
 			Params: "first P1=foo P2=${FOO} P3=`/bin/echo ${P2}` X=bar Y=${P1} Z=\"A B C\"",
 			Env:    "FOO: BAR",
@@ -209,6 +331,24 @@ func TestParseParameter(t *testing.T) {
 				"7":  "Z=A B C",
 			},
 		},
+		{
+			Params: "A=${FOO} B=${A}-b C=`/bin/echo ${B}-c` D=$C-d",
+			Env:    "FOO: a",
+			Want: map[string]string{
+				"A": "a",
+				"B": "a-b",
+				"C": "a-b-c",
+				"D": "a-b-c-d",
+				"4": "D=a-b-c-d",
+			},
+		},
+		{
+			Params: "X=${NOT_YET_DEFINED} NOT_YET_DEFINED=y",
+			Want: map[string]string{
+				"X":               "",
+				"NOT_YET_DEFINED": "y",
+			},
+		},
 	} {
 		l := &Loader{}
 		d, err := l.unmarshalData([]byte(fmt.Sprintf(`
@@ -226,11 +366,94 @@ params: %s
 		require.NoError(t, err)
 
 		for k, v := range test.Want {
-			require.Equal(t, v, os.Getenv(k))
+			vv, ok := b.env.Lookup(k)
+			require.True(t, ok)
+			require.Equal(t, v, vv)
 		}
 	}
 }
 
+func TestParseParameterMap(t *testing.T) {
+	l := &Loader{}
+	build := func(dat string) (*DAG, *builder, error) {
+		m, err := l.unmarshalData([]byte(dat))
+		require.NoError(t, err)
+		def, err := l.decode(m)
+		require.NoError(t, err)
+		b := &builder{}
+		d, err := b.buildFromDefinition(def, nil)
+		return d, b, err
+	}
+
+	d, b, err := build(`
+env:
+  - FOO: foo
+params:
+  NAME: ${FOO}-x
+  QUOTED: 'a "b" c'
+  NUM: 1
+  EMPTY:
+`)
+	require.NoError(t, err)
+	require.Equal(t, `EMPTY="" NAME="${FOO}-x" NUM="1" QUOTED="a \"b\" c"`, d.DefaultParams)
+	for k, v := range map[string]string{
+		"NAME":   "foo-x",
+		"QUOTED": `a "b" c`,
+		"NUM":    "1",
+		"EMPTY":  "",
+		"1":      "EMPTY=",
+		"#":      "4",
+	} {
+		vv, ok := b.env.Lookup(k)
+		require.True(t, ok, k)
+		require.Equal(t, v, vv, k)
+	}
+	require.Contains(t, d.Env, "NAME=foo-x")
+
+	d, _, err = build(`params: x NAME=y`)
+	require.NoError(t, err)
+	require.Equal(t, []string{"x", "NAME=y"}, d.Params)
+
+	_, _, err = build(`params: [x, y]`)
+	require.Error(t, err)
+}
+
+func TestEnvParamsPrecedence(t *testing.T) {
+	for _, test := range []struct {
+		EnvOverridesParams bool
+		Want               string
+	}{
+		{EnvOverridesParams: false, Want: "from_params"},
+		{EnvOverridesParams: true, Want: "from_env"},
+	} {
+		l := &Loader{}
+		m, err := l.unmarshalData([]byte(fmt.Sprintf(`
+env:
+  - SHARED_NAME: from_env
+params: SHARED_NAME=from_params OTHER=${SHARED_NAME}
+envOverridesParams: %v
+`, test.EnvOverridesParams)))
+		require.NoError(t, err)
+
+		def, err := l.decode(m)
+		require.NoError(t, err)
+
+		b := &builder{}
+		d, err := b.buildFromDefinition(def, nil)
+		require.NoError(t, err)
+		require.Equal(t, test.EnvOverridesParams, d.EnvOverridesParams)
+
+		v, _ := b.env.Lookup("SHARED_NAME")
+		require.Equal(t, test.Want, v)
+		v, _ = b.env.Lookup("OTHER")
+		require.Equal(t, test.Want, v)
+
+		// the DAG env has the value that takes precedence
+		require.Contains(t, d.Env, "SHARED_NAME="+test.Want)
+		require.Equal(t, []string{"SHARED_NAME=from_params", "OTHER=" + test.Want}, d.Params)
+	}
+}
+
 func TestExpandEnv(t *testing.T) {
 	b := &builder{}
 	os.Setenv("FOO", "BAR")
@@ -262,6 +485,41 @@ tags: %s
 	require.False(t, d.HasTag("weekly"))
 }
 
+func TestLoadMetadata(t *testing.T) {
+	l := &Loader{}
+	d, err := l.LoadMetadata(path.Join(testdataDir, "metadata"))
+	require.NoError(t, err)
+	require.Equal(t, "metadata", d.Name)
+	require.Equal(t, "report of `date`", d.Description)
+	require.Equal(t, []string{"daily", "report"}, d.Tags)
+	require.Len(t, d.Schedule, 2)
+	require.Len(t, d.StopSchedule, 1)
+	require.Empty(t, d.Steps)
+	require.Empty(t, d.Env)
+	require.Empty(t, d.Params)
+
+	_, err = l.LoadMetadata(path.Join(testdataDir, "not_existing.yaml"))
+	require.Error(t, err)
+}
+
+func BenchmarkLoadMetadata(b *testing.B) {
+	f := path.Join(testdataDir, "metadata.yaml")
+	for i := 0; i < b.N; i++ {
+		if _, err := (&Loader{}).LoadMetadata(f); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLoadHeadOnly(b *testing.B) {
+	f := path.Join(testdataDir, "metadata.yaml")
+	for i := 0; i < b.N; i++ {
+		if _, err := (&Loader{}).LoadHeadOnly(f); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func TestSchedule(t *testing.T) {
 	for _, tc := range []struct {
 		Name string
@@ -288,6 +546,31 @@ func TestSchedule(t *testing.T) {
   - "* * * * *"`,
 			Err: true,
 		},
+		{
+			Name: "daily descriptor",
+			Def:  "schedule: \"@daily\"",
+			Want: 1,
+		},
+		{
+			Name: "every descriptor",
+			Def:  "schedule: \"@every 10m\"",
+			Want: 1,
+		},
+		{
+			Name: "invalid descriptor",
+			Def:  "schedule: \"@every 10x\"",
+			Err:  true,
+		},
+		{
+			Name: "too short interval",
+			Def:  "schedule: \"@every 100ms\"",
+			Err:  true,
+		},
+		{
+			Name: "unknown descriptor",
+			Def:  "schedule: \"@fortnightly\"",
+			Err:  true,
+		},
 	} {
 		t.Run(tc.Name, func(t *testing.T) {
 			l := &Loader{}
@@ -310,6 +593,262 @@ func TestSchedule(t *testing.T) {
 	}
 }
 
+func TestScheduleDescriptor(t *testing.T) {
+	now := time.Date(2022, 1, 1, 9, 15, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		Expr string
+		Next time.Time
+	}{
+		{"@daily", time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)},
+		{"@every 10m", time.Date(2022, 1, 1, 9, 20, 0, 0, time.UTC)},
+		{"@every 1h30m", time.Date(2022, 1, 1, 10, 30, 0, 0, time.UTC)},
+	} {
+		d, err := (&Loader{}).LoadData([]byte(fmt.Sprintf(`schedule: "%s"
+steps:
+  - name: "1"
+    command: "true"
+`, tc.Expr)))
+		require.NoError(t, err)
+		require.Len(t, d.Schedule, 1)
+		require.Equal(t, tc.Expr, d.Schedule[0].Expression)
+		require.Equal(t, tc.Next, d.Schedule[0].Parsed.Next(now))
+	}
+
+	// the next time of @every doesn't move when it's asked again
+	d, err := (&Loader{}).LoadData([]byte(`schedule: "@every 10m"
+steps:
+  - name: "1"
+    command: "true"
+`))
+	require.NoError(t, err)
+	next := d.Schedule[0].Parsed.Next(now)
+	require.Equal(t, next, d.Schedule[0].Parsed.Next(now.Add(time.Minute)))
+	require.Equal(t, now.Add(-time.Minute*5), d.Schedule[0].Prev(now))
+
+	// the multiples are aligned to the wall clock of the time zone
+	d, err = (&Loader{}).LoadData([]byte(`schedule: "CRON_TZ=Asia/Kolkata @every 1h"
+steps:
+  - name: "1"
+    command: "true"
+`))
+	require.NoError(t, err)
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	require.NoError(t, err)
+	next = d.Schedule[0].Parsed.Next(now)
+	require.True(t, time.Date(2022, 1, 1, 15, 0, 0, 0, kolkata).Equal(next), next)
+	require.Equal(t, 0, next.In(kolkata).Minute())
+}
+
+func TestScheduleAt(t *testing.T) {
+	l := &Loader{}
+	m, err := l.unmarshalData([]byte(`schedule:
+  at: ["09:00", "13:30", "17:45"]
+  tz: Asia/Tokyo
+`))
+	require.NoError(t, err)
+
+	def, err := l.decode(m)
+	require.NoError(t, err)
+
+	d, err := (&builder{}).buildFromDefinition(def, nil)
+	require.NoError(t, err)
+	require.Len(t, d.Schedule, 3)
+
+	loc, err := time.LoadLocation("Asia/Tokyo")
+	require.NoError(t, err)
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, loc)
+	next := []time.Time{}
+	for _, s := range d.Schedule {
+		next = append(next, s.Parsed.Next(now).In(loc))
+	}
+	require.Equal(t, []time.Time{
+		time.Date(2022, 1, 1, 9, 0, 0, 0, loc),
+		time.Date(2022, 1, 1, 13, 30, 0, 0, loc),
+		time.Date(2022, 1, 1, 17, 45, 0, 0, loc),
+	}, next)
+
+	for _, dat := range []string{
+		"schedule:\n  at: \"25:00\"",
+		"schedule:\n  at: \"09:00\"\n  tz: Invalid/Zone",
+	} {
+		m, err := l.unmarshalData([]byte(dat))
+		require.NoError(t, err)
+		def, err := l.decode(m)
+		require.NoError(t, err)
+		_, err = (&builder{}).buildFromDefinition(def, nil)
+		require.Error(t, err)
+	}
+}
+
+func TestScheduleTimeZone(t *testing.T) {
+	l := &Loader{}
+	build := func(dat string) (*DAG, error) {
+		m, err := l.unmarshalData([]byte(dat))
+		require.NoError(t, err)
+		def, err := l.decode(m)
+		require.NoError(t, err)
+		return (&builder{}).buildFromDefinition(def, nil)
+	}
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	want := time.Date(2022, 1, 1, 9, 0, 0, 0, loc)
+
+	// inline CRON_TZ= prefix
+	d, err := build(`schedule: "CRON_TZ=America/New_York 0 9 * * *"`)
+	require.NoError(t, err)
+	require.Equal(t, loc.String(), d.TimeZone.String())
+	require.True(t, want.Equal(d.Schedule[0].Parsed.Next(now)))
+
+	// schedule.tz field
+	d, err = build(`schedule:
+  start: "0 9 * * *"
+  stop: "0 18 * * *"
+  tz: America/New_York
+`)
+	require.NoError(t, err)
+	require.Equal(t, loc.String(), d.TimeZone.String())
+	require.True(t, want.Equal(d.Schedule[0].Parsed.Next(now)))
+	require.True(t, time.Date(2022, 1, 1, 18, 0, 0, 0, loc).Equal(d.StopSchedule[0].Parsed.Next(now)))
+
+	// the local time
+	d, err = build(`schedule: "0 9 * * *"`)
+	require.NoError(t, err)
+	require.Nil(t, d.TimeZone)
+
+	for _, dat := range []string{
+		`schedule: "CRON_TZ=Invalid/Zone 0 9 * * *"`,
+		"schedule:\n  start: \"0 9 * * *\"\n  tz: Invalid/Zone",
+	} {
+		_, err := build(dat)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "Invalid/Zone")
+	}
+}
+
+func TestSkipIfSuccessful(t *testing.T) {
+	l := &Loader{}
+	d, err := l.LoadData([]byte(`schedule: "0 * * * *"
+skipIfSuccessful: true
+steps:
+  - name: "1"
+    command: "true"
+`))
+	require.NoError(t, err)
+	require.True(t, d.SkipIfSuccessful)
+	require.True(t, d.Clone().SkipIfSuccessful)
+	require.Contains(t, d.String(), "SkipIfSuccessful: true")
+
+	d, err = l.LoadData([]byte(`steps:
+  - name: "1"
+    command: "true"
+`))
+	require.NoError(t, err)
+	require.False(t, d.SkipIfSuccessful)
+}
+
+func TestScheduleBusinessDay(t *testing.T) {
+	l := &Loader{}
+	m, err := l.unmarshalData([]byte(`schedule:
+  businessDay: 3
+  time: "08:00"
+  holidays: ["2022-07-04"]
+`))
+	require.NoError(t, err)
+
+	def, err := l.decode(m)
+	require.NoError(t, err)
+
+	d, err := (&builder{}).buildFromDefinition(def, nil)
+	require.NoError(t, err)
+	require.Len(t, d.Schedule, 1)
+
+	now := time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)
+	require.Equal(t, time.Date(2022, 7, 6, 8, 0, 0, 0, time.UTC),
+		d.Schedule[0].Parsed.Next(now))
+
+	// round trip
+	out, err := yaml.Marshal(d.toDefinition())
+	require.NoError(t, err)
+	m, err = l.unmarshalData(out)
+	require.NoError(t, err)
+	def, err = l.decode(m)
+	require.NoError(t, err)
+	d2, err := (&builder{}).buildFromDefinition(def, nil)
+	require.NoError(t, err)
+	require.Equal(t, d.Schedule[0].Parsed, d2.Schedule[0].Parsed)
+
+	m, err = l.unmarshalData([]byte("schedule:\n  businessDay: 30"))
+	require.NoError(t, err)
+	def, err = l.decode(m)
+	require.NoError(t, err)
+	_, err = (&builder{}).buildFromDefinition(def, nil)
+	require.Error(t, err)
+}
+
+func TestScheduleJitter(t *testing.T) {
+	l := &Loader{}
+	d, err := l.LoadData([]byte(`schedule:
+  cron: "0 * * * *"
+  jitterSec: 120
+steps:
+  - name: "1"
+    command: "true"
+`))
+	require.NoError(t, err)
+	require.Len(t, d.Schedule, 1)
+	require.Equal(t, "0 * * * *", d.Schedule[0].Expression)
+	require.Equal(t, time.Second*120, d.Schedule[0].Jitter)
+
+	_, err = l.LoadData([]byte(`schedule:
+  cron: "0 * * * *"
+  jitterSec: -1
+steps:
+  - name: "1"
+    command: "true"
+`))
+	require.Error(t, err)
+}
+
+func TestScheduleEnableSeconds(t *testing.T) {
+	l := &Loader{}
+	d, err := l.LoadData([]byte(`enableSeconds: true
+schedule: "*/30 * * * * *"
+steps:
+  - name: "1"
+    command: "true"
+`))
+	require.NoError(t, err)
+	require.Len(t, d.Schedule, 1)
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	next := d.Schedule[0].Parsed.Next(now)
+	require.Equal(t, now.Add(time.Second*30), next)
+	require.Equal(t, next.Add(time.Second*30), d.Schedule[0].Parsed.Next(next))
+
+	// 6-field expression is invalid by default
+	_, err = l.LoadData([]byte(`schedule: "*/30 * * * * *"
+steps:
+  - name: "1"
+    command: "true"
+`))
+	require.Error(t, err)
+
+	// at times with the seconds field
+	d, err = l.LoadData([]byte(`enableSeconds: true
+schedule:
+  at: ["09:00"]
+steps:
+  - name: "1"
+    command: "true"
+`))
+	require.NoError(t, err)
+	require.Len(t, d.Schedule, 1)
+	require.Equal(t, time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC),
+		d.Schedule[0].Parsed.Next(now))
+}
+
 func TestScheduleStop(t *testing.T) {
 	for _, tc := range []struct {
 		Name        string
@@ -426,3 +965,455 @@ func TestOverwriteGlobalConfig(t *testing.T) {
 	require.Equal(t, &MailOn{Failure: true, Success: false}, d.MailOn)
 	require.Equal(t, d.HistRetentionDays, 30)
 }
+
+func TestHistRetentionDays(t *testing.T) {
+	base := `histRetentionDays: 3
+`
+	l := &Loader{}
+	for _, tc := range []struct {
+		Value string
+		Want  int
+	}{
+		{Value: "0", Want: 0},
+		{Value: "-1", Want: HistRetentionForever},
+		{Value: "5", Want: 5},
+	} {
+		d, err := l.LoadString(`histRetentionDays: `+tc.Value+`
+steps:
+  - name: "1"
+    command: "true"
+`, base)
+		require.NoError(t, err)
+		require.Equal(t, tc.Want, d.HistRetentionDays)
+	}
+
+	m, err := l.unmarshalData([]byte(`histRetentionDays: -2
+steps:
+  - name: "1"
+    command: "true"
+`))
+	require.NoError(t, err)
+	def, err := l.decode(m)
+	require.NoError(t, err)
+	_, err = (&builder{}).buildFromDefinition(def, nil)
+	require.Error(t, err)
+}
+
+func TestMaxActiveRuns(t *testing.T) {
+	l := &Loader{}
+	d, err := l.LoadData([]byte(`steps:
+  - name: "1"
+    command: "true"
+`))
+	require.NoError(t, err)
+	require.Equal(t, 0, d.MaxActiveRuns)
+	require.Nil(t, d.toDefinition().MaxActiveRuns)
+
+	d, err = l.LoadData([]byte(`maxActiveRuns: 2
+steps:
+  - name: "1"
+    command: "true"
+`))
+	require.NoError(t, err)
+	require.Equal(t, 2, d.MaxActiveRuns)
+	require.Equal(t, 2, d.Clone().MaxActiveRuns)
+	require.Equal(t, 2, *d.toDefinition().MaxActiveRuns)
+
+	for _, v := range []string{"0", "-1"} {
+		_, err := l.LoadData([]byte(`maxActiveRuns: ` + v + `
+steps:
+  - name: "1"
+    command: "true"
+`))
+		require.Error(t, err, v)
+	}
+}
+
+func TestLoadStringWithBaseConfig(t *testing.T) {
+	base := `histRetentionDays: 3
+mailOn:
+  failure: true
+  retry: true
+`
+	l := &Loader{}
+
+	d, err := l.LoadString(`histRetentionDays: 7
+mailOn:
+  failure: false
+steps:
+  - name: "1"
+    command: "true"
+`, base)
+	require.NoError(t, err)
+	require.Equal(t, &MailOn{Failure: false, Success: false}, d.MailOn)
+	require.Equal(t, 7, d.HistRetentionDays)
+
+	d, err = l.LoadString(`steps:
+  - name: "1"
+    command: "true"
+`, base)
+	require.NoError(t, err)
+	require.Equal(t, &MailOn{Failure: true, Success: false, Retry: true}, d.MailOn)
+	require.Equal(t, 3, d.HistRetentionDays)
+
+	cloned := d.Clone()
+	require.Equal(t, d.MailOn, cloned.MailOn)
+	cloned.MailOn.Retry = false
+	require.True(t, d.MailOn.Retry)
+
+	_, err = l.LoadString(`steps:
+  - name: "1"
+    command: "true"
+`, "invalidkey: test")
+	require.Error(t, err)
+
+	// the variables are evaluated unless NoEval is set
+	dat := "env:\n  - GREETING: \"`echo hello`\"\nsteps:\n  - name: \"1\"\n    command: \"true\"\n"
+	d, err = l.LoadString(dat, base)
+	require.NoError(t, err)
+	require.Contains(t, d.Env, "GREETING=hello")
+
+	d, err = (&Loader{NoEval: true}).LoadString(dat, base)
+	require.NoError(t, err)
+	require.Contains(t, d.Env, "GREETING=`echo hello`")
+}
+
+func TestMarshalMermaid(t *testing.T) {
+	dat := `steps:
+  - name: "1"
+    command: "true"
+  - name: "step \"2\""
+    command: "true"
+    depends: ["1"]
+  - name: "3"
+    command: "true"
+    depends: ["1", "step \"2\""]
+`
+	l := &Loader{}
+	d, err := l.LoadData([]byte(dat))
+	require.NoError(t, err)
+
+	ret := d.MarshalMermaid()
+	require.True(t, strings.HasPrefix(ret, "graph TD\n"))
+	require.Contains(t, ret, `step0["1"]`)
+	require.Contains(t, ret, `step1["step #quot;2#quot;"]`)
+	require.Contains(t, ret, `step2["3"]`)
+	require.Contains(t, ret, "step0 --> step1")
+	require.Contains(t, ret, "step0 --> step2")
+	require.Contains(t, ret, "step1 --> step2")
+}
+
+func TestMarshalDOT(t *testing.T) {
+	dat := `name: test
+handlerOn:
+  exit:
+    command: "true"
+steps:
+  - name: "1"
+    command: "true"
+  - name: "step \"2\""
+    command: "true"
+    depends: ["1"]
+`
+	l := &Loader{}
+	d, err := l.LoadData([]byte(dat))
+	require.NoError(t, err)
+
+	ret := d.MarshalDOT()
+	require.True(t, strings.HasPrefix(ret, "digraph \"test\" {\n"))
+	require.True(t, strings.HasSuffix(ret, "}\n"))
+	require.Contains(t, ret, `step0 [label="1"];`)
+	require.Contains(t, ret, `step1 [label="step \"2\""];`)
+	require.Contains(t, ret, `onExit [label="onExit", style=filled, fillcolor=lightgrey];`)
+	require.Contains(t, ret, "step0 -> step1;")
+}
+
+func TestWalkSteps(t *testing.T) {
+	dat := `handlerOn:
+  exit:
+    command: "true"
+  failure:
+    command: "true"
+steps:
+  - name: "1"
+    command: "true"
+  - name: "2"
+    command: "true"
+`
+	l := &Loader{}
+	d, err := l.LoadData([]byte(dat))
+	require.NoError(t, err)
+
+	names := []string{}
+	err = d.WalkSteps(func(s *Step) error {
+		names = append(names, s.Name)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", "2", "onExit", "onFailure"}, names)
+
+	count := 0
+	err = d.WalkSteps(func(s *Step) error {
+		count++
+		return fmt.Errorf("stop")
+	})
+	require.Error(t, err)
+	require.Equal(t, 1, count)
+}
+
+func TestToDefinition(t *testing.T) {
+	dat := `name: round-trip
+description: test
+schedule:
+  start: "0 1 * * *"
+  stop: "0 2 * * *"
+env:
+  - LOG_DIR: /tmp/logs
+logDir: ${LOG_DIR}
+params: first P1=foo
+tags: a,b
+histRetentionDays: 3
+mailOn:
+  failure: true
+handlerOn:
+  exit:
+    command: "echo exit"
+preconditions:
+  - condition: "a"
+    expected: "a"
+steps:
+  - name: "1"
+    command: "echo 1"
+    retryPolicy:
+      limit: 2
+      intervalSec: 5
+    signalOnStop: SIGINT
+  - name: "2"
+    command: "echo 2"
+    depends: ["1"]
+    continueOn:
+      failure: true
+      exitCode: [1, 2]
+`
+	l := &Loader{}
+	orig, err := l.LoadData([]byte(dat))
+	require.NoError(t, err)
+
+	def := orig.toDefinition()
+	out, err := yaml.Marshal(def)
+	require.NoError(t, err)
+
+	ret, err := l.LoadData(out)
+	require.NoError(t, err)
+	require.Equal(t, orig, ret)
+
+	// modify and re-save
+	def.Description = "modified"
+	out, err = yaml.Marshal(def)
+	require.NoError(t, err)
+
+	ret, err = l.LoadData(out)
+	require.NoError(t, err)
+	require.Equal(t, "modified", ret.Description)
+}
+
+func TestMailRecipientsEnv(t *testing.T) {
+	os.Setenv("ONCALL_EMAIL", "oncall@example.com")
+	defer os.Unsetenv("ONCALL_EMAIL")
+
+	l := &Loader{}
+	build := func(dat string) (*DAG, error) {
+		m, err := l.unmarshalData([]byte(dat))
+		require.NoError(t, err)
+		def, err := l.decode(m)
+		require.NoError(t, err)
+		return (&builder{}).buildFromDefinition(def, nil)
+	}
+
+	d, err := build(`mailOn:
+  failure: true
+errorMail:
+  to: "${ONCALL_EMAIL}"
+infoMail:
+  to: "${REPORT_EMAIL}"
+env:
+  - REPORT_EMAIL: report@example.com
+`)
+	require.NoError(t, err)
+	require.Equal(t, "oncall@example.com", d.ErrorMail.To)
+	require.Equal(t, "report@example.com", d.InfoMail.To)
+
+	_, err = build(`errorMail:
+  to: "${NOT_EXISTING_EMAIL}"
+`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no recipients")
+}
+
+func TestStepID(t *testing.T) {
+	dat := `handlerOn:
+  exit:
+    command: "true"
+steps:
+  - name: "1"
+    command: "true"
+  - name: "2"
+    id: deploy
+    command: "true"
+  - name: "3"
+    command: "true"
+`
+	l := &Loader{}
+	d1, err := l.LoadData([]byte(dat))
+	require.NoError(t, err)
+	d2, err := l.LoadData([]byte(dat))
+	require.NoError(t, err)
+
+	for i := range d1.Steps {
+		require.NotEmpty(t, d1.Steps[i].ID)
+		require.Equal(t, d1.Steps[i].ID, d2.Steps[i].ID)
+	}
+	require.NotEqual(t, d1.Steps[0].ID, d1.Steps[2].ID)
+	require.Equal(t, "deploy", d1.Steps[1].ID)
+	require.Equal(t, "onExit", d1.HandlerOn.Exit.ID)
+
+	js, err := json.Marshal(d1.Steps[1])
+	require.NoError(t, err)
+	require.Contains(t, string(js), `"ID":"deploy"`)
+}
+
+func TestMailOnMinInterval(t *testing.T) {
+	l := &Loader{}
+	build := func(dat string) (*DAG, error) {
+		m, err := l.unmarshalData([]byte(dat))
+		require.NoError(t, err)
+		def, err := l.decode(m)
+		require.NoError(t, err)
+		return (&builder{}).buildFromDefinition(def, nil)
+	}
+
+	d, err := build(`mailOn:
+  failure: true
+  minIntervalSec: 3600
+`)
+	require.NoError(t, err)
+	require.Equal(t, &MailOn{Failure: true, MinInterval: time.Hour}, d.MailOn)
+
+	d, err = build(`mailOn:
+  failure: true
+  exceptExitCodes: [42, 43]
+`)
+	require.NoError(t, err)
+	require.Equal(t, []int{42, 43}, d.MailOn.ExceptExitCodes)
+
+	_, err = build(`mailOn:
+  minIntervalSec: -1
+`)
+	require.Error(t, err)
+}
+
+func TestTimeout(t *testing.T) {
+	l := &Loader{}
+	d, err := l.LoadData([]byte(`timeoutSec: 3600
+handlerTimeoutSec: 300
+steps:
+  - name: "1"
+    command: "true"
+`))
+	require.NoError(t, err)
+	require.Equal(t, time.Hour, d.Timeout)
+	require.Equal(t, time.Minute*5, d.HandlerTimeout)
+
+	_, err = l.LoadData([]byte(`timeoutSec: -1
+steps:
+  - name: "1"
+    command: "true"
+`))
+	require.Error(t, err)
+}
+
+func TestUmask(t *testing.T) {
+	l := &Loader{}
+	d, err := l.LoadData([]byte(`umask: "027"
+steps:
+  - name: "1"
+    command: "true"
+`))
+	require.NoError(t, err)
+	require.Equal(t, 0027, *d.Umask)
+	require.Equal(t, "027", d.UmaskString())
+
+	d.setup("")
+	require.Equal(t, 0027, *d.Steps[0].Umask)
+
+	for _, umask := range []string{"999", "1000", "abc"} {
+		_, err = l.LoadData([]byte(fmt.Sprintf(`umask: "%s"
+steps:
+  - name: "1"
+    command: "true"
+`, umask)))
+		require.Error(t, err, umask)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	l := &Loader{}
+	d, err := l.LoadData([]byte(`queue: true
+steps:
+  - name: "1"
+    command: "true"
+`))
+	require.NoError(t, err)
+	require.True(t, d.Queue)
+	require.Equal(t, defaultQueueLimit, d.QueueLimit)
+
+	file := path.Join(t.TempDir(), "queue.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(`queue: true
+queueLimit: 3
+steps:
+  - name: "1"
+    command: "true"
+`), 0644))
+	d, err = l.LoadHeadOnly(file)
+	require.NoError(t, err)
+	require.True(t, d.Queue)
+	require.Equal(t, 3, d.QueueLimit)
+
+	_, err = l.LoadData([]byte(`queueLimit: -1
+steps:
+  - name: "1"
+    command: "true"
+`))
+	require.Error(t, err)
+}
+
+func TestStepTimeout(t *testing.T) {
+	l := &Loader{}
+	d, err := l.LoadData([]byte(`steps:
+  - name: "1"
+    command: "true"
+    timeout: 5s
+  - name: "2"
+    command: "true"
+    timeout: 30
+  - name: "3"
+    command: "true"
+`))
+	require.NoError(t, err)
+	require.Equal(t, time.Second*5, d.Steps[0].Timeout)
+	require.Equal(t, time.Second*30, d.Steps[1].Timeout)
+	require.Equal(t, time.Duration(0), d.Steps[2].Timeout)
+
+	require.Equal(t, time.Second*5, d.Clone().Steps[0].Timeout)
+	require.Contains(t, d.String(), "Timeout: 5s")
+	require.Equal(t, "5s", d.Steps[0].toDefinition().Timeout)
+
+	for _, timeout := range []string{"-5s", "-1", "five seconds", "[5]"} {
+		_, err := l.LoadData([]byte(fmt.Sprintf(`steps:
+  - name: "1"
+    command: "true"
+    timeout: %s
+`, timeout)))
+		require.Error(t, err, timeout)
+	}
+}
@@ -1,87 +1,135 @@
 package dag
 
 type configDefinition struct {
-	Name              string
-	Group             string
-	Description       string
-	Schedule          interface{}
-	LogDir            string
-	Env               interface{}
-	HandlerOn         handerOnDef
-	Steps             []*stepDef
-	Smtp              smtpConfigDef
-	MailOn            *mailOnDef
-	ErrorMail         mailConfigDef
-	InfoMail          mailConfigDef
-	DelaySec          int
-	RestartWaitSec    int
-	HistRetentionDays *int
-	Preconditions     []*conditionDef
-	MaxActiveRuns     int
-	Params            string
-	MaxCleanUpTimeSec *int
-	Tags              string
+	Name               string          `yaml:"name,omitempty"`
+	Group              string          `yaml:"group,omitempty"`
+	Description        string          `yaml:"description,omitempty"`
+	Schedule           interface{}     `yaml:"schedule,omitempty"`
+	EnableSeconds      bool            `yaml:"enableSeconds,omitempty"`
+	LogDir             string          `yaml:"logDir,omitempty"`
+	Env                interface{}     `yaml:"env,omitempty"`
+	Dotenv             interface{}     `yaml:"dotenv,omitempty"`
+	HandlerOn          handerOnDef     `yaml:"handlerOn,omitempty"`
+	Steps              []*stepDef      `yaml:"steps,omitempty"`
+	Smtp               smtpConfigDef   `yaml:"smtp,omitempty"`
+	MailOn             *mailOnDef      `yaml:"mailOn,omitempty"`
+	ErrorMail          mailConfigDef   `yaml:"errorMail,omitempty"`
+	InfoMail           mailConfigDef   `yaml:"infoMail,omitempty"`
+	DelaySec           int             `yaml:"delaySec,omitempty"`
+	RestartWaitSec     int             `yaml:"restartWaitSec,omitempty"`
+	HistRetentionDays  *int            `yaml:"histRetentionDays,omitempty"`
+	Preconditions      []*conditionDef `yaml:"preconditions,omitempty"`
+	MaxActiveRuns      *int            `yaml:"maxActiveRuns,omitempty"`
+	Params             interface{}     `yaml:"params,omitempty"`
+	EnvOverridesParams bool            `yaml:"envOverridesParams,omitempty"`
+	MaxCleanUpTimeSec  *int            `yaml:"maxCleanUpTimeSec,omitempty"`
+	TimeoutSec         int             `yaml:"timeoutSec,omitempty"`
+	HandlerTimeoutSec  int             `yaml:"handlerTimeoutSec,omitempty"`
+	Tags               string          `yaml:"tags,omitempty"`
+	Include            []string        `yaml:"include,omitempty"`
+	Umask              string          `yaml:"umask,omitempty"`
+	Queue              bool            `yaml:"queue,omitempty"`
+	QueueLimit         int             `yaml:"queueLimit,omitempty"`
+	SkipIfSuccessful   bool            `yaml:"skipIfSuccessful,omitempty"`
+	CatchUp            bool            `yaml:"catchUp,omitempty"`
+	OnChange           string          `yaml:"onChange,omitempty"`
+	WorkingDir         string          `yaml:"workingDir,omitempty"`
+	Webhooks           []*webhookDef   `yaml:"webhooks,omitempty"`
 }
 
 type conditionDef struct {
-	Condition string
-	Expected  string
+	Condition string            `yaml:"condition,omitempty"`
+	Expected  string            `yaml:"expected,omitempty"`
+	Disk      *diskConditionDef `yaml:"disk,omitempty"`
+	Shell     string            `yaml:"shell,omitempty"`
+}
+
+type diskConditionDef struct {
+	Path      string `yaml:"path,omitempty"`
+	MinFreeGB int    `yaml:"minFreeGB,omitempty"`
 }
 
 type handerOnDef struct {
-	Failure *stepDef
-	Success *stepDef
-	Cancel  *stepDef
-	Exit    *stepDef
+	Failure *stepDef `yaml:"failure,omitempty"`
+	Success *stepDef `yaml:"success,omitempty"`
+	Cancel  *stepDef `yaml:"cancel,omitempty"`
+	Exit    *stepDef `yaml:"exit,omitempty"`
 }
 
 type stepDef struct {
-	Name           string
-	Description    string
-	Dir            string
-	Executor       string
-	ExecutorConfig map[string]interface{}
-	Command        string
-	Script         string
-	Stdout         string
-	Stderr         string
-	Output         string
-	Depends        []string
-	ContinueOn     *continueOnDef
-	RetryPolicy    *retryPolicyDef
-	RepeatPolicy   *repeatPolicyDef
-	MailOnError    bool
-	Preconditions  []*conditionDef
-	SignalOnStop   *string
+	Id             string                 `yaml:"id,omitempty"`
+	Name           string                 `yaml:"name,omitempty"`
+	Description    string                 `yaml:"description,omitempty"`
+	Meta           map[string]string      `yaml:"meta,omitempty"`
+	Tags           string                 `yaml:"tags,omitempty"`
+	Dir            interface{}            `yaml:"dir,omitempty"`
+	Env            interface{}            `yaml:"env,omitempty"`
+	Executor       string                 `yaml:"executor,omitempty"`
+	ExecutorConfig map[string]interface{} `yaml:"executorConfig,omitempty"`
+	Command        interface{}            `yaml:"command,omitempty"`
+	ArgsFile       string                 `yaml:"argsFile,omitempty"`
+	Script         string                 `yaml:"script,omitempty"`
+	Stdout         string                 `yaml:"stdout,omitempty"`
+	Stderr         string                 `yaml:"stderr,omitempty"`
+	Stdin          string                 `yaml:"stdin,omitempty"`
+	StdinFile      string                 `yaml:"stdinFile,omitempty"`
+	Artifacts      []string               `yaml:"artifacts,omitempty"`
+	Output         interface{}            `yaml:"output,omitempty"`
+	Depends        []string               `yaml:"depends,omitempty"`
+	ContinueOn     *continueOnDef         `yaml:"continueOn,omitempty"`
+	RetryPolicy    *retryPolicyDef        `yaml:"retryPolicy,omitempty"`
+	RepeatPolicy   *repeatPolicyDef       `yaml:"repeatPolicy,omitempty"`
+	MailOnError    bool                   `yaml:"mailOnError,omitempty"`
+	Preconditions  []*conditionDef        `yaml:"preconditions,omitempty"`
+	SignalOnStop   *string                `yaml:"signalOnStop,omitempty"`
+	RunAs          string                 `yaml:"runAs,omitempty"`
+	Timeout        interface{}            `yaml:"timeout,omitempty"`
+	Limits         *limitsDef             `yaml:"limits,omitempty"`
+	OnSuccess      *stepDef               `yaml:"onSuccess,omitempty"`
+	OnFailure      *stepDef               `yaml:"onFailure,omitempty"`
+}
+
+type limitsDef struct {
+	MemoryMB int `yaml:"memoryMB,omitempty"`
+	Nofile   int `yaml:"nofile,omitempty"`
 }
 
 type continueOnDef struct {
-	Failure bool
-	Skipped bool
+	Failure  bool  `yaml:"failure,omitempty"`
+	Skipped  bool  `yaml:"skipped,omitempty"`
+	ExitCode []int `yaml:"exitCode,omitempty"`
 }
 
 type repeatPolicyDef struct {
-	Repeat      bool
-	IntervalSec int
+	Repeat      bool `yaml:"repeat,omitempty"`
+	IntervalSec int  `yaml:"intervalSec,omitempty"`
 }
 
 type retryPolicyDef struct {
-	Limit       int
-	IntervalSec int
+	Limit              int    `yaml:"limit,omitempty"`
+	IntervalSec        int    `yaml:"intervalSec,omitempty"`
+	MaxIntervalSec     int    `yaml:"maxIntervalSec,omitempty"`
+	JitterMaxSec       int    `yaml:"jitterMaxSec,omitempty"`
+	RetryOnOutput      string `yaml:"retryOnOutput,omitempty"`
+	ExponentialBackoff bool   `yaml:"exponentialBackoff,omitempty"`
+	MaxElapsedSec      int    `yaml:"maxElapsedSec,omitempty"`
 }
 
 type smtpConfigDef struct {
-	Host string
-	Port string
+	Host string `yaml:"host,omitempty"`
+	Port string `yaml:"port,omitempty"`
 }
 
 type mailConfigDef struct {
-	From   string
-	To     string
-	Prefix string
+	From   string `yaml:"from,omitempty"`
+	To     string `yaml:"to,omitempty"`
+	Prefix string `yaml:"prefix,omitempty"`
 }
 
 type mailOnDef struct {
-	Failure bool
-	Success bool
+	Failure         bool  `yaml:"failure,omitempty"`
+	Success         bool  `yaml:"success,omitempty"`
+	Retry           bool  `yaml:"retry,omitempty"`
+	MinIntervalSec  int   `yaml:"minIntervalSec,omitempty"`
+	ExceptExitCodes []int `yaml:"exceptExitCodes,omitempty"`
 }
@@ -0,0 +1,256 @@
+package dag
+
+import (
+	"fmt"
+	"strings"
+)
+
+type DiffKind int
+
+const (
+	DiffAdded DiffKind = iota
+	DiffRemoved
+	DiffChanged
+)
+
+// FieldDiff describes a change of a field between two versions of a DAG.
+type FieldDiff struct {
+	Kind  DiffKind
+	Field string
+	Old   string
+	New   string
+}
+
+func (d FieldDiff) String() string {
+	switch d.Kind {
+	case DiffAdded:
+		return fmt.Sprintf("%s added", d.Field)
+	case DiffRemoved:
+		return fmt.Sprintf("%s removed", d.Field)
+	default:
+		return fmt.Sprintf("%s changed: %q -> %q", d.Field, d.Old, d.New)
+	}
+}
+
+type dagDiffField struct {
+	name  string
+	value func(*DAG) string
+}
+
+type stepDiffField struct {
+	name  string
+	value func(*Step) string
+}
+
+var dagDiffFields = []dagDiffField{
+	{"name", func(d *DAG) string { return d.Name }},
+	{"group", func(d *DAG) string { return d.Group }},
+	{"description", func(d *DAG) string { return d.Description }},
+	{"schedule", func(d *DAG) string { return joinSchedules(d.Schedule) }},
+	{"schedule.jitter", func(d *DAG) string { return joinJitters(d.Schedule) }},
+	{"enableSeconds", func(d *DAG) string { return fmt.Sprint(d.EnableSeconds) }},
+	{"schedule.stop", func(d *DAG) string { return joinSchedules(d.StopSchedule) }},
+	{"schedule.restart", func(d *DAG) string { return joinSchedules(d.RestartSchedule) }},
+	{"env", func(d *DAG) string { return strings.Join(d.Env, ", ") }},
+	{"dotenv", func(d *DAG) string { return strings.Join(d.Dotenv, ", ") }},
+	{"logDir", func(d *DAG) string { return d.LogDir }},
+	{"params", func(d *DAG) string { return d.DefaultParams }},
+	{"envOverridesParams", func(d *DAG) string { return fmt.Sprint(d.EnvOverridesParams) }},
+	{"timeout", func(d *DAG) string { return d.Timeout.String() }},
+	{"handlerTimeout", func(d *DAG) string { return d.HandlerTimeout.String() }},
+	{"umask", func(d *DAG) string { return d.UmaskString() }},
+	{"queue", func(d *DAG) string { return fmt.Sprint(d.Queue) }},
+	{"queueLimit", func(d *DAG) string { return fmt.Sprint(d.QueueLimit) }},
+	{"skipIfSuccessful", func(d *DAG) string { return fmt.Sprint(d.SkipIfSuccessful) }},
+	{"catchUp", func(d *DAG) string { return fmt.Sprint(d.CatchUp) }},
+	{"onChange", func(d *DAG) string { return d.OnChange }},
+	{"workingDir", func(d *DAG) string { return d.WorkingDir }},
+	{"webhooks", func(d *DAG) string { return joinWebhooks(d.Webhooks) }},
+	{"tags", func(d *DAG) string { return strings.Join(d.Tags, ",") }},
+	{"delay", func(d *DAG) string { return d.Delay.String() }},
+	{"restartWait", func(d *DAG) string { return d.RestartWait.String() }},
+	{"histRetentionDays", func(d *DAG) string { return fmt.Sprint(d.HistRetentionDays) }},
+	{"maxActiveRuns", func(d *DAG) string { return fmt.Sprint(d.MaxActiveRuns) }},
+	{"maxCleanUpTime", func(d *DAG) string { return d.MaxCleanUpTime.String() }},
+	{"preconditions", func(d *DAG) string { return joinConditions(d.Preconditions) }},
+}
+
+var stepDiffFields = []stepDiffField{
+	{"id", func(s *Step) string { return s.ID }},
+	{"description", func(s *Step) string { return s.Description }},
+	{"meta", func(s *Step) string { return fmt.Sprint(s.Meta) }},
+	{"dir", func(s *Step) string { return s.Dir }},
+	{"dir.create", func(s *Step) string { return fmt.Sprint(s.CreateDir) }},
+	{"executor", func(s *Step) string { return s.Executor }},
+	{"executorConfig", func(s *Step) string { return fmt.Sprint(s.ExecutorConfig) }},
+	{"command", func(s *Step) string { return s.commandString() }},
+	{"http", func(s *Step) string {
+		if s.HTTP == nil {
+			return ""
+		}
+		return fmt.Sprintf("%+v", *s.HTTP)
+	}},
+	{"argsFile", func(s *Step) string { return s.ArgsFile }},
+	{"script", func(s *Step) string { return s.Script }},
+	{"stdout", func(s *Step) string { return s.Stdout }},
+	{"stderr", func(s *Step) string { return s.Stderr }},
+	{"stdin", func(s *Step) string { return s.Stdin }},
+	{"stdinFile", func(s *Step) string { return s.StdinFile }},
+	{"env", func(s *Step) string { return strings.Join(s.Env, ", ") }},
+	{"artifacts", func(s *Step) string { return strings.Join(s.Artifacts, ",") }},
+	{"timeout", func(s *Step) string { return s.Timeout.String() }},
+	{"output", func(s *Step) string { return s.Output }},
+	{"output.encoding", func(s *Step) string { return s.OutputEncoding }},
+	{"output.maxBytes", func(s *Step) string { return fmt.Sprint(s.OutputMaxBytes) }},
+	{"output.alertOnChange", func(s *Step) string { return fmt.Sprint(s.OutputAlertOnChange) }},
+	{"depends", func(s *Step) string { return strings.Join(s.Depends, ", ") }},
+	{"tags", func(s *Step) string { return strings.Join(s.Tags, ",") }},
+	{"continueOn", func(s *Step) string { return fmt.Sprintf("%+v", s.ContinueOn) }},
+	{"retryPolicy", func(s *Step) string {
+		if s.RetryPolicy == nil {
+			return ""
+		}
+		return fmt.Sprintf("%+v", *s.RetryPolicy)
+	}},
+	{"repeatPolicy", func(s *Step) string { return fmt.Sprintf("%+v", s.RepeatPolicy) }},
+	{"mailOnError", func(s *Step) string { return fmt.Sprint(s.MailOnError) }},
+	{"preconditions", func(s *Step) string { return joinConditions(s.Preconditions) }},
+	{"signalOnStop", func(s *Step) string { return s.SignalOnStop }},
+	{"runAs", func(s *Step) string { return s.RunAs }},
+	{"umask", func(s *Step) string {
+		if s.Umask == nil {
+			return ""
+		}
+		return fmt.Sprintf("%03o", *s.Umask)
+	}},
+	{"limits", func(s *Step) string {
+		if s.Limits == nil {
+			return ""
+		}
+		return fmt.Sprintf("%+v", *s.Limits)
+	}},
+}
+
+// Diff returns the changes from the DAG to the other DAG.
+// Steps are matched by their names.
+func (c *DAG) Diff(other *DAG) []FieldDiff {
+	ret := []FieldDiff{}
+	for _, f := range dagDiffFields {
+		ret = appendDiff(ret, f.name, f.value(c), f.value(other))
+	}
+
+	oldSteps := map[string]*Step{}
+	for _, s := range c.Steps {
+		oldSteps[s.Name] = s
+	}
+	newSteps := map[string]*Step{}
+	for _, s := range other.Steps {
+		newSteps[s.Name] = s
+	}
+	for _, s := range c.Steps {
+		if _, ok := newSteps[s.Name]; !ok {
+			ret = append(ret, FieldDiff{Kind: DiffRemoved, Field: stepField(s.Name)})
+		}
+	}
+	for _, s := range other.Steps {
+		if old, ok := oldSteps[s.Name]; !ok {
+			ret = append(ret, FieldDiff{Kind: DiffAdded, Field: stepField(s.Name)})
+		} else {
+			ret = append(ret, diffSteps(stepField(s.Name), old, s)...)
+		}
+	}
+
+	for _, h := range []struct {
+		name     string
+		old, new *Step
+	}{
+		{"handlerOn.exit", c.HandlerOn.Exit, other.HandlerOn.Exit},
+		{"handlerOn.success", c.HandlerOn.Success, other.HandlerOn.Success},
+		{"handlerOn.failure", c.HandlerOn.Failure, other.HandlerOn.Failure},
+		{"handlerOn.cancel", c.HandlerOn.Cancel, other.HandlerOn.Cancel},
+	} {
+		ret = appendStepDiff(ret, h.name, h.old, h.new)
+	}
+	return ret
+}
+
+func diffSteps(field string, a, b *Step) []FieldDiff {
+	ret := []FieldDiff{}
+	for _, f := range stepDiffFields {
+		ret = appendDiff(ret, field+"."+f.name, f.value(a), f.value(b))
+	}
+	ret = appendStepDiff(ret, field+".onSuccess", a.OnSuccess, b.OnSuccess)
+	ret = appendStepDiff(ret, field+".onFailure", a.OnFailure, b.OnFailure)
+	return ret
+}
+
+// appendStepDiff appends the changes of the optional step, e.g. a handler.
+func appendStepDiff(diffs []FieldDiff, field string, old, new *Step) []FieldDiff {
+	switch {
+	case old == nil && new == nil:
+		return diffs
+	case old == nil:
+		return append(diffs, FieldDiff{Kind: DiffAdded, Field: field})
+	case new == nil:
+		return append(diffs, FieldDiff{Kind: DiffRemoved, Field: field})
+	default:
+		return append(diffs, diffSteps(field, old, new)...)
+	}
+}
+
+func appendDiff(diffs []FieldDiff, field, old, new string) []FieldDiff {
+	if old == new {
+		return diffs
+	}
+	return append(diffs, FieldDiff{
+		Kind:  DiffChanged,
+		Field: field,
+		Old:   old,
+		New:   new,
+	})
+}
+
+func stepField(name string) string {
+	return fmt.Sprintf("steps[%s]", name)
+}
+
+func joinSchedules(schedules []*Schedule) string {
+	ret := []string{}
+	for _, s := range schedules {
+		ret = append(ret, s.Expression)
+	}
+	return strings.Join(ret, ", ")
+}
+
+// joinJitters returns the jitters of the schedules, which may differ
+// between the schedules of a DAG built by hand.
+func joinJitters(schedules []*Schedule) string {
+	ret := []string{}
+	for _, s := range schedules {
+		ret = append(ret, s.Jitter.String())
+	}
+	return strings.Join(ret, ", ")
+}
+
+func joinConditions(conds []*Condition) string {
+	ret := []string{}
+	for _, c := range conds {
+		s := fmt.Sprintf("%s=%s", c.Condition, c.Expected)
+		if c.Shell != "" {
+			s = fmt.Sprintf("%s(%s)", c.Shell, s)
+		}
+		if c.Disk != nil {
+			s = fmt.Sprintf("disk(%s>=%dGB)", c.Disk.Path, c.Disk.MinFreeGB)
+		}
+		ret = append(ret, s)
+	}
+	return strings.Join(ret, ", ")
+}
+
+func joinWebhooks(webhooks []*Webhook) string {
+	ret := []string{}
+	for _, w := range webhooks {
+		ret = append(ret, fmt.Sprintf("%s %s", w.Format, w.URL))
+	}
+	return strings.Join(ret, ", ")
+}
@@ -0,0 +1,144 @@
+package dag
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	base := `schedule: "0 * * * *"
+steps:
+  - name: "1"
+    command: "echo 1"
+  - name: "2"
+    command: "echo 2"
+    depends: ["1"]
+`
+	l := &Loader{}
+	d1, err := l.LoadData([]byte(base))
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		Name string
+		Def  string
+		Want []FieldDiff
+	}{
+		{
+			Name: "no change",
+			Def:  base,
+			Want: []FieldDiff{},
+		},
+		{
+			Name: "added step",
+			Def: base + `  - name: "3"
+    command: "echo 3"
+`,
+			Want: []FieldDiff{
+				{Kind: DiffAdded, Field: "steps[3]"},
+			},
+		},
+		{
+			Name: "removed step",
+			Def: `schedule: "0 * * * *"
+steps:
+  - name: "1"
+    command: "echo 1"
+`,
+			Want: []FieldDiff{
+				{Kind: DiffRemoved, Field: "steps[2]"},
+			},
+		},
+		{
+			Name: "changed command and schedule",
+			Def: `schedule: "30 * * * *"
+steps:
+  - name: "1"
+    command: "echo one"
+  - name: "2"
+    command: "echo 2"
+    depends: ["1"]
+`,
+			Want: []FieldDiff{
+				{Kind: DiffChanged, Field: "schedule", Old: "0 * * * *", New: "30 * * * *"},
+				{Kind: DiffChanged, Field: "steps[1].command", Old: "echo 1", New: "echo one"},
+			},
+		},
+		{
+			Name: "changed limits",
+			Def: `schedule: "0 * * * *"
+steps:
+  - name: "1"
+    command: "echo 1"
+    limits:
+      nofile: 64
+  - name: "2"
+    command: "echo 2"
+    depends: ["1"]
+`,
+			Want: []FieldDiff{
+				{Kind: DiffChanged, Field: "steps[1].limits", Old: "", New: "{MemoryMB:0 Nofile:64}"},
+			},
+		},
+		{
+			Name: "changed hooks",
+			Def: `schedule: "0 * * * *"
+steps:
+  - name: "1"
+    command: "echo 1"
+    onSuccess:
+      command: "echo done"
+  - name: "2"
+    command: "echo 2"
+    depends: ["1"]
+`,
+			Want: []FieldDiff{
+				{Kind: DiffAdded, Field: "steps[1].onSuccess"},
+			},
+		},
+		{
+			Name: "changed id and meta",
+			Def: `schedule: "0 * * * *"
+steps:
+  - name: "1"
+    id: first
+    command: "echo 1"
+    meta:
+      team: data
+  - name: "2"
+    command: "echo 2"
+    depends: ["1"]
+`,
+			Want: []FieldDiff{
+				{Kind: DiffChanged, Field: "steps[1].id", Old: d1.Steps[0].ID, New: "first"},
+				{Kind: DiffChanged, Field: "steps[1].meta", Old: "map[]", New: "map[team:data]"},
+			},
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			d2, err := l.LoadData([]byte(tc.Def))
+			require.NoError(t, err)
+			require.Equal(t, tc.Want, d1.Diff(d2))
+		})
+	}
+
+	// the jitter of every schedule is compared
+	two := `schedule: ["0 * * * *", "30 * * * *"]
+steps:
+  - name: "1"
+    command: "echo 1"
+`
+	d3, err := l.LoadData([]byte(two))
+	require.NoError(t, err)
+	d4, err := l.LoadData([]byte(two))
+	require.NoError(t, err)
+	d4.Schedule[1].Jitter = time.Second
+	require.Equal(t, []FieldDiff{
+		{Kind: DiffChanged, Field: "schedule.jitter", Old: "0s, 0s", New: "0s, 1s"},
+	}, d3.Diff(d4))
+
+	diff := FieldDiff{Kind: DiffChanged, Field: "steps[1].command", Old: "a", New: "b"}
+	require.Equal(t, `steps[1].command changed: "a" -> "b"`, diff.String())
+	require.Equal(t, "steps[3] added", FieldDiff{Kind: DiffAdded, Field: "steps[3]"}.String())
+}
@@ -0,0 +1,50 @@
+package dag
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MarshalDOT returns the dependency graph of the DAG in Graphviz DOT
+// format. Handler steps are drawn as filled nodes without edges.
+func (c *DAG) MarshalDOT() string {
+	ids := map[string]string{}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("digraph %s {\n", quoteDOT(c.Name)))
+	for i, s := range c.Steps {
+		id := fmt.Sprintf("step%d", i)
+		ids[s.Name] = id
+		sb.WriteString(fmt.Sprintf("\t%s [label=%s];\n", id, quoteDOT(s.Name)))
+	}
+	for _, s := range []*Step{
+		c.HandlerOn.Exit,
+		c.HandlerOn.Success,
+		c.HandlerOn.Failure,
+		c.HandlerOn.Cancel,
+	} {
+		if s == nil {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("\t%s [label=%s, style=filled, fillcolor=lightgrey];\n",
+			s.Name, quoteDOT(s.Name)))
+	}
+	for _, s := range c.Steps {
+		for _, dep := range s.Depends {
+			if from, ok := ids[dep]; ok {
+				sb.WriteString(fmt.Sprintf("\t%s -> %s;\n", from, ids[s.Name]))
+			}
+		}
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+var dotLabelReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+)
+
+func quoteDOT(label string) string {
+	return `"` + dotLabelReplacer.Replace(label) + `"`
+}
@@ -0,0 +1,87 @@
+package dag
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// loadDotenv reads the dotenv files and sets their variables to the
+// build environment so that env and params can refer to them. The value
+// is a path or a list of paths, and a relative path is resolved from the
+// directory of the DAG file. A later file overrides the earlier ones.
+func (b *builder) loadDotenv(value interface{}) ([]string, *Environment, error) {
+	files := []string{}
+	switch v := value.(type) {
+	case nil:
+	case string:
+		files = append(files, v)
+	case []interface{}:
+		for _, f := range v {
+			s, ok := f.(string)
+			if !ok {
+				return nil, nil, fmt.Errorf("dotenv must be a string or an array of strings")
+			}
+			files = append(files, s)
+		}
+	default:
+		return nil, nil, fmt.Errorf("dotenv must be a string or an array of strings")
+	}
+
+	env := NewEnvironment()
+	ret := []string{}
+	for _, file := range files {
+		file = b.expandEnv(file)
+		if !path.IsAbs(file) && b.file != "" {
+			file = path.Join(path.Dir(b.file), file)
+		}
+		var data []byte
+		var err error
+		if b.fsys != nil {
+			data, err = fs.ReadFile(b.fsys, file)
+		} else {
+			data, err = os.ReadFile(file)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read dotenv file %s: %w", file, err)
+		}
+		if err := parseDotenv(data, env); err != nil {
+			return nil, nil, fmt.Errorf("invalid dotenv file %s: %w", file, err)
+		}
+		ret = append(ret, file)
+	}
+	for _, e := range env.Pairs() {
+		kv := strings.SplitN(e, "=", 2)
+		b.env.Set(kv[0], kv[1])
+	}
+	return ret, env, nil
+}
+
+// parseDotenv parses the KEY=value lines of the data. Empty lines and
+// lines starting with # are ignored, an optional "export " prefix is
+// allowed, and the quotes around the value are removed.
+func parseDotenv(data []byte, env *Environment) error {
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for i := 1; s.Scan(); i++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		kv := strings.SplitN(line, "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || key == "" {
+			return fmt.Errorf("line %d: expected KEY=value", i)
+		}
+		val := strings.TrimSpace(kv[1])
+		if len(val) >= 2 && (val[0] == '"' || val[0] == '\'') && val[len(val)-1] == val[0] {
+			val = val[1 : len(val)-1]
+		}
+		env.Set(key, val)
+	}
+	return s.Err()
+}
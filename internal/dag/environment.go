@@ -0,0 +1,147 @@
+package dag
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Environment is an ordered set of environment variables for a single build.
+// Lookups that are not found fall back to the process environment.
+type Environment struct {
+	mu   sync.RWMutex
+	keys []string
+	vals map[string]string
+	// unordered are the keys set by SetUnordered.
+	unordered map[string]bool
+}
+
+// NewEnvironment creates a new environment from "KEY=VALUE" pairs.
+func NewEnvironment(pairs ...string) *Environment {
+	e := &Environment{vals: map[string]string{}, unordered: map[string]bool{}}
+	for _, p := range pairs {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) == 2 {
+			e.Set(kv[0], kv[1])
+		}
+	}
+	return e
+}
+
+// Set sets the value of the variable.
+func (e *Environment) Set(key, val string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.vals[key]; !ok {
+		e.keys = append(e.keys, key)
+	}
+	e.vals[key] = val
+	delete(e.unordered, key)
+}
+
+// SetUnordered sets the value of the variable which has no order of its
+// own, e.g. the one of the map-form env. Unless it's set again by Set,
+// MarshalForExec sorts it by the name after the ordered variables.
+func (e *Environment) SetUnordered(key, val string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.vals[key]; !ok {
+		e.keys = append(e.keys, key)
+		e.unordered[key] = true
+	}
+	e.vals[key] = val
+}
+
+// Lookup returns the value of the variable in the environment.
+func (e *Environment) Lookup(key string) (string, bool) {
+	if e == nil {
+		return "", false
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	v, ok := e.vals[key]
+	return v, ok
+}
+
+var envNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// envFuncs are the functions to transform the value of a variable
+// in the pipe syntax, e.g. ${HOST | lower | trim}.
+var envFuncs = map[string]func(string) string{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+	"base64": func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	},
+}
+
+// Expand replaces ${var} or $var in the string according to the environment.
+// The value of ${var | fn | ...} is transformed by the functions of envFuncs
+// from left to right. The expression with an unknown function is left as is.
+func (e *Environment) Expand(s string) string {
+	return os.Expand(s, func(key string) string {
+		fields := strings.Split(key, "|")
+		v := e.value(strings.TrimSpace(fields[0]))
+		for _, f := range fields[1:] {
+			fn, ok := envFuncs[strings.TrimSpace(f)]
+			if !ok {
+				return "${" + key + "}"
+			}
+			v = fn(v)
+		}
+		return v
+	})
+}
+
+func (e *Environment) value(key string) string {
+	if v, ok := e.Lookup(key); ok {
+		return v
+	}
+	return os.Getenv(key)
+}
+
+// Pairs returns the variables as "KEY=VALUE" in the order they were set.
+func (e *Environment) Pairs() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	ret := []string{}
+	for _, k := range e.keys {
+		ret = append(ret, fmt.Sprintf("%s=%s", k, e.vals[k]))
+	}
+	return ret
+}
+
+// MarshalForExec returns the variables as "KEY=VALUE" to run a command.
+// The order is stable for the same definition, so that the runs are
+// reproducible: the ordered variables in the order they were set, and
+// then the unordered ones sorted by the name. The variables which are not
+// valid names, e.g. the positional parameters, are only for Expand.
+func (e *Environment) MarshalForExec() []string {
+	if e == nil {
+		return nil
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	ordered, unordered := []string{}, []string{}
+	for _, k := range e.keys {
+		if !envNameRegex.MatchString(k) {
+			continue
+		}
+		if e.unordered[k] {
+			unordered = append(unordered, k)
+		} else {
+			ordered = append(ordered, k)
+		}
+	}
+	sort.Strings(unordered)
+	ret := []string{}
+	for _, k := range append(ordered, unordered...) {
+		ret = append(ret, fmt.Sprintf("%s=%s", k, e.vals[k]))
+	}
+	return ret
+}
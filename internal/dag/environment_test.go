@@ -0,0 +1,163 @@
+package dag
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvironment(t *testing.T) {
+	os.Setenv("TEST_ENVIRONMENT_GLOBAL", "global")
+
+	e := NewEnvironment("FOO=foo", "BAR=bar=baz")
+	e.Set("FOO", "FOO")
+	e.Set("BAZ", "${FOO}")
+
+	require.Equal(t, []string{"FOO=FOO", "BAR=bar=baz", "BAZ=${FOO}"}, e.Pairs())
+	require.Equal(t, "FOO-bar=baz-global", e.Expand("${FOO}-$BAR-${TEST_ENVIRONMENT_GLOBAL}"))
+
+	_, ok := os.LookupEnv("BAZ")
+	require.False(t, ok)
+}
+
+func TestEnvironmentMarshalForExec(t *testing.T) {
+	e := NewEnvironment("PATH=/bin")
+	e.SetUnordered("ZED", "z")
+	e.Set("SECOND", "2")
+	e.SetUnordered("ALPHA", "a")
+	e.Set("FIRST", "1")
+	e.SetUnordered("MID", "m")
+	// set again in the ordered form
+	e.Set("MID", "mm")
+	// an ordered variable stays ordered
+	e.SetUnordered("SECOND", "22")
+
+	want := []string{"PATH=/bin", "SECOND=22", "FIRST=1", "MID=mm", "ALPHA=a", "ZED=z"}
+	require.Equal(t, want, e.MarshalForExec())
+	for i := 0; i < 10; i++ {
+		require.Equal(t, want, e.MarshalForExec())
+	}
+
+	// the list form keeps the order and the map form is sorted
+	l := &Loader{}
+	for _, tc := range []struct {
+		Def  string
+		Want []string
+	}{
+		{
+			Def: `env:
+  - C: c
+  - A: a
+  - B: b
+`,
+			Want: []string{"C=c", "A=a", "B=b"},
+		},
+		{
+			Def: `env:
+  C: c
+  A: a
+  B: ${A}b
+`,
+			Want: []string{"A=a", "B=ab", "C=c"},
+		},
+	} {
+		d, err := l.LoadData([]byte(tc.Def + `steps:
+  - name: "1"
+    command: "true"
+`))
+		require.NoError(t, err)
+		require.Equal(t, tc.Want, d.Env)
+	}
+}
+
+func TestDAGEnvironment(t *testing.T) {
+	l := &Loader{}
+	d, err := l.LoadData([]byte(`params: "first NAME=second"
+env:
+  - GREETING: hello
+steps:
+  - name: "1"
+    command: "echo $1 $NAME"
+`))
+	require.NoError(t, err)
+
+	env := d.Environment()
+	require.Equal(t, "hello first NAME=second 2", env.Expand("$GREETING $@ $#"))
+	require.Equal(t, "NAME=second second", env.Expand("$2 $NAME"))
+	// the positional parameters are not passed to the commands
+	vars := env.MarshalForExec()
+	require.Contains(t, vars, "GREETING=hello")
+	require.Contains(t, vars, "NAME=second")
+	require.NotContains(t, vars, "1=first")
+	require.NotContains(t, vars, "#=2")
+
+	// the steps run with the same variables
+	require.Equal(t, "first second",
+		NewEnvironment(d.Steps[0].Variables...).Expand("$1 $NAME"))
+}
+
+func TestEnvironmentFuncs(t *testing.T) {
+	e := NewEnvironment("RAW_HOST=  Example.COM ", "NAME=dagu")
+
+	for _, tc := range []struct {
+		Expr string
+		Want string
+	}{
+		{Expr: "${NAME}", Want: "dagu"},
+		{Expr: "${RAW_HOST | lower}", Want: "  example.com "},
+		{Expr: "${RAW_HOST|upper}", Want: "  EXAMPLE.COM "},
+		{Expr: "[${RAW_HOST | trim}]", Want: "[Example.COM]"},
+		{Expr: "${NAME | base64}", Want: "ZGFndQ=="},
+		{Expr: "${RAW_HOST | lower | trim}", Want: "example.com"},
+		{Expr: "${RAW_HOST | trim | upper | base64}", Want: "RVhBTVBMRS5DT00="},
+		{Expr: "${NAME | unknown}", Want: "${NAME | unknown}"},
+	} {
+		require.Equal(t, tc.Want, e.Expand(tc.Expr), tc.Expr)
+	}
+
+	l := &Loader{}
+	m, err := l.unmarshalData([]byte(`env:
+  - RAW_HOST: "  Example.COM "
+  - HOST: "${RAW_HOST | lower | trim}"
+steps:
+  - name: "1"
+    command: "true"
+`))
+	require.NoError(t, err)
+	def, err := l.decode(m)
+	require.NoError(t, err)
+	d, err := (&builder{}).buildFromDefinition(def, nil)
+	require.NoError(t, err)
+	require.Contains(t, d.Env, "HOST=example.com")
+}
+
+func TestConcurrentBuildEnv(t *testing.T) {
+	l := &Loader{}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			d, err := l.LoadData([]byte(fmt.Sprintf(`
+env:
+  - TEST_CONCURRENT_BUILD: "%d"
+  - TEST_CONCURRENT_BUILD_2: "${TEST_CONCURRENT_BUILD}-%d"
+steps:
+  - name: "1"
+    command: "echo ${TEST_CONCURRENT_BUILD}"
+`, i, i)))
+			require.NoError(t, err)
+			require.Equal(t, []string{
+				fmt.Sprintf("TEST_CONCURRENT_BUILD=%d", i),
+				fmt.Sprintf("TEST_CONCURRENT_BUILD_2=%d-%d", i, i),
+			}, d.Env)
+		}(i)
+	}
+	wg.Wait()
+
+	_, ok := os.LookupEnv("TEST_CONCURRENT_BUILD")
+	require.False(t, ok)
+}
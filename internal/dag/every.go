@@ -0,0 +1,56 @@
+package dag
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EverySchedule is the schedule of "@every <duration>". Unlike the one
+// of the cron package, which fires the interval after the given time,
+// it fires at the multiples of the interval since the zero time, so
+// that the next time doesn't move when it's asked again before then.
+type EverySchedule struct {
+	Interval time.Duration
+	// Location is the time zone of the schedule given by the CRON_TZ=
+	// prefix. The multiples are aligned to its wall clock, e.g. @every 1h
+	// fires at the top of the hour in a zone with a 30 minute offset. They
+	// are aligned to UTC if it's nil.
+	Location *time.Location
+}
+
+const everyPrefix = "@every "
+
+// parseEvery returns the schedule if the expression is "@every <duration>".
+// The location is the time zone of the schedule, or nil for UTC.
+func parseEvery(expr string, loc *time.Location) (*EverySchedule, bool, error) {
+	if !strings.HasPrefix(expr, everyPrefix) {
+		return nil, false, nil
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(expr, everyPrefix)))
+	if err != nil {
+		return nil, true, fmt.Errorf("invalid schedule: %s", err)
+	}
+	if d < time.Second {
+		return nil, true, fmt.Errorf("invalid schedule: interval must be at least 1s: %s", expr)
+	}
+	return &EverySchedule{Interval: d, Location: loc}, true, nil
+}
+
+// Next returns the next time the schedule fires after the given time.
+func (s *EverySchedule) Next(t time.Time) time.Time {
+	if s.Location == nil {
+		return t.Truncate(s.Interval).Add(s.Interval)
+	}
+	// the offset at the next time is used if it changes by then, e.g.
+	// across a daylight saving time change.
+	return s.nextInZone(t, s.nextInZone(t, t))
+}
+
+// nextInZone returns the next multiple of the interval after t on the
+// wall clock with the offset of the location at the given time.
+func (s *EverySchedule) nextInZone(t, at time.Time) time.Time {
+	_, offset := at.In(s.Location).Zone()
+	shift := time.Duration(offset) * time.Second
+	return t.Add(shift).Truncate(s.Interval).Add(s.Interval).Add(-shift).In(s.Location)
+}
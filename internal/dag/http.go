@@ -0,0 +1,126 @@
+package dag
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/samber/lo"
+)
+
+// ExecutorHTTP is the executor to send an HTTP request.
+const ExecutorHTTP = "http"
+
+// HTTPConfig is the request of a step with the http executor.
+type HTTPConfig struct {
+	Method  string
+	URL     string
+	Headers map[string]string
+	Query   map[string]string
+	Body    string
+	Timeout time.Duration
+}
+
+var httpMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+
+type httpConfigDef struct {
+	Timeout int               `json:"timeout" mapstructure:"timeout"`
+	Headers map[string]string `json:"headers" mapstructure:"headers"`
+	Query   map[string]string `json:"query" mapstructure:"query"`
+	Body    string            `json:"body" mapstructure:"body"`
+}
+
+// buildHTTPConfig builds the request of the http executor from the command,
+// e.g. "POST https://example.com", and the JSON in the script or the
+// executorConfig. The URL, the headers and the query are kept as they are
+// and expanded by the executor when it's run, so that the values of the
+// variables, e.g. secrets, are not stored in the status.
+func buildHTTPConfig(step *Step) (*HTTPConfig, error) {
+	method := strings.ToUpper(step.Command)
+	if !lo.Contains(httpMethods, method) {
+		return nil, fmt.Errorf("invalid http method: %s", step.Command)
+	}
+	if len(step.Args) != 1 {
+		return nil, fmt.Errorf("http executor command must be \"<method> <url>\": %s", step.commandString())
+	}
+	cfg := &HTTPConfig{
+		Method:  method,
+		URL:     step.Args[0],
+		Headers: map[string]string{},
+		Query:   map[string]string{},
+	}
+	// the URL can't be validated if it refers to a variable which is set
+	// only when it's run, e.g. the output of a previous step.
+	if u, ok := expandDefined(cfg.URL, NewEnvironment(step.Variables...)); ok {
+		if err := validateHTTPURL(u); err != nil {
+			return nil, err
+		}
+	}
+
+	def := &httpConfigDef{}
+	if step.Script != "" {
+		if err := json.Unmarshal([]byte(step.Script), def); err != nil {
+			return nil, fmt.Errorf("invalid http executor config: %w", err)
+		}
+	} else if len(step.ExecutorConfig) > 0 {
+		if err := mapstructure.Decode(step.ExecutorConfig, def); err != nil {
+			return nil, fmt.Errorf("invalid http executor config: %w", err)
+		}
+	}
+	if def.Timeout < 0 {
+		return nil, fmt.Errorf("http timeout must not be negative: %d", def.Timeout)
+	}
+	cfg.Timeout = time.Second * time.Duration(def.Timeout)
+	for k, v := range def.Headers {
+		cfg.Headers[k] = v
+	}
+	for k, v := range def.Query {
+		cfg.Query[k] = v
+	}
+	cfg.Body = def.Body
+	return cfg, nil
+}
+
+// Expand returns a copy of the request with the URL, the headers and the
+// query expanded with env.
+func (c *HTTPConfig) Expand(env *Environment) *HTTPConfig {
+	ret := *c
+	ret.URL = env.Expand(c.URL)
+	ret.Headers = map[string]string{}
+	for k, v := range c.Headers {
+		ret.Headers[k] = env.Expand(v)
+	}
+	ret.Query = map[string]string{}
+	for k, v := range c.Query {
+		ret.Query[k] = env.Expand(v)
+	}
+	return &ret
+}
+
+func validateHTTPURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid http url: %s", s)
+	}
+	return nil
+}
+
+// expandDefined expands s with env. ok is false if s refers to a variable
+// which is neither in env nor in the process environment.
+func expandDefined(s string, env *Environment) (ret string, ok bool) {
+	ok = true
+	os.Expand(s, func(key string) string {
+		key = strings.TrimSpace(strings.Split(key, "|")[0])
+		if _, found := env.Lookup(key); !found {
+			if _, found = os.LookupEnv(key); !found {
+				ok = false
+			}
+		}
+		return ""
+	})
+	return env.Expand(s), ok
+}
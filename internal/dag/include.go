@@ -0,0 +1,107 @@
+package dag
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// resolveIncludes merges the steps of the files listed in the include
+// field into the definition, before its own steps. The included step
+// names are prefixed with the base name of the file to avoid name
+// collisions, e.g. "setup" in common.yaml becomes "common.setup".
+// Only the steps of the included files are merged. The included files
+// must be in the directory of the DAG file as the !include tag.
+func (cl *Loader) resolveIncludes(def *configDefinition, file string,
+	opts *BuildDAGOptions, stack []string) error {
+	if len(def.Include) == 0 {
+		return nil
+	}
+	stack = append(stack, file)
+
+	steps := []*stepDef{}
+	for _, inc := range def.Include {
+		f, err := includePath(stack[0], file, inc, opts)
+		if err != nil {
+			return err
+		}
+		for _, s := range stack {
+			if s == f {
+				return fmt.Errorf("include cycle detected: %s",
+					strings.Join(append(stack, f), " -> "))
+			}
+		}
+
+		var raw map[string]interface{}
+		if opts.fsys != nil {
+			raw, err = cl.readFS(opts.fsys, f)
+		} else {
+			raw, err = cl.readFile(f)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to include %s: %w", inc, err)
+		}
+		idef, err := cl.decode(raw)
+		if err != nil {
+			return fmt.Errorf("failed to include %s: %w", inc, err)
+		}
+		if err := cl.resolveIncludes(idef, f, opts, stack); err != nil {
+			return err
+		}
+
+		prefix := strings.TrimSuffix(path.Base(filepath.ToSlash(f)), path.Ext(f))
+		steps = append(steps, namespaceSteps(prefix, idef.Steps)...)
+	}
+	def.Steps = append(steps, def.Steps...)
+	def.Include = nil
+	return nil
+}
+
+// includePath returns the path of the included file, which is relative
+// to the directory of the including file. It's an error if the path
+// leaves the directory of the DAG file, also by a symbolic link.
+func includePath(dagFile, file, inc string, opts *BuildDAGOptions) (string, error) {
+	outside := func(root string) error {
+		return fmt.Errorf("include %s: the path must be inside %s", inc, root)
+	}
+	if opts.fsys != nil {
+		root := path.Dir(dagFile)
+		f := path.Join(path.Dir(file), inc)
+		if path.IsAbs(inc) || !isWithin(root, f) {
+			return "", outside(root)
+		}
+		return f, nil
+	}
+	root := filepath.Dir(dagFile)
+	if filepath.IsAbs(inc) {
+		return "", outside(root)
+	}
+	f := filepath.Join(filepath.Dir(file), inc)
+	ok, err := isWithinRealPath(root, f)
+	if err != nil {
+		return "", fmt.Errorf("failed to include %s: %w", inc, err)
+	}
+	if !ok {
+		return "", outside(root)
+	}
+	return f, nil
+}
+
+// namespaceSteps prefixes the names of the steps and the dependencies
+// between them.
+func namespaceSteps(prefix string, steps []*stepDef) []*stepDef {
+	names := map[string]bool{}
+	for _, s := range steps {
+		names[s.Name] = true
+	}
+	for _, s := range steps {
+		s.Name = fmt.Sprintf("%s.%s", prefix, s.Name)
+		for i, d := range s.Depends {
+			if names[d] {
+				s.Depends[i] = fmt.Sprintf("%s.%s", prefix, d)
+			}
+		}
+	}
+	return steps
+}
@@ -0,0 +1,21 @@
+package dag
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// securityGet reads a generic password from the macOS keychain.
+func securityGet(service, user string) (string, error) {
+	out, err := exec.Command(
+		"security", "find-generic-password", "-s", service, "-a", user, "-w",
+	).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func init() {
+	RegisterSecretProvider("keyring", &keyringProvider{get: securityGet})
+}
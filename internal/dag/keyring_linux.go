@@ -0,0 +1,21 @@
+package dag
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// secretToolGet reads a secret from the Secret Service via secret-tool.
+func secretToolGet(service, user string) (string, error) {
+	out, err := exec.Command(
+		"secret-tool", "lookup", "service", service, "username", user,
+	).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func init() {
+	RegisterSecretProvider("keyring", &keyringProvider{get: secretToolGet})
+}
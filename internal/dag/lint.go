@@ -0,0 +1,89 @@
+package dag
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Lint rule codes.
+const (
+	LintNoDepends          = "no-depends"
+	LintMissingDescription = "missing-description"
+	LintLongTimeout        = "long-timeout"
+	LintSudo               = "sudo"
+)
+
+// LintWarning is a style warning of a DAG. Unlike validation errors,
+// it doesn't prevent the DAG from running.
+type LintWarning struct {
+	Code    string
+	Step    string
+	Message string
+}
+
+func (w LintWarning) String() string {
+	return fmt.Sprintf("[%s] %s", w.Code, w.Message)
+}
+
+// lintMaxTimeout is the duration above which a timeout is considered
+// to be too long.
+const lintMaxTimeout = time.Hour
+
+var sudoPattern = regexp.MustCompile(`(^|[\s;&|(])sudo(\s|$)`)
+
+// Lint returns the style warnings of the DAG.
+func (c *DAG) Lint() []LintWarning {
+	ret := []LintWarning{}
+	add := func(code, step, format string, args ...interface{}) {
+		ret = append(ret, LintWarning{
+			Code:    code,
+			Step:    step,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if c.Description == "" {
+		add(LintMissingDescription, "", "DAG has no description")
+	}
+	if c.MaxCleanUpTime > lintMaxTimeout {
+		add(LintLongTimeout, "", "maxCleanUpTimeSec is longer than %s", lintMaxTimeout)
+	}
+
+	roots := 0
+	for _, step := range c.Steps {
+		if len(step.Depends) == 0 {
+			roots++
+		}
+	}
+
+	_ = c.WalkSteps(func(step *Step) error {
+		if step.Description == "" {
+			add(LintMissingDescription, step.Name, "step %q has no description", step.Name)
+		}
+		if sudoPattern.MatchString(step.commandString()) || sudoPattern.MatchString(step.Script) {
+			add(LintSudo, step.Name, "step %q uses sudo; consider runAs instead", step.Name)
+		}
+		if step.Timeout > lintMaxTimeout {
+			add(LintLongTimeout, step.Name,
+				"step %q has a timeout longer than %s", step.Name, lintMaxTimeout)
+		}
+		if p := step.RetryPolicy; p != nil &&
+			(p.Interval > lintMaxTimeout || p.MaxInterval > lintMaxTimeout) {
+			add(LintLongTimeout, step.Name,
+				"step %q waits longer than %s between retries", step.Name, lintMaxTimeout)
+		}
+		return nil
+	})
+
+	if roots > 1 {
+		for _, step := range c.Steps {
+			if len(step.Depends) == 0 {
+				add(LintNoDepends, step.Name,
+					"step %q has no depends and runs in parallel with %d other steps",
+					step.Name, roots-1)
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,46 @@
+package dag
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLint(t *testing.T) {
+	l := &Loader{}
+	d, err := l.LoadData([]byte(`description: lint test
+maxCleanUpTimeSec: 7200
+steps:
+  - name: "1"
+    description: install
+    command: "sudo apt-get install -y jq"
+  - name: "2"
+    description: download
+    command: "curl -O https://example.com/data.json"
+  - name: "3"
+    command: "jq . data.json"
+    depends: ["1", "2"]
+    retryPolicy:
+      limit: 3
+      intervalSec: 86400
+`))
+	require.NoError(t, err)
+
+	require.Equal(t, []LintWarning{
+		{Code: LintLongTimeout, Message: "maxCleanUpTimeSec is longer than 1h0m0s"},
+		{Code: LintSudo, Step: "1", Message: `step "1" uses sudo; consider runAs instead`},
+		{Code: LintMissingDescription, Step: "3", Message: `step "3" has no description`},
+		{Code: LintLongTimeout, Step: "3", Message: `step "3" waits longer than 1h0m0s between retries`},
+		{Code: LintNoDepends, Step: "1", Message: `step "1" has no depends and runs in parallel with 1 other steps`},
+		{Code: LintNoDepends, Step: "2", Message: `step "2" has no depends and runs in parallel with 1 other steps`},
+	}, d.Lint())
+
+	d, err = l.LoadData([]byte(`description: clean DAG
+steps:
+  - name: "1"
+    description: echo
+    command: "echo pseudo sudoers"
+`))
+	require.NoError(t, err)
+	require.Empty(t, d.Lint())
+}
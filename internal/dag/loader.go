@@ -1,26 +1,89 @@
 package dag
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/imdario/mergo"
 	"github.com/mitchellh/mapstructure"
 	"github.com/yohamta/dagu/internal/utils"
 
-	"gopkg.in/yaml.v2"
+	yaml3 "gopkg.in/yaml.v3"
 )
 
 var ErrDAGNotFound = errors.New("DAG was not found")
 
+// ProjectFile is the name of the file in a DAGs directory that defines
+// the config shared by every DAG in the directory. It may also have the
+// .yml extension.
+const ProjectFile = "project.yaml"
+
+// projectFiles are the names of the project file in the order of the
+// precedence.
+var projectFiles = []string{ProjectFile, "project.yml"}
+
+// IsProjectFile returns true if the file is a project file, not a DAG.
+func IsProjectFile(file string) bool {
+	base := filepath.Base(file)
+	for _, f := range projectFiles {
+		if base == f {
+			return true
+		}
+	}
+	return false
+}
+
+// findProjectFile returns the path of the project file in the directory,
+// or an empty string if there is none. The directory is on fsys, or on
+// the OS file system if it's nil.
+func findProjectFile(dir string, fsys fs.FS) string {
+	for _, name := range projectFiles {
+		if fsys != nil {
+			if f := path.Join(dir, name); isFile(fsys, f) {
+				return f
+			}
+		} else if f := filepath.Join(dir, name); utils.FileExists(f) {
+			return f
+		}
+	}
+	return ""
+}
+
+func isFile(fsys fs.FS, file string) bool {
+	_, err := fs.Stat(fsys, file)
+	return err == nil
+}
+
 // Loader is a config loader.
 type Loader struct {
 	BaseConfig string
+	// Strict makes the YAML decoder reject duplicate keys in addition to
+	// the unknown keys that are always rejected.
+	Strict bool
+	// OnLoad is called after a DAG file is loaded, either successfully or
+	// not, with the path given to the loader and the time it took.
+	OnLoad func(path string, d *DAG, err error, dur time.Duration)
+	// LockFile makes the loader fail to load a DAG file whose checksum
+	// doesn't match the one recorded in the lock file.
+	LockFile string
+	// ReadDefinition returns the definition of the DAG recorded in the
+	// history of the run. It's required by LoadVersion.
+	ReadDefinition func(location, requestId string) (string, error)
+	// NoEval makes Load build the DAG without evaluating the variables,
+	// e.g. to preview an untrusted DAG file. No command in backticks is
+	// run and the values are kept as they are written.
+	NoEval bool
+
+	anchors baseAnchorCache
 }
 
 // Load loads config from file.
@@ -29,6 +92,8 @@ func (cl *Loader) Load(f, params string) (*DAG, error) {
 	return cl.loadDAG(f,
 		&BuildDAGOptions{
 			parameters: params,
+			noEval:     cl.NoEval,
+			noSetup:    cl.NoEval,
 		},
 	)
 }
@@ -40,23 +105,136 @@ func (cl *Loader) LoadWithoutEval(f string) (*DAG, error) {
 			parameters: "",
 			headOnly:   false,
 			noEval:     true,
-			noSetenv:   true,
+			noSetup:    true,
 		},
 	)
 }
 
-// LoadHeadOnly loads config from file and returns only the headline data.
+// LoadHeadOnly loads config from file and returns only the headline data,
+// e.g. the name, description, tags and schedules for listing the DAGs. No
+// variables are evaluated, so it doesn't run the commands in env or params.
 func (cl *Loader) LoadHeadOnly(f string) (*DAG, error) {
 	return cl.loadDAG(f,
 		&BuildDAGOptions{
 			parameters: "",
 			headOnly:   true,
 			noEval:     true,
-			noSetenv:   true,
+			noSetup:    true,
 		},
 	)
 }
 
+// metadataDef is the subset of the definition decoded by LoadMetadata.
+type metadataDef struct {
+	Name          string
+	Description   string
+	Tags          string
+	Schedule      interface{}
+	EnableSeconds bool
+}
+
+// LoadMetadata loads only the name, description, tags and schedules of
+// the DAG for listing many DAGs. It's lighter than LoadHeadOnly as the
+// other fields are not decoded at all. The YAML tags are resolved and the
+// anchors of the base config can be referred to as in Load, but the values
+// of the base config and the project file are not applied. No variables
+// are evaluated.
+func (cl *Loader) LoadMetadata(f string) (d *DAG, err error) {
+	if cl.OnLoad != nil {
+		start := time.Now()
+		defer func() { cl.OnLoad(f, d, err, time.Since(start)) }()
+	}
+	if !strings.HasSuffix(f, ".yaml") && !strings.HasSuffix(f, ".yml") {
+		f = fmt.Sprintf("%s.yaml", f)
+	}
+	file, err := filepath.Abs(f)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	doc, err := cl.parseWithBaseAnchors(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	var raw map[string]interface{}
+	if doc != nil {
+		if raw, err = cl.unmarshalNode(doc, file, nil); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+	}
+	md := &metadataDef{}
+	if err := mapstructure.WeakDecode(raw, md); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+
+	d = &DAG{Location: file}
+	d.Init()
+	d.Name = md.Name
+	if d.Name == "" {
+		d.Name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+	d.Description = md.Description
+	d.Tags = parseTags(md.Tags)
+	b := &builder{BuildDAGOptions: BuildDAGOptions{headOnly: true, noEval: true, noSetup: true}}
+	if err := b.buildSchedule(&configDefinition{
+		Schedule:      md.Schedule,
+		EnableSeconds: md.EnableSeconds,
+	}, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// LoadFS loads config from the file in the file system, e.g. embed.FS.
+// The base config is not applied as it is on the OS file system, but the
+// project file in the same directory of the file system is.
+func (cl *Loader) LoadFS(fsys fs.FS, name string) (d *DAG, err error) {
+	if cl.OnLoad != nil {
+		start := time.Now()
+		defer func() { cl.OnLoad(name, d, err, time.Since(start)) }()
+	}
+	if name == "" {
+		return nil, fmt.Errorf("config file was not specified")
+	}
+	if !strings.HasSuffix(name, ".yaml") && !strings.HasSuffix(name, ".yml") {
+		name = fmt.Sprintf("%s.yaml", name)
+	}
+	opts := &BuildDAGOptions{fsys: fsys}
+
+	base, err := cl.loadProjectConfig(path.Dir(name), nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := cl.readFS(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return cl.buildDAG(raw, base, name, opts)
+}
+
+// LoadVersion loads the DAG as it was when the run of the request id
+// started, from the definition recorded in the history. The values are
+// the evaluated ones, so no variables are evaluated again. The variables
+// resolved from secrets or commands are kept as they are written.
+func (cl *Loader) LoadVersion(d *DAG, requestId string) (*DAG, error) {
+	if cl.ReadDefinition == nil {
+		return nil, fmt.Errorf("no history to load the version of %s from", d.Name)
+	}
+	data, err := cl.ReadDefinition(d.Location, requestId)
+	if err != nil {
+		return nil, err
+	}
+	ret, err := cl.LoadData([]byte(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the version of %s: %w", requestId, err)
+	}
+	ret.Location = d.Location
+	return ret, nil
+}
+
 // LoadData loads config from given data.
 func (cl *Loader) LoadData(data []byte) (*DAG, error) {
 	raw, err := cl.unmarshalData(data)
@@ -74,12 +252,99 @@ func (cl *Loader) LoadData(data []byte) (*DAG, error) {
 		BuildDAGOptions: BuildDAGOptions{
 			headOnly: false,
 			noEval:   true,
-			noSetenv: true,
+			noSetup:  true,
 		},
 	}
 	return b.buildFromDefinition(def, nil)
 }
 
+// LoadYAML loads config from the YAML data with the variables evaluated
+// as Load does, but without touching the file system. The base config and
+// the project file are not applied, and the fields that refer to files
+// relative to the DAG file are rejected. The name overrides the name in
+// the data unless it's empty.
+func (cl *Loader) LoadYAML(data []byte, name, params string) (*DAG, error) {
+	raw, err := cl.unmarshalData(data)
+	if err != nil {
+		return nil, err
+	}
+	def, err := cl.decode(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := assertDef(def); err != nil {
+		return nil, err
+	}
+	if err := assertNoFileRefs(def); err != nil {
+		return nil, err
+	}
+
+	dst := &DAG{}
+	dst.Init()
+	b := builder{BuildDAGOptions: BuildDAGOptions{
+		parameters: params,
+		noSetup:    true,
+	}}
+	c, err := b.buildFromDefinition(def, dst)
+	if err != nil {
+		return nil, err
+	}
+	if c.LogDir != "" && !path.IsAbs(c.LogDir) {
+		return nil, fmt.Errorf("logDir must be an absolute path: %s", c.LogDir)
+	}
+	if err := cl.merge(dst, c); err != nil {
+		return nil, err
+	}
+	if name != "" {
+		dst.Name = name
+	}
+	dst.setup("")
+	return dst, nil
+}
+
+// assertNoFileRefs returns an error if the definition has the fields
+// that refer to files relative to the DAG file.
+func assertNoFileRefs(def *configDefinition) error {
+	if def.Dotenv != nil {
+		return fmt.Errorf("dotenv is not available without the DAG file")
+	}
+	if len(def.Include) > 0 {
+		return fmt.Errorf("include is not available without the DAG file")
+	}
+	for _, s := range def.Steps {
+		if s.ArgsFile != "" {
+			return fmt.Errorf("argsFile of step %s is not available without the DAG file", s.Name)
+		}
+	}
+	return nil
+}
+
+// LoadString loads config from the string. The base config is given
+// as YAML data instead of the file of BaseConfig. The variables are
+// evaluated as Load does unless NoEval is set.
+func (cl *Loader) LoadString(data, baseConfig string) (*DAG, error) {
+	opts := &BuildDAGOptions{
+		headOnly: false,
+		noEval:   cl.NoEval,
+		noSetup:  true,
+	}
+	var base *DAG
+	if baseConfig != "" {
+		raw, err := cl.unmarshalData([]byte(baseConfig))
+		if err != nil {
+			return nil, err
+		}
+		if base, err = cl.buildBaseConfig(raw, opts); err != nil {
+			return nil, err
+		}
+	}
+	raw, err := cl.unmarshalData([]byte(data))
+	if err != nil {
+		return nil, err
+	}
+	return cl.buildDAG(raw, base, "", opts)
+}
+
 func (cl *Loader) loadBaseConfig(file string, opts *BuildDAGOptions) (*DAG, error) {
 	if !utils.FileExists(file) {
 		return nil, nil
@@ -89,7 +354,10 @@ func (cl *Loader) loadBaseConfig(file string, opts *BuildDAGOptions) (*DAG, erro
 	if err != nil {
 		return nil, err
 	}
+	return cl.buildBaseConfig(raw, opts)
+}
 
+func (cl *Loader) buildBaseConfig(raw map[string]interface{}, opts *BuildDAGOptions) (*DAG, error) {
 	def, err := cl.decode(raw)
 	if err != nil {
 		return nil, err
@@ -104,7 +372,11 @@ func (cl *Loader) loadBaseConfig(file string, opts *BuildDAGOptions) (*DAG, erro
 	return b.buildFromDefinition(def, nil)
 }
 
-func (cl *Loader) loadDAG(f string, opts *BuildDAGOptions) (*DAG, error) {
+func (cl *Loader) loadDAG(f string, opts *BuildDAGOptions) (d *DAG, err error) {
+	if cl.OnLoad != nil {
+		start := time.Now()
+		defer func() { cl.OnLoad(f, d, err, time.Since(start)) }()
+	}
 	if f == "" {
 		return nil, fmt.Errorf("config file was not specified")
 	}
@@ -116,37 +388,191 @@ func (cl *Loader) loadDAG(f string, opts *BuildDAGOptions) (*DAG, error) {
 		return nil, err
 	}
 
-	var dst *DAG = nil
+	var base *DAG = nil
 
 	if !opts.headOnly && cl.BaseConfig != "" {
-		dst, err = cl.loadBaseConfig(cl.BaseConfig, opts)
+		base, err = cl.loadBaseConfig(cl.BaseConfig, opts)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	if dst == nil {
-		dst = &DAG{}
-		dst.Init()
+	// the project file is also applied to the headline, e.g. the
+	// schedule shared by the DAGs in the directory
+	if !IsProjectFile(file) {
+		base, err = cl.loadProjectConfig(filepath.Dir(file), base, opts)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	dst.Name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	// the same data is verified with the lock file and built
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	if cl.LockFile != "" {
+		lock, err := readLock(cl.LockFile)
+		if err != nil {
+			return nil, err
+		}
+		// the lock file is in the DAGs directory
+		key, err := lockKey(filepath.Dir(cl.LockFile), file)
+		if err != nil {
+			return nil, err
+		}
+		if err := cl.verifyChecksum(lock, key, file, data); err != nil {
+			return nil, err
+		}
+	}
 
-	raw, err := cl.load(file)
+	raw, err := cl.loadWithBaseAnchors(file, data)
+	if err != nil {
+		return nil, err
+	}
+	if d, err = cl.buildDAG(raw, base, file, opts); err != nil {
+		return nil, err
+	}
+	d.baseConfig = cl.BaseConfig
+	return d, nil
+}
+
+// loadWithBaseAnchors loads the data of the DAG file. If the DAG refers to
+// YAML anchors it doesn't define, the anchors of the base config are
+// visible to it.
+func (cl *Loader) loadWithBaseAnchors(file string, data []byte) (map[string]interface{}, error) {
+	doc, err := cl.parseWithBaseAnchors(data)
+	if err != nil {
+		return nil, err
+	}
+	return cl.unmarshalNode(doc, file, nil)
+}
+
+// parseWithBaseAnchors parses the data of a DAG file. It's parsed again
+// after the anchors of the base config only if it fails to be parsed by
+// itself, e.g. because of an alias of an unknown anchor.
+func (cl *Loader) parseWithBaseAnchors(data []byte) (*yaml3.Node, error) {
+	doc, err := parseYAML(data, nil)
+	if err == nil {
+		return doc, nil
+	}
+	anchors := cl.baseAnchors()
+	if anchors == nil {
+		return nil, err
+	}
+	return parseYAML(data, anchors)
+}
+
+// baseAnchorCache is the base config encoded again as a YAML document if
+// it defines anchors. It's kept until the file is modified.
+type baseAnchorCache struct {
+	mu      sync.Mutex
+	file    string
+	modTime time.Time
+	data    []byte
+}
+
+// baseAnchors returns the base config as a YAML document to be parsed
+// before the DAG, or nil if it has no anchors. It's encoded again from its
+// node tree, so that its document markers and directives don't matter.
+func (cl *Loader) baseAnchors() []byte {
+	if cl.BaseConfig == "" {
+		return nil
+	}
+	info, err := os.Stat(cl.BaseConfig)
+	if err != nil {
+		return nil
+	}
+	c := &cl.anchors
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.file == cl.BaseConfig && c.modTime.Equal(info.ModTime()) {
+		return c.data
+	}
+	c.file, c.modTime, c.data = cl.BaseConfig, info.ModTime(), nil
+	data, err := os.ReadFile(cl.BaseConfig)
+	if err != nil {
+		return nil
+	}
+	// the errors of the base config are reported when it's loaded.
+	doc, err := parseYAML(data, nil)
+	if err != nil || doc == nil || !hasAnchors(doc) {
+		return nil
+	}
+	if data, err = yaml3.Marshal(doc); err == nil {
+		c.data = data
+	}
+	return c.data
+}
+
+// loadProjectConfig applies the project file in the directory, if any,
+// on top of the base config.
+func (cl *Loader) loadProjectConfig(dir string, base *DAG, opts *BuildDAGOptions) (*DAG, error) {
+	file := findProjectFile(dir, opts.fsys)
+	if file == "" {
+		return base, nil
+	}
+	var raw map[string]interface{}
+	var err error
+	if opts.fsys != nil {
+		raw, err = cl.readFS(opts.fsys, file)
+	} else {
+		raw, err = cl.load(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	def, err := cl.decode(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	buildOpts := *opts
+	buildOpts.defaultEnv = utils.DefaultEnv()
+	b := &builder{
+		BuildDAGOptions: buildOpts,
+	}
+	p, err := b.buildFromDefinition(def, base)
 	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", path.Base(filepath.ToSlash(file)), err)
+	}
+	if base == nil {
+		return p, nil
+	}
+	if err := cl.merge(base, p); err != nil {
 		return nil, err
 	}
+	return base, nil
+}
+
+// buildDAG builds the DAG from the raw data and merges it into the base config.
+func (cl *Loader) buildDAG(raw map[string]interface{}, base *DAG, file string, opts *BuildDAGOptions) (*DAG, error) {
+	dst := base
+	if dst == nil {
+		dst = &DAG{}
+		dst.Init()
+	}
+
+	if file != "" {
+		dst.Name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
 
 	def, err := cl.decode(raw)
 	if err != nil {
 		return nil, err
 	}
 
+	if !opts.headOnly {
+		if err := cl.resolveIncludes(def, file, opts, nil); err != nil {
+			return nil, err
+		}
+	}
+
 	if err := assertDef(def); err != nil {
 		return nil, err
 	}
 
-	b := builder{BuildDAGOptions: *opts}
+	b := builder{BuildDAGOptions: *opts, file: file}
 	c, err := b.buildFromDefinition(def, dst)
 
 	if err != nil {
@@ -160,8 +586,16 @@ func (cl *Loader) loadDAG(f string, opts *BuildDAGOptions) (*DAG, error) {
 
 	dst.Location = file
 
-	if !opts.noSetenv {
-		dst.setup()
+	if !opts.noSetup {
+		if opts.fsys != nil {
+			// the directory on the file system doesn't exist on the OS.
+			dst.setup("")
+		} else {
+			dst.setup(path.Dir(file))
+			if err := dst.assertDirs(); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return dst, nil
@@ -187,7 +621,23 @@ func (mt *mergeTranformer) Transformer(typ reflect.Type) func(dst, src reflect.V
 func (cl *Loader) merge(dst, src *DAG) error {
 	err := mergo.Merge(dst, src, mergo.WithOverride,
 		mergo.WithTransformers(&mergeTranformer{}))
-	return err
+	if err != nil {
+		return err
+	}
+	// mergo doesn't merge unexported fields nor override with 0
+	if src.histRetentionSet {
+		dst.HistRetentionDays = src.HistRetentionDays
+		dst.histRetentionSet = true
+	}
+	if len(src.Env) > 0 {
+		dst.rawEnv = src.rawEnv
+	}
+	if src.RuntimeParams != "" {
+		dst.baseEnv = src.baseEnv
+		dst.defaultParams = src.defaultParams
+		dst.defaultParamEnv = src.defaultParamEnv
+	}
+	return nil
 }
 
 func (cl *Loader) load(file string) (config map[string]interface{}, err error) {
@@ -199,13 +649,68 @@ func (cl *Loader) readFile(file string) (config map[string]interface{}, err erro
 	if err != nil {
 		return nil, fmt.Errorf("%s: %v", file, err)
 	}
-	return cl.unmarshalData(data)
+	return cl.unmarshalFile(data, file, nil)
 }
 
+func (cl *Loader) readFS(fsys fs.FS, file string) (config map[string]interface{}, err error) {
+	data, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return cl.unmarshalFile(data, file, fsys)
+}
+
+// extensionPrefix is the prefix of the top-level keys which hold YAML
+// anchors to be merged elsewhere with the merge key, e.g. a step template.
+// Such keys are removed before the config is decoded. The other keys with
+// the prefix are unknown keys as usual.
+const extensionPrefix = "x-"
+
 func (cl *Loader) unmarshalData(data []byte) (map[string]interface{}, error) {
-	var cm map[string]interface{}
-	err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&cm)
-	return cm, err
+	return cl.unmarshalFile(data, "", nil)
+}
+
+// unmarshalFile unmarshals the data of the file after resolving the
+// custom tags. The files included by !include are read from fsys, or
+// from the OS file system if it's nil.
+func (cl *Loader) unmarshalFile(data []byte, file string, fsys fs.FS) (map[string]interface{}, error) {
+	doc, err := parseYAML(data, nil)
+	if err != nil {
+		return nil, err
+	}
+	return cl.unmarshalNode(doc, file, fsys)
+}
+
+// unmarshalNode unmarshals the node tree parsed from the file as
+// unmarshalFile does. It returns io.EOF if the file has no document.
+func (cl *Loader) unmarshalNode(doc *yaml3.Node, file string, fsys fs.FS) (map[string]interface{}, error) {
+	if doc == nil {
+		return nil, io.EOF
+	}
+	if err := resolveTags(doc, file, fsys); err != nil {
+		return nil, err
+	}
+	removeAnchorHolders(doc)
+	return decodeYAML(doc, cl.Strict)
+}
+
+// removeAnchorHolders removes the top-level keys with extensionPrefix
+// whose values define anchors. The aliases of the anchors still refer to
+// the removed nodes.
+func removeAnchorHolders(doc *yaml3.Node) {
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml3.MappingNode {
+		return
+	}
+	n := doc.Content[0]
+	content := n.Content[:0]
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		if k.Kind == yaml3.ScalarNode && strings.HasPrefix(k.Value, extensionPrefix) && hasAnchors(v) {
+			continue
+		}
+		content = append(content, k, v)
+	}
+	n.Content = content
 }
 
 func (cl *Loader) decode(cm map[string]interface{}) (*configDefinition, error) {
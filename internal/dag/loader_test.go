@@ -2,8 +2,11 @@ package dag
 
 import (
 	"fmt"
+	"os"
 	"path"
+	"path/filepath"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/stretchr/testify/require"
@@ -95,10 +98,22 @@ func TestLoadSignalOnStop(t *testing.T) {
 			want: "SIGINT",
 			err:  false,
 		},
+		{
+			sig:  "SIGHUP",
+			want: "SIGHUP",
+		},
+		{
+			sig:  "SIGTERM",
+			want: "SIGTERM",
+		},
 		{
 			sig: "2000",
 			err: true,
 		},
+		{
+			sig: "SIGUNKNOWN",
+			err: true,
+		},
 	} {
 		dat := fmt.Sprintf(`name: test DAG
 steps:
@@ -119,6 +134,1110 @@ steps:
 	}
 }
 
+func TestLoadDiskCondition(t *testing.T) {
+	dat := `steps:
+  - name: "1"
+    command: "true"
+    preconditions:
+      - disk:
+          path: /data
+          minFreeGB: 10
+`
+	l := &Loader{}
+	ret, err := l.LoadData([]byte(dat))
+	require.NoError(t, err)
+
+	cond := ret.Steps[0].Preconditions[0]
+	require.Equal(t, &DiskCondition{Path: "/data", MinFreeGB: 10}, cond.Disk)
+}
+
+func TestLoadRetryOnOutput(t *testing.T) {
+	dat := `steps:
+  - name: "1"
+    command: "true"
+    retryPolicy:
+      limit: 3
+      retryOnOutput: "connection reset"
+`
+	l := &Loader{}
+	ret, err := l.LoadData([]byte(dat))
+	require.NoError(t, err)
+	require.Equal(t, "connection reset", ret.Steps[0].RetryPolicy.RetryOnOutput)
+
+	// error
+	_, err = l.LoadData([]byte(`steps:
+  - name: "1"
+    command: "true"
+    retryPolicy:
+      retryOnOutput: "("
+`))
+	require.Error(t, err)
+}
+
+func TestLoadRetryJitter(t *testing.T) {
+	l := &Loader{}
+	ret, err := l.LoadData([]byte(`steps:
+  - name: "1"
+    command: "true"
+    retryPolicy:
+      limit: 3
+      intervalSec: 10
+      maxIntervalSec: 60
+      jitterMaxSec: 5
+`))
+	require.NoError(t, err)
+	require.Equal(t, time.Second*60, ret.Steps[0].RetryPolicy.MaxInterval)
+	require.Equal(t, time.Second*5, ret.Steps[0].RetryPolicy.JitterMax)
+
+	// error
+	_, err = l.LoadData([]byte(`steps:
+  - name: "1"
+    command: "true"
+    retryPolicy:
+      jitterMaxSec: -1
+`))
+	require.Error(t, err)
+}
+
+func TestLoadContinueOn(t *testing.T) {
+	l := &Loader{}
+	d, err := l.LoadData([]byte(`steps:
+  - name: cleanup
+    command: ./cleanup.sh
+    continueOn:
+      skipped: true
+      exitCode: [1, 2]
+  - name: "2"
+    command: "true"
+    continueOn:
+      failure: true
+`))
+	require.NoError(t, err)
+	require.Equal(t, ContinueOn{Skipped: true, ExitCode: []int{1, 2}}, d.Steps[0].ContinueOn)
+	require.Equal(t, ContinueOn{Failure: true}, d.Steps[1].ContinueOn)
+
+	for _, continueOn := range []string{
+		"{exitCode: [-1]}",
+		"{exitCode: [one]}",
+		"{exitCode: 1}",
+	} {
+		_, err := l.LoadData([]byte(fmt.Sprintf(`steps:
+  - name: "1"
+    command: "true"
+    continueOn: %s
+`, continueOn)))
+		require.Error(t, err, continueOn)
+	}
+}
+
+func TestLoadRetryMaxElapsed(t *testing.T) {
+	l := &Loader{}
+	ret, err := l.LoadData([]byte(`steps:
+  - name: "1"
+    command: "true"
+    retryPolicy:
+      intervalSec: 5
+      maxElapsedSec: 600
+`))
+	require.NoError(t, err)
+	require.Equal(t, 0, ret.Steps[0].RetryPolicy.Limit)
+	require.Equal(t, time.Second*600, ret.Steps[0].RetryPolicy.MaxElapsed)
+	require.Equal(t, 600, ret.Steps[0].toDefinition().RetryPolicy.MaxElapsedSec)
+
+	// error
+	_, err = l.LoadData([]byte(`steps:
+  - name: "1"
+    command: "true"
+    retryPolicy:
+      maxElapsedSec: -1
+`))
+	require.Error(t, err)
+}
+
+func TestLoadRetryBackoff(t *testing.T) {
+	l := &Loader{}
+	ret, err := l.LoadData([]byte(`steps:
+  - name: "1"
+    command: "true"
+    retryPolicy:
+      limit: 3
+      intervalSec: 1
+      exponentialBackoff: true
+`))
+	require.NoError(t, err)
+	require.Equal(t, 3, ret.Steps[0].RetryPolicy.Limit)
+	require.True(t, ret.Steps[0].RetryPolicy.ExponentialBackoff)
+
+	// error
+	_, err = l.LoadData([]byte(`steps:
+  - name: "1"
+    command: "true"
+    retryPolicy:
+      limit: -1
+`))
+	require.Error(t, err)
+}
+
+func TestLoadStepDir(t *testing.T) {
+	dat := `steps:
+  - name: "1"
+    command: "true"
+    dir: /tmp
+  - name: "2"
+    command: "true"
+    dir:
+      path: /tmp/work
+      create: true
+`
+	l := &Loader{}
+	ret, err := l.LoadData([]byte(dat))
+	require.NoError(t, err)
+	require.Equal(t, "/tmp", ret.Steps[0].Dir)
+	require.False(t, ret.Steps[0].CreateDir)
+	require.Equal(t, "/tmp/work", ret.Steps[1].Dir)
+	require.True(t, ret.Steps[1].CreateDir)
+
+	// error
+	_, err = l.LoadData([]byte(`steps:
+  - name: "1"
+    command: "true"
+    dir:
+      create: "yes"
+`))
+	require.Error(t, err)
+}
+
+func TestLoadStrict(t *testing.T) {
+	l := &Loader{Strict: true}
+	_, err := l.LoadData([]byte(`scheduel: "0 * * * *"
+steps:
+  - name: "1"
+    command: "true"
+`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "scheduel")
+
+	dat := []byte(`steps:
+  - name: "1"
+    command: "true"
+    command: "false"
+`)
+	_, err = l.LoadData(dat)
+	require.Error(t, err)
+
+	l.Strict = false
+	_, err = l.LoadData(dat)
+	require.NoError(t, err)
+}
+
+func TestLoadDescriptionTemplate(t *testing.T) {
+	dat := `steps:
+  - name: "1"
+    description: "Deploy to {{.Meta.region}}"
+    meta:
+      region: us-east-1
+    command: "true"
+  - name: "2"
+    description: "plain description"
+    command: "true"
+`
+	l := &Loader{}
+	ret, err := l.LoadData([]byte(dat))
+	require.NoError(t, err)
+	require.Equal(t, "Deploy to us-east-1", ret.Steps[0].Description)
+	require.Equal(t, "plain description", ret.Steps[1].Description)
+
+	// error
+	_, err = l.LoadData([]byte(`steps:
+  - name: "1"
+    description: "Deploy to {{.Meta.zone}}"
+    meta:
+      region: us-east-1
+    command: "true"
+`))
+	require.Error(t, err)
+}
+
+func TestLoadDuplicateStep(t *testing.T) {
+	l := &Loader{}
+	_, err := l.LoadData([]byte(`steps:
+  - name: "1"
+    command: "true"
+  - name: "1"
+    command: "true"
+`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "duplicate step name: 1")
+
+	_, err = l.LoadData([]byte(`steps:
+  - name: "1"
+    id: deploy
+    command: "true"
+  - name: "2"
+    id: deploy
+    command: "true"
+`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "duplicate step id: deploy")
+}
+
+func TestLoadProjectConfig(t *testing.T) {
+	l := &Loader{
+		BaseConfig: settings.MustGet(settings.SETTING__BASE_CONFIG),
+	}
+	dir := path.Join(testdataDir, "project")
+
+	for _, name := range []string{"a.yaml", "b.yaml"} {
+		d, err := l.Load(path.Join(dir, name), "")
+		require.NoError(t, err)
+		require.Contains(t, d.Env, "SHARED_VALUE=from_project")
+		require.Equal(t, "/tmp/dagu-project-logs", d.LogDir)
+	}
+
+	d, err := l.Load(path.Join(dir, "b.yaml"), "")
+	require.NoError(t, err)
+	require.Contains(t, d.Env, "OWN_VALUE=b")
+
+	require.True(t, IsProjectFile(path.Join(dir, ProjectFile)))
+	require.False(t, IsProjectFile(path.Join(dir, "a.yaml")))
+
+	require.True(t, IsProjectFile(path.Join(dir, "project.yml")))
+
+	// the project file with the .yml extension, which is also applied to
+	// the headline
+	tmp := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(tmp, "project.yml"),
+		[]byte("schedule: \"0 1 * * *\"\nenv:\n  - SHARED_VALUE: from_yml\n"), 0644))
+	file := path.Join(tmp, "a.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("steps:\n  - name: \"1\"\n    command: \"true\"\n"), 0644))
+	d, err = l.Load(file, "")
+	require.NoError(t, err)
+	require.Contains(t, d.Env, "SHARED_VALUE=from_yml")
+	d, err = l.LoadHeadOnly(file)
+	require.NoError(t, err)
+	require.Len(t, d.Schedule, 1)
+	require.Equal(t, "0 1 * * *", d.Schedule[0].Expression)
+}
+
+func TestLoadStepOutput(t *testing.T) {
+	l := &Loader{}
+
+	d, err := l.LoadData([]byte(`steps:
+  - name: "1"
+    command: "cat data.bin"
+    output:
+      name: DATA
+      encoding: base64
+      maxBytes: 65536
+      alertOnChange: true
+  - name: "2"
+    command: "echo hello"
+    output: OUT
+`))
+	require.NoError(t, err)
+	require.Equal(t, "DATA", d.Steps[0].Output)
+	require.Equal(t, OutputEncodingBase64, d.Steps[0].OutputEncoding)
+	require.Equal(t, 65536, d.Steps[0].OutputMaxBytes)
+	require.True(t, d.Steps[0].OutputAlertOnChange)
+	require.False(t, d.Steps[1].OutputAlertOnChange)
+	require.Equal(t, "OUT", d.Steps[1].Output)
+	require.Equal(t, "", d.Steps[1].OutputEncoding)
+
+	for _, output := range []string{
+		"{name: DATA, encoding: hex}",
+		"{name: DATA, maxBytes: -1}",
+		"{encoding: base64}",
+		"{name: DATA, size: 1}",
+		"{name: DATA, alertOnChange: yes please}",
+		"1RESULT",
+		"RESULT-X",
+		"{name: MY RESULT}",
+	} {
+		_, err := l.LoadData([]byte(fmt.Sprintf(`steps:
+  - name: "1"
+    command: "true"
+    output: %s
+`, output)))
+		require.Error(t, err, output)
+	}
+}
+
+func TestLoadArgsFile(t *testing.T) {
+	l := &Loader{}
+	d, err := l.Load(path.Join(testdataDir, "args", "args_file.yaml"), "")
+	require.NoError(t, err)
+
+	step := d.Steps[0]
+	require.Equal(t, "echo", step.Command)
+	require.Equal(t, "args.json", step.ArgsFile)
+	require.Equal(t, []string{"--name", "dagu", "two words", "3"}, step.FileArgs)
+	require.Equal(t, []string{"first", "--name", "dagu", "two words", "3"}, step.Args)
+
+	_, err = l.LoadData([]byte(`steps:
+  - name: "1"
+    command: "echo"
+    argsFile: not_existing.json
+`))
+	require.Error(t, err)
+}
+
+func TestLoadFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dags/project.yaml": &fstest.MapFile{Data: []byte(`env:
+  - LOAD_FS_SHARED: shared
+`)},
+		"dags/args.json": &fstest.MapFile{Data: []byte(`["--verbose"]`)},
+		"dags/embedded.yaml": &fstest.MapFile{Data: []byte(`description: embedded DAG
+params: P1
+steps:
+  - name: "1"
+    command: "echo ${LOAD_FS_SHARED}"
+    argsFile: args.json
+  - name: "2"
+    command: "echo $1"
+    depends: ["1"]
+`)},
+	}
+
+	l := &Loader{}
+	d, err := l.LoadFS(fsys, "dags/embedded")
+	require.NoError(t, err)
+	require.Equal(t, "embedded", d.Name)
+	require.Equal(t, "dags/embedded.yaml", d.Location)
+	require.Equal(t, "embedded DAG", d.Description)
+	require.Equal(t, []string{"P1"}, d.Params)
+	require.Contains(t, d.Env, "LOAD_FS_SHARED=shared")
+	require.Len(t, d.Steps, 2)
+	require.Equal(t, []string{"${LOAD_FS_SHARED}", "--verbose"}, d.Steps[0].Args)
+	require.Equal(t, []string{"1"}, d.Steps[1].Depends)
+	require.Equal(t, "", d.Steps[0].Dir)
+
+	_, err = l.LoadFS(fsys, "dags/not_existing.yaml")
+	require.Error(t, err)
+}
+
+func TestLoadInclude(t *testing.T) {
+	l := &Loader{}
+	dir := path.Join(testdataDir, "include")
+
+	d, err := l.Load(path.Join(dir, "main.yaml"), "")
+	require.NoError(t, err)
+	require.Len(t, d.Steps, 4)
+
+	names := []string{}
+	for _, s := range d.Steps {
+		names = append(names, s.Name)
+	}
+	require.Equal(t, []string{"common.setup", "common.teardown", "setup", "main"}, names)
+	require.Equal(t, "echo", d.Steps[0].Command)
+	require.Equal(t, []string{"common", "setup"}, d.Steps[0].Args)
+	require.Equal(t, []string{"common.setup"}, d.Steps[1].Depends)
+	require.Equal(t, []string{"setup", "common.teardown"}, d.Steps[3].Depends)
+
+	_, err = l.Load(path.Join(dir, "cycle_a.yaml"), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "include cycle detected")
+
+	// the included files must be in the directory of the DAG file
+	tmp := t.TempDir()
+	outside := path.Join(tmp, "outside.yaml")
+	require.NoError(t, os.WriteFile(outside, []byte("steps:\n  - name: \"1\"\n    command: \"true\"\n"), 0600))
+	require.NoError(t, os.Mkdir(path.Join(tmp, "dags"), 0755))
+	require.NoError(t, os.Symlink(outside, path.Join(tmp, "dags", "common.yaml")))
+	for _, inc := range []string{"../outside.yaml", outside, "common.yaml"} {
+		dag := path.Join(tmp, "dags", "main.yaml")
+		require.NoError(t, os.WriteFile(dag, []byte(fmt.Sprintf("include: [%q]\nsteps:\n  - name: \"2\"\n    command: \"true\"\n", inc)), 0600))
+		_, err = l.Load(dag, "")
+		require.Error(t, err, inc)
+		require.Contains(t, err.Error(), "must be inside", inc)
+	}
+}
+
+func TestLoadStdin(t *testing.T) {
+	l := &Loader{}
+	raw, err := l.unmarshalData([]byte(`env:
+  - INPUT_DIR: /tmp/input
+steps:
+  - name: "1"
+    command: "cat"
+    stdin: "data in ${INPUT_DIR}"
+  - name: "2"
+    command: "cat"
+    stdinFile: "${INPUT_DIR}/data.txt"
+`))
+	require.NoError(t, err)
+	def, err := l.decode(raw)
+	require.NoError(t, err)
+	d, err := (&builder{}).buildFromDefinition(def, nil)
+	require.NoError(t, err)
+	require.Equal(t, "data in /tmp/input", d.Steps[0].Stdin)
+	require.Equal(t, "/tmp/input/data.txt", d.Steps[1].StdinFile)
+
+	_, err = l.LoadData([]byte(`steps:
+  - name: "1"
+    command: "cat"
+    stdin: "data"
+    stdinFile: data.txt
+`))
+	require.Error(t, err)
+}
+
+func TestLoadArtifacts(t *testing.T) {
+	l := &Loader{}
+	d, err := l.LoadData([]byte(`steps:
+  - name: "1"
+    command: "make dist"
+    artifacts:
+      - dist/*.tar.gz
+      - /tmp/report.txt
+`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"dist/*.tar.gz", "/tmp/report.txt"}, d.Steps[0].Artifacts)
+
+	_, err = l.LoadData([]byte(`steps:
+  - name: "1"
+    command: "make dist"
+    artifacts: ["dist/[a-"]
+`))
+	require.Error(t, err)
+}
+
+func TestLoadLimits(t *testing.T) {
+	l := &Loader{}
+	d, err := l.LoadData([]byte(`steps:
+  - name: "1"
+    command: "true"
+    limits:
+      memoryMB: 512
+      nofile: 1024
+`))
+	require.NoError(t, err)
+	require.Equal(t, &Limits{MemoryMB: 512, Nofile: 1024}, d.Steps[0].Limits)
+
+	_, err = l.LoadData([]byte(`steps:
+  - name: "1"
+    command: "true"
+    limits:
+      memoryMB: -1
+`))
+	require.Error(t, err)
+}
+
+func TestLoadWorkingDir(t *testing.T) {
+	l := &Loader{}
+	d, err := l.Load(path.Join(testdataDir, "working_dir/working_dir.yaml"), "")
+	require.NoError(t, err)
+
+	subdir, err := filepath.Abs(path.Join(testdataDir, "working_dir/subdir"))
+	require.NoError(t, err)
+	require.Equal(t, subdir, d.WorkingDir)
+	require.Equal(t, subdir, d.Steps[0].Dir)
+	require.Equal(t, subdir, d.Steps[1].Dir)
+	require.Equal(t, "/tmp", d.Steps[2].Dir)
+
+	_, err = l.Load(path.Join(testdataDir, "working_dir/missing.yaml"), "")
+	require.Error(t, err)
+}
+
+func TestLoadDuplicateStepNames(t *testing.T) {
+	l := &Loader{}
+	_, err := l.LoadData([]byte(`steps:
+  - name: build
+    command: make
+  - name: test
+    command: make test
+  - name: build
+    command: make all
+  - name: test
+    command: make check
+`))
+	require.EqualError(t, err, "duplicate step name: build")
+
+	// the names are case sensitive
+	d, err := l.LoadData([]byte(`steps:
+  - name: build
+    command: make
+  - name: Build
+    command: make all
+`))
+	require.NoError(t, err)
+	require.Len(t, d.Steps, 2)
+}
+
+func TestLoadYAMLTags(t *testing.T) {
+	t.Setenv("DAGU_TEST_TAG_NAME", "tagged")
+	t.Setenv("DAGU_TEST_TAG_COMMAND", "echo 2")
+	dir := path.Join(testdataDir, "yaml_tags")
+
+	l := &Loader{}
+	d, err := l.Load(path.Join(dir, "tags.yaml"), "")
+	require.NoError(t, err)
+	require.Equal(t, "tagged", d.Name)
+	require.Len(t, d.Steps, 2)
+	require.Equal(t, "echo", d.Steps[0].Command)
+	require.Equal(t, "echo", d.Steps[1].Command)
+	require.Equal(t, []string{"2"}, d.Steps[1].Args)
+	require.Equal(t, []string{"1"}, d.Steps[1].Depends)
+
+	// the unset variable is empty and the default applies
+	require.Equal(t, path.Join(settings.MustGet(settings.SETTING__LOGS_DIR), "dags"), d.LogDir)
+
+	d, err = l.LoadData([]byte("name: !env DAGU_TEST_TAG_NAME\nsteps:\n  - name: \"1\"\n    command: \"true\"\n"))
+	require.NoError(t, err)
+	require.Equal(t, "tagged", d.Name)
+
+	_, err = l.Load(path.Join(dir, "cycle_a.yaml"), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "!include cycle detected")
+
+	_, err = l.Load(path.Join(dir, "traversal.yaml"), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "must be inside")
+
+	// !include needs the file to resolve the path from
+	_, err = l.LoadData([]byte("steps: !include steps/steps.yaml\n"))
+	require.Error(t, err)
+
+	// the other values are decoded as they are without the tags
+	d, err = l.LoadData([]byte(`name: !env DAGU_TEST_TAG_NAME
+steps:
+  - name: "1"
+    command: "true"
+    continueOn:
+      failure: yes
+`))
+	require.NoError(t, err)
+	require.True(t, d.Steps[0].ContinueOn.Failure)
+
+	_, err = (&Loader{Strict: true}).LoadData([]byte(`name: !env DAGU_TEST_TAG_NAME
+steps:
+  - name: "1"
+    name: "2"
+`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `line 4: key "name" already set in map`)
+
+	// the symbolic links must not lead out of the directory
+	tmp := t.TempDir()
+	outside := path.Join(tmp, "outside.yaml")
+	require.NoError(t, os.WriteFile(outside, []byte("- name: \"1\"\n  command: \"true\"\n"), 0600))
+	require.NoError(t, os.Mkdir(path.Join(tmp, "dags"), 0755))
+	require.NoError(t, os.Symlink(outside, path.Join(tmp, "dags", "steps.yaml")))
+	dag := path.Join(tmp, "dags", "symlink.yaml")
+	require.NoError(t, os.WriteFile(dag, []byte("steps: !include steps.yaml\n"), 0600))
+	_, err = l.Load(dag, "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "must be inside")
+}
+
+func TestLoadTagDepends(t *testing.T) {
+	l := &Loader{}
+	d, err := l.LoadData([]byte(`steps:
+  - name: extract-users
+    command: "true"
+    tags: extract
+  - name: extract-orders
+    command: "true"
+    tags: Extract, orders
+  - name: load
+    command: "true"
+    depends:
+      - tag:extract
+      - extract-users
+`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"extract"}, d.Steps[0].Tags)
+	require.Equal(t, []string{"extract", "orders"}, d.Steps[1].Tags)
+	require.Equal(t, []string{"extract-users", "extract-orders"}, d.Steps[2].Depends)
+
+	_, err = l.LoadData([]byte(`steps:
+  - name: load
+    command: "true"
+    depends:
+      - tag:missing
+`))
+	require.Error(t, err)
+}
+
+func TestLoadDependencyCycle(t *testing.T) {
+	l := &Loader{}
+	for _, tc := range []struct {
+		Steps string
+		Want  string
+	}{
+		{
+			Steps: `
+  - name: A
+    command: "true"
+    depends: [B]
+  - name: B
+    command: "true"
+    depends: [A]
+`,
+			Want: "cycle detected: A -> B -> A",
+		},
+		{
+			Steps: `
+  - name: X
+    command: "true"
+  - name: A
+    command: "true"
+    depends: [X, C]
+  - name: B
+    command: "true"
+    depends: [A]
+  - name: C
+    command: "true"
+    depends: [B]
+`,
+			Want: "cycle detected: A -> C -> B -> A",
+		},
+		{
+			Steps: `
+  - name: A
+    command: "true"
+    depends: [A]
+`,
+			Want: "cycle detected: A -> A",
+		},
+	} {
+		_, err := l.LoadData([]byte("steps:" + tc.Steps))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), tc.Want)
+	}
+
+	_, err := l.LoadData([]byte(`steps:
+  - name: A
+    command: "true"
+  - name: B
+    command: "true"
+    depends: [A]
+  - name: C
+    command: "true"
+    depends: [A, B]
+`))
+	require.NoError(t, err)
+}
+
+func TestLoadHTTPExecutor(t *testing.T) {
+	l := &Loader{}
+	d, err := l.LoadYAML([]byte(`env:
+  - BASE_URL: https://example.com
+  - TOKEN: secret
+steps:
+  - name: "1"
+    executor: http
+    command: post ${BASE_URL}/api
+    script: |
+      {
+        "timeout": 10,
+        "headers": {
+          "Authorization": "Bearer ${TOKEN}"
+        },
+        "query": {
+          "key": "value"
+        },
+        "body": "post body"
+      }
+  - name: "2"
+    executor: http
+    command: GET https://example.com/status
+    executorConfig:
+      headers:
+        Accept: application/json
+`), "", "")
+	require.NoError(t, err)
+	// the variables are expanded when it's run not to store the secrets
+	require.Equal(t, &HTTPConfig{
+		Method:  "POST",
+		URL:     "${BASE_URL}/api",
+		Headers: map[string]string{"Authorization": "Bearer ${TOKEN}"},
+		Query:   map[string]string{"key": "value"},
+		Body:    "post body",
+		Timeout: time.Second * 10,
+	}, d.Steps[0].HTTP)
+	require.Equal(t, &HTTPConfig{
+		Method:  "POST",
+		URL:     "https://example.com/api",
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+		Query:   map[string]string{"key": "value"},
+		Body:    "post body",
+		Timeout: time.Second * 10,
+	}, d.Steps[0].HTTP.Expand(NewEnvironment(d.Steps[0].Variables...)))
+	require.Equal(t, &HTTPConfig{
+		Method:  "GET",
+		URL:     "https://example.com/status",
+		Headers: map[string]string{"Accept": "application/json"},
+		Query:   map[string]string{},
+	}, d.Steps[1].HTTP)
+
+	for _, command := range []string{
+		"FETCH https://example.com",
+		"GET example.com",
+		"GET",
+		"GET ${INVALID_URL}",
+	} {
+		_, err := l.LoadYAML([]byte(fmt.Sprintf(`env:
+  - INVALID_URL: example.com
+steps:
+  - name: "1"
+    executor: http
+    command: %s
+`, command)), "", "")
+		require.Error(t, err, command)
+	}
+
+	// the URL which refers to the output of a previous step is validated
+	// when it's run
+	_, err = l.LoadYAML([]byte(`steps:
+  - name: "1"
+    command: echo https://example.com
+    output: HTTP_TEST_URL
+  - name: "2"
+    executor: http
+    command: GET ${HTTP_TEST_URL}
+    depends: ["1"]
+`), "", "")
+	require.NoError(t, err)
+}
+
+func TestLoadWebhooks(t *testing.T) {
+	l := &Loader{}
+	d, err := l.LoadYAML([]byte(`env:
+  - HOOK_HOST: hooks.example.com
+webhooks:
+  - url: https://${HOOK_HOST}/slack
+    format: slack
+  - url: https://hooks.example.com/generic
+  - url: https://hooks.example.com/custom
+    template: '{"text": {{ json .Summary }}}'
+steps:
+  - name: "1"
+    command: "true"
+`), "", "")
+	require.NoError(t, err)
+	require.Equal(t, []*Webhook{
+		{URL: "https://${HOOK_HOST}/slack", Format: WebhookFormatSlack},
+		{URL: "https://hooks.example.com/generic", Format: WebhookFormatGeneric},
+		{URL: "https://hooks.example.com/custom", Format: WebhookFormatCustom,
+			Template: `{"text": {{ json .Summary }}}`},
+	}, d.Webhooks)
+
+	for _, webhook := range []string{
+		"{url: https://example.com, format: teams}",
+		"{format: slack}",
+		"{url: https://example.com, format: custom}",
+		"{url: https://example.com, format: slack, template: x}",
+		"{url: https://example.com, template: '{{ .Name'}",
+	} {
+		_, err := l.LoadYAML([]byte(fmt.Sprintf(`webhooks: [%s]
+steps:
+  - name: "1"
+    command: "true"
+`, webhook)), "", "")
+		require.Error(t, err, webhook)
+	}
+}
+
+func TestLoadDotenv(t *testing.T) {
+	l := &Loader{}
+	d, err := l.Load(path.Join(testdataDir, "dotenv/dotenv.yaml"), "")
+	require.NoError(t, err)
+	require.Equal(t, []string{path.Join(testdataDir, "dotenv/.env")}, d.Dotenv)
+	for _, e := range []string{
+		"TOKEN=from-dotenv",
+		"REGION=us-east-1",
+		"OVERRIDDEN=from-env",
+		"ENDPOINT=us-east-1.example.com",
+		"R=us-east-1",
+	} {
+		require.Contains(t, d.Env, e)
+	}
+	require.NotContains(t, d.Env, "OVERRIDDEN=from-dotenv")
+
+	_, err = l.Load(path.Join(testdataDir, "dotenv/missing.yaml"), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "missing.env")
+}
+
+func TestLoadYAML(t *testing.T) {
+	l := &Loader{}
+	file := path.Join(testdataDir, "default.yaml")
+	dat, err := os.ReadFile(file)
+	require.NoError(t, err)
+
+	want, err := l.Load(file, "")
+	require.NoError(t, err)
+	want.Location = ""
+	_ = want.WalkSteps(func(s *Step) error {
+		s.Dir = ""
+		return nil
+	})
+
+	d, err := l.LoadYAML(dat, "default", "")
+	require.NoError(t, err)
+	require.Equal(t, want, d)
+
+	d, err = l.LoadYAML([]byte(`name: in-data
+env:
+  - VAR: "`+"`echo 1`"+`"
+params: x
+steps:
+  - name: "1"
+    command: "echo $1 $VAR"
+`), "", "y")
+	require.NoError(t, err)
+	require.Equal(t, "in-data", d.Name)
+	require.Contains(t, d.Env, "VAR=1")
+	require.Equal(t, []string{"y"}, d.Params)
+
+	for _, dat := range []string{
+		"dotenv: .env\nsteps:\n  - name: \"1\"\n    command: \"true\"\n",
+		"include: [common.yaml]\nsteps:\n  - name: \"1\"\n    command: \"true\"\n",
+		"logDir: logs\nsteps:\n  - name: \"1\"\n    command: \"true\"\n",
+		"steps:\n  - name: \"1\"\n    command: \"true\"\n    argsFile: args.json\n",
+	} {
+		_, err = l.LoadYAML([]byte(dat), "test", "")
+		require.Error(t, err, dat)
+	}
+}
+
+func TestLoadStepEnv(t *testing.T) {
+	l := &Loader{}
+	d, err := l.LoadYAML([]byte(`env:
+  - SHARED: shared
+steps:
+  - name: "1"
+    command: "true"
+    env:
+      - PRIVATE: ${SHARED}-private
+  - name: "2"
+    command: "true"
+handlerOn:
+  failure:
+    command: "true"
+`), "test", "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"PRIVATE=shared-private"}, d.Steps[0].Env)
+	require.Contains(t, d.Steps[0].Variables, "PRIVATE=shared-private")
+	require.Contains(t, d.Steps[0].Variables, "SHARED=shared")
+	require.NotContains(t, d.Steps[1].Variables, "PRIVATE=shared-private")
+	require.NotContains(t, d.HandlerOn.Failure.Variables, "PRIVATE=shared-private")
+	require.NotContains(t, d.Env, "PRIVATE=shared-private")
+}
+
+func TestLoadNoEval(t *testing.T) {
+	dir := t.TempDir()
+	marker := path.Join(dir, "evaluated")
+	file := path.Join(dir, "no_eval.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(`env:
+  - VAR: "`+"`touch "+marker+"`"+`"
+  - REF: ${VAR}-ref
+params: "`+"`echo 1`"+`"
+steps:
+  - name: "1"
+    command: "echo $VAR"
+`), 0644))
+
+	l := &Loader{NoEval: true}
+	d, err := l.Load(file, "")
+	require.NoError(t, err)
+	require.Contains(t, d.Env, "VAR=`touch "+marker+"`")
+	require.Contains(t, d.Env, "REF=`touch "+marker+"`-ref")
+	require.Equal(t, []string{"`echo 1`"}, d.Params)
+	require.NoFileExists(t, marker)
+	require.Empty(t, os.Getenv("REF"))
+}
+
+func TestLoadStepHooks(t *testing.T) {
+	l := &Loader{}
+	d, err := l.LoadYAML([]byte(`steps:
+  - name: deploy
+    command: "deploy.sh"
+    env:
+      - TARGET: prod
+    onFailure:
+      command: "rollback.sh $TARGET"
+    onSuccess:
+      name: notify
+      command: "notify.sh"
+`), "test", "")
+	require.NoError(t, err)
+	s := d.Steps[0]
+	require.Equal(t, "deploy.onFailure", s.OnFailure.Name)
+	require.Equal(t, "rollback.sh", s.OnFailure.Command)
+	require.Contains(t, s.OnFailure.Variables, "TARGET=prod")
+	require.Equal(t, "notify", s.OnSuccess.Name)
+
+	// the hooks are recorded in the definition
+	def, err := d.MarshalDefinition()
+	require.NoError(t, err)
+	loaded, err := l.LoadData([]byte(def))
+	require.NoError(t, err)
+	require.Equal(t, "deploy.onFailure", loaded.Steps[0].OnFailure.Name)
+	require.Equal(t, "notify", loaded.Steps[0].OnSuccess.Name)
+
+	_, err = l.LoadYAML([]byte(`steps:
+  - name: deploy
+    command: "deploy.sh"
+    onFailure:
+      command: "rollback.sh"
+      onFailure:
+        command: "alert.sh"
+`), "test", "")
+	require.Error(t, err)
+}
+
+func TestLoadCommandList(t *testing.T) {
+	l := &Loader{}
+	d, err := l.LoadYAML([]byte(`params: Z="A B C"
+steps:
+  - name: "1"
+    command: [echo, "A B C", "$Z", 1]
+  - name: "2"
+    command: echo "A B C"
+`), "test", "")
+	require.NoError(t, err)
+	s := d.Steps[0]
+	require.Equal(t, []string{"echo", "A B C", "$Z", "1"}, s.CmdArgv)
+	require.Empty(t, s.CmdWithArgs)
+	require.Equal(t, "echo", s.Command)
+	require.Equal(t, []string{"A B C", "$Z", "1"}, s.Args)
+	argv, err := s.ResolvedArgs(nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"echo", "A B C", "A B C", "1"}, argv)
+	require.Equal(t, "echo \"A B C\"", d.Steps[1].CmdWithArgs)
+
+	// the list is recorded in the definition
+	def, err := d.MarshalDefinition()
+	require.NoError(t, err)
+	loaded, err := l.LoadData([]byte(def))
+	require.NoError(t, err)
+	require.Equal(t, s.CmdArgv, loaded.Steps[0].CmdArgv)
+
+	// the numbers are kept as they are written
+	d, err = l.LoadYAML([]byte(`steps:
+  - name: "1"
+    command: [sleep, 1000000.0, 0.5, 9223372036854775807, 18446744073709551615]
+`), "test", "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"sleep", "1000000", "0.5",
+		"9223372036854775807", "18446744073709551615"}, d.Steps[0].CmdArgv)
+
+	for _, dat := range []string{
+		"steps:\n  - name: \"1\"\n    command: []\n",
+		"steps:\n  - name: \"1\"\n    command: [\"\", a]\n",
+		"steps:\n  - name: \"1\"\n    command: [echo, [a]]\n",
+		"steps:\n  - name: \"1\"\n    command: {a: b}\n",
+	} {
+		_, err = l.LoadYAML([]byte(dat), "test", "")
+		require.Error(t, err, dat)
+	}
+}
+
+func TestLoadOnLoad(t *testing.T) {
+	type call struct {
+		path string
+		d    *DAG
+		err  error
+		dur  time.Duration
+	}
+	calls := []call{}
+	l := &Loader{
+		OnLoad: func(path string, d *DAG, err error, dur time.Duration) {
+			calls = append(calls, call{path, d, err, dur})
+		},
+	}
+
+	file := path.Join(testdataDir, "default.yaml")
+	d, err := l.Load(file, "")
+	require.NoError(t, err)
+	require.Len(t, calls, 1)
+	require.Equal(t, file, calls[0].path)
+	require.Equal(t, d, calls[0].d)
+	require.NoError(t, calls[0].err)
+	require.Greater(t, calls[0].dur, time.Duration(0))
+
+	file = path.Join(testdataDir, "not_existing_file.yaml")
+	_, err = l.LoadHeadOnly(file)
+	require.Error(t, err)
+	require.Len(t, calls, 2)
+	require.Equal(t, file, calls[1].path)
+	require.Nil(t, calls[1].d)
+	require.Equal(t, err, calls[1].err)
+}
+
+func TestLoadAnchors(t *testing.T) {
+	dir := path.Join(testdataDir, "anchors")
+
+	l := &Loader{}
+	d, err := l.Load(path.Join(dir, "anchors.yaml"), "")
+	require.NoError(t, err)
+	require.Len(t, d.Steps, 2)
+	for _, s := range d.Steps {
+		require.Equal(t, "echo", s.Command)
+		require.Equal(t, []string{"common"}, s.Args)
+		require.Equal(t, "/tmp/common.log", s.Stdout)
+	}
+	require.Equal(t, []string{"1"}, d.Steps[1].Depends)
+	require.Contains(t, d.Env, "ANCHOR_ENV=shared")
+	require.Contains(t, d.Env, "ANCHOR_ENV_COPY=shared")
+
+	// the anchors of the base config are visible to the DAG
+	l = &Loader{BaseConfig: path.Join(dir, "base.yaml")}
+	d, err = l.Load(path.Join(dir, "base_anchors.yaml"), "")
+	require.NoError(t, err)
+	require.Len(t, d.Steps, 2)
+	require.Equal(t, "echo", d.Steps[0].Command)
+	require.Equal(t, "NOTIFY_OUT", d.Steps[0].Output)
+	require.Equal(t, "echo", d.Steps[1].Command)
+	require.Equal(t, "OTHER_OUT", d.Steps[1].Output)
+	require.Contains(t, d.Env, "ANCHOR_BASE_ENV=from_base")
+
+	_, err = (&Loader{}).Load(path.Join(dir, "base_anchors.yaml"), "")
+	require.Error(t, err)
+
+	// the document markers and directives don't matter
+	l = &Loader{BaseConfig: path.Join(dir, "base_document.yaml")}
+	for _, f := range []string{"base_anchors.yaml", "document_anchors.yaml"} {
+		d, err = l.Load(path.Join(dir, f), "")
+		require.NoError(t, err)
+		require.Equal(t, "echo", d.Steps[0].Command)
+		require.Equal(t, "NOTIFY_OUT", d.Steps[0].Output)
+
+		d, err = l.LoadMetadata(path.Join(dir, f))
+		require.NoError(t, err)
+		require.Equal(t, f[:len(f)-len(".yaml")], d.Name)
+	}
+
+	// the lines of the errors are the ones in the DAG file
+	l = &Loader{BaseConfig: path.Join(dir, "base.yaml"), Strict: true}
+	_, err = l.Load(path.Join(dir, "base_anchors_error.yaml"), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `line 4: key "name" already set in map`)
+}
+
+func TestLoadExtensionKeys(t *testing.T) {
+	l := &Loader{}
+	d, err := l.LoadData([]byte(`x-step: &step
+  command: "echo x"
+steps:
+  - <<: *step
+    name: "1"
+`))
+	require.NoError(t, err)
+	require.Equal(t, "echo", d.Steps[0].Command)
+
+	// the keys holding no anchors are unknown keys
+	_, err = l.LoadData([]byte(`x-note: not a template
+steps:
+  - name: "1"
+    command: "true"
+`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "x-note")
+}
+
 func TestLoadErrorFileNotExist(t *testing.T) {
 	l := &Loader{}
 	_, err := l.Load(path.Join(testdataDir, "not_existing_file.yaml"), "")
@@ -0,0 +1,254 @@
+package dag
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/yohamta/dagu/internal/utils"
+	"gopkg.in/yaml.v2"
+	yaml3 "gopkg.in/yaml.v3"
+)
+
+// LockFile is the default name of the lock file which records the
+// checksums of the approved DAG files in a directory.
+const LockFile = "dagu.lock"
+
+// Checksum returns the SHA-256 checksum of the inputs of the DAG: the
+// base config it was loaded with, the project file in the directory, the
+// DAG file and the files it includes.
+func (c *DAG) Checksum() (string, error) {
+	return (&Loader{BaseConfig: c.baseConfig}).fingerprint(c.Location, nil)
+}
+
+// fingerprint returns the SHA-256 checksum of the inputs the DAG file is
+// built from: the base config, the project file in the directory, the
+// DAG file and the files it includes by the include field or the
+// !include tag. The data is the content of the DAG file if it's already
+// read to be built, or nil to read it.
+func (cl *Loader) fingerprint(file string, data []byte) (string, error) {
+	if data == nil {
+		var err error
+		if data, err = os.ReadFile(file); err != nil {
+			return "", err
+		}
+	}
+	inputs := []string{}
+	if cl.BaseConfig != "" && utils.FileExists(cl.BaseConfig) {
+		inputs = append(inputs, cl.BaseConfig)
+	}
+	if p := findProjectFile(filepath.Dir(file), nil); !IsProjectFile(file) && p != "" {
+		inputs = append(inputs, p)
+	}
+	inputs, err := cl.collectInputs(file, data, inputs)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, f := range inputs {
+		b := data
+		if f != file {
+			if b, err = os.ReadFile(f); err != nil {
+				return "", err
+			}
+		}
+		fmt.Fprintf(h, "%d\n", len(b))
+		h.Write(b)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// collectInputs appends the file and the files it includes recursively.
+// The data is the content of the file, or nil to read it.
+func (cl *Loader) collectInputs(file string, data []byte, inputs []string) ([]string, error) {
+	for _, f := range inputs {
+		if f == file {
+			return inputs, nil
+		}
+	}
+	inputs = append(inputs, file)
+	if data == nil {
+		var err error
+		if data, err = os.ReadFile(file); err != nil {
+			return nil, err
+		}
+	}
+	doc, err := cl.parseWithBaseAnchors(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if doc == nil {
+		return inputs, nil
+	}
+	for _, inc := range includedFiles(doc, true) {
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(file), inc)
+		}
+		if inputs, err = cl.collectInputs(inc, nil, inputs); err != nil {
+			return nil, err
+		}
+	}
+	return inputs, nil
+}
+
+// includedFiles returns the files named by the !include tags in the node
+// tree and by the include field if the node is the top-level one.
+func includedFiles(n *yaml3.Node, top bool) []string {
+	ret := []string{}
+	if n.Tag == tagInclude && n.Kind == yaml3.ScalarNode {
+		return append(ret, strings.TrimSpace(n.Value))
+	}
+	if n.Kind == yaml3.DocumentNode {
+		for _, c := range n.Content {
+			ret = append(ret, includedFiles(c, top)...)
+		}
+		return ret
+	}
+	for i, c := range n.Content {
+		if top && n.Kind == yaml3.MappingNode && i%2 == 1 &&
+			n.Content[i-1].Value == "include" && c.Kind == yaml3.SequenceNode {
+			for _, inc := range c.Content {
+				ret = append(ret, inc.Value)
+			}
+			continue
+		}
+		ret = append(ret, includedFiles(c, false)...)
+	}
+	return ret
+}
+
+// dagFiles returns the paths of the DAG files in the directory and its
+// subdirectories relative to the directory.
+func dagFiles(dir string) ([]string, error) {
+	ret := []string{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !utils.MatchExtension(d.Name(), EXTENSIONS) || IsProjectFile(d.Name()) {
+			return nil
+		}
+		key, err := lockKey(dir, p)
+		if err != nil {
+			return err
+		}
+		ret = append(ret, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// lockKey returns the key of the DAG file in the lock file, which is the
+// path relative to the DAGs directory.
+func lockKey(dir, file string) (string, error) {
+	rel, err := filepath.Rel(dir, file)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// readLock reads the lock file, which maps the paths of the DAG files
+// relative to the DAGs directory to their fingerprints.
+func readLock(lockFile string) (map[string]string, error) {
+	data, err := os.ReadFile(lockFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock file: %w", err)
+	}
+	lock := map[string]string{}
+	if err := yaml.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("invalid lock file %s: %w", lockFile, err)
+	}
+	return lock, nil
+}
+
+// WriteLock records the fingerprints of the DAG files in the directory
+// to the lock file.
+func WriteLock(dir, lockFile string) error {
+	return (&Loader{}).WriteLock(dir, lockFile)
+}
+
+// WriteLock records the fingerprints of the DAG files in the directory
+// to the lock file. The fingerprints include the base config of the loader.
+func (cl *Loader) WriteLock(dir, lockFile string) error {
+	files, err := dagFiles(dir)
+	if err != nil {
+		return err
+	}
+	lock := map[string]string{}
+	for _, f := range files {
+		if lock[f], err = cl.fingerprint(filepath.Join(dir, filepath.FromSlash(f)), nil); err != nil {
+			return err
+		}
+	}
+	data, err := yaml.Marshal(lock)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(lockFile, data, 0644)
+}
+
+// VerifyLock verifies the DAG files in the directory against the lock
+// file. It returns the errors of the files whose checksums don't match,
+// the files missing in the lock file, and the locked files that don't
+// exist.
+func VerifyLock(dir, lockFile string) []error {
+	return (&Loader{}).VerifyLock(dir, lockFile)
+}
+
+// VerifyLock verifies the DAG files in the directory against the lock
+// file like VerifyLock. The fingerprints include the base config of the
+// loader.
+func (cl *Loader) VerifyLock(dir, lockFile string) []error {
+	lock, err := readLock(lockFile)
+	if err != nil {
+		return []error{err}
+	}
+	files, err := dagFiles(dir)
+	if err != nil {
+		return []error{err}
+	}
+	errs := []error{}
+	found := map[string]bool{}
+	for _, f := range files {
+		found[f] = true
+		if err := cl.verifyChecksum(lock, f, filepath.Join(dir, filepath.FromSlash(f)), nil); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	names := []string{}
+	for name := range lock {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !found[name] {
+			errs = append(errs, fmt.Errorf("%s: locked but not found", name))
+		}
+	}
+	return errs
+}
+
+func (cl *Loader) verifyChecksum(lock map[string]string, key, file string, data []byte) error {
+	want, ok := lock[key]
+	if !ok {
+		return fmt.Errorf("%s: not in the lock file", key)
+	}
+	sum, err := cl.fingerprint(file, data)
+	if err != nil {
+		return err
+	}
+	if sum != want {
+		return fmt.Errorf("%s: checksum mismatch with the lock file", key)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package dag
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yohamta/dagu/internal/utils"
+)
+
+func TestVerifyLock(t *testing.T) {
+	dir := utils.MustTempDir("dag-lock-test")
+	defer os.RemoveAll(dir)
+
+	a := path.Join(dir, "a.yaml")
+	b := path.Join(dir, "b.yaml")
+	lockFile := path.Join(dir, LockFile)
+	dat := "steps:\n  - name: \"1\"\n    command: \"true\"\n"
+	require.NoError(t, os.WriteFile(a, []byte(dat), 0644))
+	require.NoError(t, os.WriteFile(b, []byte(dat), 0644))
+	require.NoError(t, WriteLock(dir, lockFile))
+
+	// matching
+	require.Empty(t, VerifyLock(dir, lockFile))
+	l := &Loader{LockFile: lockFile}
+	d, err := l.Load(b, "")
+	require.NoError(t, err)
+	sum, err := d.Checksum()
+	require.NoError(t, err)
+	require.Len(t, sum, 64)
+
+	// drifted
+	require.NoError(t, os.WriteFile(b, []byte(dat+"    dir: /tmp\n"), 0644))
+	errs := VerifyLock(dir, lockFile)
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0].Error(), "b.yaml")
+	_, err = l.Load(b, "")
+	require.Error(t, err)
+	_, err = l.Load(a, "")
+	require.NoError(t, err)
+
+	// not locked and removed
+	require.NoError(t, os.WriteFile(path.Join(dir, "c.yaml"), []byte(dat), 0644))
+	require.NoError(t, os.Remove(a))
+	require.Len(t, VerifyLock(dir, lockFile), 3)
+
+	// no lock file
+	require.Len(t, VerifyLock(dir, path.Join(dir, "missing.lock")), 1)
+}
+
+func TestVerifyLockInputs(t *testing.T) {
+	dir := utils.MustTempDir("dag-lock-test")
+	defer os.RemoveAll(dir)
+
+	sub := path.Join(dir, "sub")
+	require.NoError(t, os.Mkdir(sub, 0755))
+	dat := "include:\n  - common.yaml\nsteps:\n  - name: \"1\"\n    command: \"true\"\n"
+	require.NoError(t, os.WriteFile(path.Join(dir, "a.yaml"), []byte(dat), 0644))
+	require.NoError(t, os.WriteFile(path.Join(sub, "a.yaml"), []byte(dat), 0644))
+	common := path.Join(sub, "common.yaml")
+	require.NoError(t, os.WriteFile(common, []byte("env:\n  - A: a\n"), 0644))
+	require.NoError(t, os.WriteFile(path.Join(dir, "common.yaml"), []byte("env:\n  - A: a\n"), 0644))
+
+	lockFile := path.Join(dir, LockFile)
+	l := &Loader{LockFile: lockFile}
+	require.NoError(t, l.WriteLock(dir, lockFile))
+	require.Empty(t, l.VerifyLock(dir, lockFile))
+
+	// the same named files are keyed by the relative paths
+	lock, err := readLock(lockFile)
+	require.NoError(t, err)
+	require.Contains(t, lock, "a.yaml")
+	require.Contains(t, lock, "sub/a.yaml")
+
+	// the included file is changed
+	require.NoError(t, os.WriteFile(common, []byte("env:\n  - A: b\n"), 0644))
+	errs := l.VerifyLock(dir, lockFile)
+	require.Len(t, errs, 2)
+	require.Contains(t, errs[0].Error(), "sub/a.yaml")
+	_, err = l.Load(path.Join(sub, "a.yaml"), "")
+	require.Error(t, err)
+	_, err = l.Load(path.Join(dir, "a.yaml"), "")
+	require.NoError(t, err)
+
+	// the project file is changed
+	require.NoError(t, l.WriteLock(dir, lockFile))
+	require.NoError(t, os.WriteFile(path.Join(dir, ProjectFile), []byte("env:\n  - B: b\n"), 0644))
+	errs = l.VerifyLock(dir, lockFile)
+	require.Len(t, errs, 2)
+	require.Contains(t, errs[0].Error(), "a.yaml:")
+	require.Contains(t, errs[1].Error(), "common.yaml:")
+}
+
+func TestChecksumBaseConfig(t *testing.T) {
+	dir := t.TempDir()
+	file := path.Join(dir, "a.yaml")
+	base := path.Join(dir, "base.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("steps:\n  - name: \"1\"\n    command: \"true\"\n"), 0644))
+	require.NoError(t, os.WriteFile(base, []byte("env:\n  - A: \"1\"\n"), 0644))
+
+	d, err := (&Loader{}).Load(file, "")
+	require.NoError(t, err)
+	sum, err := d.Checksum()
+	require.NoError(t, err)
+
+	// the base config the DAG was loaded with is an input
+	d, err = (&Loader{BaseConfig: base}).Load(file, "")
+	require.NoError(t, err)
+	withBase, err := d.Checksum()
+	require.NoError(t, err)
+	require.NotEqual(t, sum, withBase)
+
+	require.NoError(t, os.WriteFile(base, []byte("env:\n  - A: \"2\"\n"), 0644))
+	changed, err := d.Checksum()
+	require.NoError(t, err)
+	require.NotEqual(t, withBase, changed)
+}
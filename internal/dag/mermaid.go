@@ -0,0 +1,36 @@
+package dag
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MarshalMermaid returns the dependency graph of the DAG
+// in Mermaid flowchart syntax.
+func (c *DAG) MarshalMermaid() string {
+	ids := map[string]string{}
+	var sb strings.Builder
+	sb.WriteString("graph TD\n")
+	for i, s := range c.Steps {
+		id := fmt.Sprintf("step%d", i)
+		ids[s.Name] = id
+		sb.WriteString(fmt.Sprintf("\t%s[\"%s\"]\n", id, escapeMermaidLabel(s.Name)))
+	}
+	for _, s := range c.Steps {
+		for _, dep := range s.Depends {
+			if from, ok := ids[dep]; ok {
+				sb.WriteString(fmt.Sprintf("\t%s --> %s\n", from, ids[s.Name]))
+			}
+		}
+	}
+	return sb.String()
+}
+
+var mermaidLabelReplacer = strings.NewReplacer(
+	`"`, "#quot;",
+	"\n", " ",
+)
+
+func escapeMermaidLabel(label string) string {
+	return mermaidLabelReplacer.Replace(label)
+}
@@ -0,0 +1,79 @@
+package dag
+
+import (
+	"sort"
+	"time"
+)
+
+// ScheduleKind is the kind of a schedule event.
+type ScheduleKind string
+
+const (
+	ScheduleKindStart   ScheduleKind = "start"
+	ScheduleKindStop    ScheduleKind = "stop"
+	ScheduleKindRestart ScheduleKind = "restart"
+)
+
+// ScheduleEvent is a time when the DAG is started, stopped, or restarted
+// by the scheduler.
+type ScheduleEvent struct {
+	Time time.Time
+	Kind ScheduleKind
+}
+
+// Prev returns the last time of the schedule before the given time. It
+// returns the zero time if there is none within a year.
+func (s *Schedule) Prev(t time.Time) time.Time {
+	next := s.Parsed.Next(t)
+	if next.IsZero() {
+		return time.Time{}
+	}
+	// look back twice the interval, and further until a time is found.
+	for back := next.Sub(t) * 2; back <= time.Hour*24*366; back *= 2 {
+		prev := time.Time{}
+		for n := s.Parsed.Next(t.Add(-back)); !n.IsZero() && n.Before(t); n = s.Parsed.Next(n) {
+			prev = n
+		}
+		if !prev.IsZero() {
+			return prev
+		}
+	}
+	return time.Time{}
+}
+
+// ScheduleEvents returns the next n events of the start, stop, and
+// restart schedules after the given time in chronological order. The
+// events at the same time are ordered by start, stop, and restart.
+func (c *DAG) ScheduleEvents(n int, from time.Time) []ScheduleEvent {
+	ret := []ScheduleEvent{}
+	if n <= 0 {
+		return ret
+	}
+	for _, s := range []struct {
+		kind      ScheduleKind
+		schedules []*Schedule
+	}{
+		{ScheduleKindStart, c.Schedule},
+		{ScheduleKindStop, c.StopSchedule},
+		{ScheduleKindRestart, c.RestartSchedule},
+	} {
+		for _, sc := range s.schedules {
+			// no more than n events of a schedule can be in the result
+			t := from
+			for i := 0; i < n; i++ {
+				t = sc.Parsed.Next(t)
+				if t.IsZero() {
+					break
+				}
+				ret = append(ret, ScheduleEvent{Time: t, Kind: s.kind})
+			}
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Time.Before(ret[j].Time)
+	})
+	if len(ret) > n {
+		ret = ret[:n]
+	}
+	return ret
+}
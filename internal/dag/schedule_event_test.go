@@ -0,0 +1,67 @@
+package dag
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduleEvents(t *testing.T) {
+	l := &Loader{}
+	d, err := l.LoadData([]byte(`schedule:
+  start: "0 1 * * *"
+  stop: "0 2 * * *"
+  restart: "0 12 * * *"
+steps:
+  - name: "1"
+    command: "true"
+`))
+	require.NoError(t, err)
+
+	day := func(d, h int) time.Time {
+		return time.Date(2022, 1, d, h, 0, 0, 0, time.Local)
+	}
+	from := day(1, 0)
+	require.Equal(t, []ScheduleEvent{
+		{Time: day(1, 1), Kind: ScheduleKindStart},
+		{Time: day(1, 2), Kind: ScheduleKindStop},
+		{Time: day(1, 12), Kind: ScheduleKindRestart},
+		{Time: day(2, 1), Kind: ScheduleKindStart},
+		{Time: day(2, 2), Kind: ScheduleKindStop},
+	}, d.ScheduleEvents(5, from))
+
+	// the events at the same time are ordered by kind
+	d, err = l.LoadData([]byte(`schedule:
+  start: "0 1 * * *"
+  stop: "0 1 * * *"
+steps:
+  - name: "1"
+    command: "true"
+`))
+	require.NoError(t, err)
+	require.Equal(t, []ScheduleEvent{
+		{Time: day(1, 1), Kind: ScheduleKindStart},
+		{Time: day(1, 1), Kind: ScheduleKindStop},
+	}, d.ScheduleEvents(2, from))
+
+	require.Empty(t, d.ScheduleEvents(0, from))
+}
+
+func TestSchedulePrev(t *testing.T) {
+	for _, tc := range []struct {
+		expr string
+		t    time.Time
+		want time.Time
+	}{
+		{"CRON_TZ=UTC 0 * * * *", time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC), time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC)},
+		{"CRON_TZ=UTC 0 * * * *", time.Date(2022, 1, 1, 10, 30, 0, 0, time.UTC), time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)},
+		{"CRON_TZ=UTC 0 9 1 * *", time.Date(2022, 3, 1, 9, 0, 0, 0, time.UTC), time.Date(2022, 2, 1, 9, 0, 0, 0, time.UTC)},
+		{"CRON_TZ=UTC 0 9 * * 1-5", time.Date(2022, 1, 3, 9, 0, 0, 0, time.UTC), time.Date(2021, 12, 31, 9, 0, 0, 0, time.UTC)},
+	} {
+		parsed, err := cronParser.Parse(tc.expr)
+		require.NoError(t, err)
+		s := &Schedule{Expression: tc.expr, Parsed: parsed}
+		require.Equal(t, tc.want, s.Prev(tc.t).UTC(), tc.expr)
+	}
+}
@@ -0,0 +1,88 @@
+package dag
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// SecretProvider resolves a secret reference to its value.
+type SecretProvider interface {
+	Resolve(ref string) (string, error)
+}
+
+var secretProviders = make(map[string]SecretProvider)
+
+// RegisterSecretProvider registers a provider for env values
+// in the form of "@<scheme>:<ref>".
+func RegisterSecretProvider(scheme string, p SecretProvider) {
+	secretProviders[scheme] = p
+}
+
+// resolveSecret returns the secret value if val refers to a
+// registered provider. Otherwise it returns val as is.
+func resolveSecret(val string) (string, bool, error) {
+	if !strings.HasPrefix(val, "@") {
+		return val, false, nil
+	}
+	kv := strings.SplitN(val[1:], ":", 2)
+	if len(kv) != 2 {
+		return val, false, nil
+	}
+	p, ok := secretProviders[kv[0]]
+	if !ok {
+		return val, false, nil
+	}
+	ret, err := p.Resolve(kv[1])
+	if err != nil {
+		return "", false, fmt.Errorf("failed to resolve secret %s: %w", val, err)
+	}
+	registerSecretValue(ret)
+	return ret, true, nil
+}
+
+var (
+	secretValuesMu sync.RWMutex
+	secretValues   = map[string]struct{}{}
+)
+
+func registerSecretValue(val string) {
+	if val == "" {
+		return
+	}
+	secretValuesMu.Lock()
+	defer secretValuesMu.Unlock()
+	secretValues[val] = struct{}{}
+}
+
+// IsSecretValue returns true if the value was resolved from a secret provider.
+func IsSecretValue(val string) bool {
+	secretValuesMu.RLock()
+	defer secretValuesMu.RUnlock()
+	_, ok := secretValues[val]
+	return ok
+}
+
+// RedactSecrets replaces secret values in the string with asterisks.
+func RedactSecrets(s string) string {
+	secretValuesMu.RLock()
+	defer secretValuesMu.RUnlock()
+	for v := range secretValues {
+		s = strings.ReplaceAll(s, v, "*****")
+	}
+	return s
+}
+
+// keyringProvider resolves references in the form of "<service>/<user>"
+// from the OS keyring.
+type keyringProvider struct {
+	get func(service, user string) (string, error)
+}
+
+func (p *keyringProvider) Resolve(ref string) (string, error) {
+	kv := strings.SplitN(ref, "/", 2)
+	if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+		return "", fmt.Errorf("invalid keyring reference: %s", ref)
+	}
+	return p.get(kv[0], kv[1])
+}
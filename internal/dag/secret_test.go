@@ -0,0 +1,60 @@
+package dag
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type mockKeyring map[string]string
+
+func (m mockKeyring) get(service, user string) (string, error) {
+	if v, ok := m[service+"/"+user]; ok {
+		return v, nil
+	}
+	return "", fmt.Errorf("secret not found")
+}
+
+func TestKeyringEnv(t *testing.T) {
+	orig := secretProviders["keyring"]
+	defer func() {
+		secretProviders["keyring"] = orig
+	}()
+	RegisterSecretProvider("keyring", &keyringProvider{
+		get: mockKeyring{"myapp/token": "s3cr3t"}.get,
+	})
+
+	l := &Loader{}
+	d, err := l.unmarshalData([]byte(`
+env:
+  - TOKEN: "@keyring:myapp/token"
+`))
+	require.NoError(t, err)
+
+	def, err := l.decode(d)
+	require.NoError(t, err)
+
+	b := &builder{}
+	ret, err := b.buildFromDefinition(def, nil)
+	require.NoError(t, err)
+
+	v, _ := b.env.Lookup("TOKEN")
+	require.Equal(t, "s3cr3t", v)
+	require.Contains(t, ret.Env, "TOKEN=s3cr3t")
+	require.True(t, IsSecretValue("s3cr3t"))
+	require.NotContains(t, ret.String(), "s3cr3t")
+
+	// error
+	d, err = l.unmarshalData([]byte(`
+env:
+  - TOKEN: "@keyring:myapp/missing"
+`))
+	require.NoError(t, err)
+
+	def, err = l.decode(d)
+	require.NoError(t, err)
+
+	_, err = b.buildFromDefinition(def, nil)
+	require.Error(t, err)
+}
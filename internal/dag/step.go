@@ -2,39 +2,120 @@ package dag
 
 import (
 	"fmt"
+	"math"
+	"math/rand"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/yohamta/dagu/internal/utils"
 )
 
 // Step represents a step in a DAG.
 type Step struct {
-	Name            string
-	Description     string
-	Variables       []string
+	ID          string
+	Name        string
+	Description string
+	Meta        map[string]string
+	// Tags are the tags of the step, which other steps can depend on
+	// with "tag:<name>" in depends.
+	Tags      []string
+	Variables []string
+	// Env are the variables private to the step, which are also included
+	// in Variables. They are not visible to the other steps or handlers.
+	Env             []string
 	OutputVariables *sync.Map
 	Dir             string
+	CreateDir       bool
 	Executor        string
 	ExecutorConfig  map[string]interface{}
-	CmdWithArgs     string
-	Command         string
-	Script          string
-	Stdout          string
-	Stderr          string
-	Output          string
-	Args            []string
-	Depends         []string
-	ContinueOn      ContinueOn
-	RetryPolicy     *RetryPolicy
-	RepeatPolicy    RepeatPolicy
-	MailOnError     bool
-	Preconditions   []*Condition
-	SignalOnStop    string
+	// HTTP is the request of the step with the http executor.
+	HTTP                *HTTPConfig
+	CmdWithArgs         string
+	Command             string
+	Script              string
+	Stdout              string
+	Stderr              string
+	Stdin               string
+	StdinFile           string
+	Artifacts           []string
+	Output              string
+	OutputEncoding      string
+	OutputMaxBytes      int
+	OutputAlertOnChange bool
+	Args                []string
+	ArgsFile            string
+	FileArgs            []string
+	Depends             []string
+	ContinueOn          ContinueOn
+	RetryPolicy         *RetryPolicy
+	RepeatPolicy        RepeatPolicy
+	MailOnError         bool
+	Preconditions       []*Condition
+	SignalOnStop        string
+	RunAs               string
+	Umask               *int
+	Timeout             time.Duration
+	Limits              *Limits
+	// CmdArgv is the command and the arguments given as a list. Each of
+	// them is a single argument without the shell word-splitting, and
+	// CmdWithArgs is empty.
+	CmdArgv []string
+	// OnSuccess and OnFailure are the hooks run right after the step
+	// succeeds or fails, before the handlers of the DAG.
+	OnSuccess *Step
+	OnFailure *Step
+
+	// rawEnv are the values of Env as written in the definition, which
+	// are resolved from secrets or commands.
+	rawEnv map[string]string
+}
+
+// Limits are the resource limits applied to the process of a step.
+// A zero value means no limit.
+type Limits struct {
+	// MemoryMB is the maximum size of the virtual memory in megabytes.
+	MemoryMB int
+	// Nofile is the maximum number of open files.
+	Nofile int
 }
 
+// OutputEncodingBase64 is the output encoding to capture the output
+// of a step as base64 encoded string.
+const OutputEncodingBase64 = "base64"
+
 type RetryPolicy struct {
-	Limit    int
-	Interval time.Duration
+	Limit         int
+	Interval      time.Duration
+	MaxInterval   time.Duration
+	JitterMax     time.Duration
+	RetryOnOutput string
+	// ExponentialBackoff doubles the interval on each retry.
+	ExponentialBackoff bool
+	// MaxElapsed stops the retries once the time since the first attempt
+	// exceeds it. The retries are not limited by count if Limit is 0.
+	MaxElapsed time.Duration
+}
+
+// Delay returns the interval before the n-th retry, starting from 1.
+// With ExponentialBackoff the interval is doubled on each retry. The
+// interval is capped at MaxInterval and a random jitter up to JitterMax
+// is added.
+func (p *RetryPolicy) Delay(n int) time.Duration {
+	d := p.Interval
+	for i := 1; p.ExponentialBackoff && i < n && d > 0 && d <= math.MaxInt64/2; i++ {
+		d *= 2
+		if p.MaxInterval > 0 && d > p.MaxInterval {
+			break
+		}
+	}
+	if p.MaxInterval > 0 && d > p.MaxInterval {
+		d = p.MaxInterval
+	}
+	if p.JitterMax > 0 {
+		d += time.Duration(rand.Int63n(int64(p.JitterMax) + 1))
+	}
+	return d
 }
 
 type RepeatPolicy struct {
@@ -45,6 +126,9 @@ type RepeatPolicy struct {
 type ContinueOn struct {
 	Failure bool
 	Skipped bool
+	// ExitCode are the exit codes of the failures to continue on even
+	// if Failure is false.
+	ExitCode []int
 }
 
 func (s *Step) String() string {
@@ -54,5 +138,151 @@ func (s *Step) String() string {
 	vals = append(vals, fmt.Sprintf("Command: %s", s.Command))
 	vals = append(vals, fmt.Sprintf("Args: %s", s.Args))
 	vals = append(vals, fmt.Sprintf("Depends: [%s]", strings.Join(s.Depends, ", ")))
+	if s.Timeout > 0 {
+		vals = append(vals, fmt.Sprintf("Timeout: %s", s.Timeout))
+	}
 	return strings.Join(vals, "\t")
 }
+
+// ResolvedArgs returns the program and the arguments the step runs after
+// expanding the variables with the environment and splitting the command
+// string like a shell. The command and the arguments of a step without
+// the command string are expanded as they are. The command substitutions
+// are not evaluated and the script file is not included, so nothing is
+// run. The variables of the step are used if env is nil.
+func (s *Step) ResolvedArgs(env *Environment) ([]string, error) {
+	if env == nil {
+		env = NewEnvironment(s.Variables...)
+	}
+	var argv []string
+	if len(s.CmdArgv) > 0 {
+		for _, a := range s.CmdArgv {
+			argv = append(argv, env.Expand(a))
+		}
+		argv = append(argv, s.FileArgs...)
+	} else if s.CmdWithArgs != "" {
+		program, args, err := utils.SplitCommandArgs(env.Expand(s.CmdWithArgs))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the command of step %s: %w", s.Name, err)
+		}
+		argv = append([]string{program}, args...)
+		argv = append(argv, s.FileArgs...)
+	} else {
+		argv = append(argv, env.Expand(s.Command))
+		for _, a := range s.Args {
+			argv = append(argv, env.Expand(a))
+		}
+	}
+	if argv[0] == "" {
+		return nil, fmt.Errorf("step %s has no command", s.Name)
+	}
+	return argv, nil
+}
+
+// commandString returns the command of the step as it's written. The
+// command given as a list is joined by spaces.
+func (s *Step) commandString() string {
+	if len(s.CmdArgv) > 0 {
+		return strings.Join(s.CmdArgv, " ")
+	}
+	return s.CmdWithArgs
+}
+
+func (s *Step) toDefinition() *stepDef {
+	if s == nil {
+		return nil
+	}
+	def := &stepDef{
+		Id:          s.ID,
+		Name:        s.Name,
+		Description: s.Description,
+		Executor:    s.Executor,
+		Command:     s.CmdWithArgs,
+		Script:      s.Script,
+		Stdout:      s.Stdout,
+		Stderr:      s.Stderr,
+		Stdin:       s.Stdin,
+		StdinFile:   s.StdinFile,
+		Artifacts:   s.Artifacts,
+		ContinueOn: &continueOnDef{
+			Failure:  s.ContinueOn.Failure,
+			Skipped:  s.ContinueOn.Skipped,
+			ExitCode: s.ContinueOn.ExitCode,
+		},
+		RepeatPolicy: &repeatPolicyDef{
+			Repeat:      s.RepeatPolicy.Repeat,
+			IntervalSec: int(s.RepeatPolicy.Interval / time.Second),
+		},
+		Meta:          s.Meta,
+		MailOnError:   s.MailOnError,
+		Preconditions: conditionsToDefinition(s.Preconditions),
+		RunAs:         s.RunAs,
+		ArgsFile:      s.ArgsFile,
+		OnSuccess:     s.OnSuccess.toDefinition(),
+		OnFailure:     s.OnFailure.toDefinition(),
+	}
+	if len(s.CmdArgv) > 0 {
+		argv := []interface{}{}
+		for _, a := range s.CmdArgv {
+			argv = append(argv, a)
+		}
+		def.Command = argv
+	}
+	if s.OutputEncoding != "" || s.OutputMaxBytes > 0 || s.OutputAlertOnChange {
+		output := map[interface{}]interface{}{"name": s.Output}
+		if s.OutputEncoding != "" {
+			output["encoding"] = s.OutputEncoding
+		}
+		if s.OutputMaxBytes > 0 {
+			output["maxBytes"] = s.OutputMaxBytes
+		}
+		if s.OutputAlertOnChange {
+			output["alertOnChange"] = true
+		}
+		def.Output = output
+	} else if s.Output != "" {
+		def.Output = s.Output
+	}
+	if s.Timeout > 0 {
+		def.Timeout = s.Timeout.String()
+	}
+	if s.CreateDir {
+		def.Dir = map[interface{}]interface{}{"path": s.Dir, "create": true}
+	} else if s.Dir != "" {
+		def.Dir = s.Dir
+	}
+	if len(s.ExecutorConfig) > 0 {
+		def.ExecutorConfig = s.ExecutorConfig
+	}
+	if len(s.Depends) > 0 {
+		def.Depends = s.Depends
+	}
+	if len(s.Tags) > 0 {
+		def.Tags = strings.Join(s.Tags, ",")
+	}
+	if len(s.Env) > 0 {
+		def.Env = envToDefinition(s.Env, s.rawEnv)
+	}
+	if s.Limits != nil {
+		def.Limits = &limitsDef{
+			MemoryMB: s.Limits.MemoryMB,
+			Nofile:   s.Limits.Nofile,
+		}
+	}
+	if s.RetryPolicy != nil {
+		def.RetryPolicy = &retryPolicyDef{
+			Limit:              s.RetryPolicy.Limit,
+			IntervalSec:        int(s.RetryPolicy.Interval / time.Second),
+			MaxIntervalSec:     int(s.RetryPolicy.MaxInterval / time.Second),
+			JitterMaxSec:       int(s.RetryPolicy.JitterMax / time.Second),
+			RetryOnOutput:      s.RetryPolicy.RetryOnOutput,
+			ExponentialBackoff: s.RetryPolicy.ExponentialBackoff,
+			MaxElapsedSec:      int(s.RetryPolicy.MaxElapsed / time.Second),
+		}
+	}
+	if s.SignalOnStop != "" {
+		sig := s.SignalOnStop
+		def.SignalOnStop = &sig
+	}
+	return def
+}
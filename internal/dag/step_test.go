@@ -0,0 +1,65 @@
+package dag
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := &RetryPolicy{
+		Interval:    time.Second * 10,
+		MaxInterval: time.Second * 5,
+		JitterMax:   time.Second * 2,
+	}
+	for i := 0; i < 1000; i++ {
+		d := p.Delay(1)
+		require.GreaterOrEqual(t, d, p.MaxInterval)
+		require.LessOrEqual(t, d, p.MaxInterval+p.JitterMax)
+	}
+
+	p = &RetryPolicy{Interval: time.Second}
+	require.Equal(t, time.Second, p.Delay(1))
+}
+
+func TestRetryPolicyExponentialBackoff(t *testing.T) {
+	p := &RetryPolicy{
+		Interval:           time.Second,
+		MaxInterval:        time.Second * 5,
+		ExponentialBackoff: true,
+	}
+	for i, want := range []time.Duration{
+		time.Second, time.Second * 2, time.Second * 4, time.Second * 5, time.Second * 5,
+	} {
+		require.Equal(t, want, p.Delay(i+1))
+	}
+
+	p = &RetryPolicy{Interval: time.Second, ExponentialBackoff: true}
+	require.Equal(t, time.Second*8, p.Delay(4))
+	require.Greater(t, p.Delay(1000), time.Duration(0))
+}
+
+func TestStepResolvedArgs(t *testing.T) {
+	env := NewEnvironment("NAME=dagu", "GREETING=hello world")
+
+	step := &Step{Name: "1", CmdWithArgs: "echo \"hello world\" ${NAME} '$GREETING' `date`"}
+	argv, err := step.ResolvedArgs(env)
+	require.NoError(t, err)
+	require.Equal(t, []string{"echo", "hello world", "dagu", "hello world", "`date`"}, argv)
+
+	// the arguments of the list are not split
+	step = &Step{Name: "2", Command: "echo", Args: []string{"${GREETING}", "a b"}}
+	argv, err = step.ResolvedArgs(env)
+	require.NoError(t, err)
+	require.Equal(t, []string{"echo", "hello world", "a b"}, argv)
+
+	step = &Step{Name: "3", CmdWithArgs: "echo ${NAME}", Variables: []string{"NAME=step"}}
+	argv, err = step.ResolvedArgs(nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"echo", "step"}, argv)
+
+	step = &Step{Name: "4", CmdWithArgs: `echo "unclosed`}
+	_, err = step.ResolvedArgs(env)
+	require.Error(t, err)
+}
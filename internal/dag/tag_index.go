@@ -0,0 +1,45 @@
+package dag
+
+import (
+	"sort"
+	"strings"
+)
+
+// TagIndex maps the tags to the DAGs having them for the lookup of the
+// DAGs by tag. The tags are normalized in lowercase as in DAG.Tags.
+type TagIndex struct {
+	dags map[string][]*DAG
+}
+
+// NewTagIndex returns the index of the tags of the DAGs. The DAGs are
+// listed in the given order under each tag.
+func NewTagIndex(dags []*DAG) *TagIndex {
+	idx := &TagIndex{dags: map[string][]*DAG{}}
+	for _, d := range dags {
+		seen := map[string]bool{}
+		for _, tag := range d.Tags {
+			if seen[tag] {
+				continue
+			}
+			seen[tag] = true
+			idx.dags[tag] = append(idx.dags[tag], d)
+		}
+	}
+	return idx
+}
+
+// ByTag returns the DAGs having the tag. The tag is matched case
+// insensitively.
+func (idx *TagIndex) ByTag(tag string) []*DAG {
+	return idx.dags[strings.ToLower(strings.TrimSpace(tag))]
+}
+
+// AllTags returns the tags of all DAGs in sorted order.
+func (idx *TagIndex) AllTags() []string {
+	ret := make([]string, 0, len(idx.dags))
+	for tag := range idx.dags {
+		ret = append(ret, tag)
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,41 @@
+package dag
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTagIndex(t *testing.T) {
+	l := &Loader{}
+	var dags []*DAG
+	for _, tc := range []struct {
+		Name string
+		Tags string
+	}{
+		{Name: "a", Tags: "Daily, ETL"},
+		{Name: "b", Tags: "daily, daily"},
+		{Name: "c", Tags: "Monthly"},
+		{Name: "d", Tags: ""},
+	} {
+		d, err := l.LoadData([]byte(fmt.Sprintf(`name: %s
+tags: %s
+steps:
+  - name: "1"
+    command: "true"
+`, tc.Name, tc.Tags)))
+		require.NoError(t, err)
+		dags = append(dags, d)
+	}
+
+	idx := NewTagIndex(dags)
+	require.Equal(t, []string{"daily", "etl", "monthly"}, idx.AllTags())
+	require.Equal(t, []*DAG{dags[0], dags[1]}, idx.ByTag("daily"))
+	require.Equal(t, []*DAG{dags[0], dags[1]}, idx.ByTag(" DAILY "))
+	require.Equal(t, []*DAG{dags[0]}, idx.ByTag("etl"))
+	require.Equal(t, []*DAG{dags[2]}, idx.ByTag("monthly"))
+	require.Empty(t, idx.ByTag("weekly"))
+
+	require.Empty(t, NewTagIndex(nil).AllTags())
+}
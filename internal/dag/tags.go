@@ -0,0 +1,179 @@
+package dag
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	yaml3 "gopkg.in/yaml.v3"
+)
+
+const (
+	// tagEnv is the YAML tag of a scalar replaced by the value of the
+	// environment variable it names, e.g. `!env HOME`.
+	tagEnv = "!env"
+	// tagInclude is the YAML tag of a scalar replaced by the content of
+	// the YAML file it names, e.g. `!include steps.yaml`. The path is
+	// relative to the including file and must not leave the directory
+	// of the DAG file.
+	tagInclude = "!include"
+)
+
+// tagResolver resolves the custom tags of a YAML node tree in place
+// before it's decoded.
+type tagResolver struct {
+	fsys fs.FS
+	// root is the directory the included files must be in.
+	root string
+	// stack is the files being included to detect cycles.
+	stack []string
+	// aliased is the nodes of the aliases already resolved.
+	aliased map[*yaml3.Node]bool
+}
+
+// resolveTags resolves the custom tags of the node tree. The file is the
+// path of the data, which is empty when it's not read from a file.
+func resolveTags(doc *yaml3.Node, file string, fsys fs.FS) error {
+	r := &tagResolver{fsys: fsys, aliased: map[*yaml3.Node]bool{}}
+	if file != "" {
+		r.root = r.dir(file)
+		r.stack = []string{file}
+	}
+	return r.resolve(doc, file)
+}
+
+func (r *tagResolver) resolve(n *yaml3.Node, file string) error {
+	switch n.Tag {
+	case tagEnv:
+		if n.Kind != yaml3.ScalarNode {
+			return fmt.Errorf("line %d: %s must be a scalar", n.Line, tagEnv)
+		}
+		// the value is resolved as if it were written in place
+		n.Value = os.Getenv(strings.TrimSpace(n.Value))
+		n.Tag = ""
+		n.Style = 0
+		return nil
+	case tagInclude:
+		if n.Kind != yaml3.ScalarNode {
+			return fmt.Errorf("line %d: %s must be a scalar", n.Line, tagInclude)
+		}
+		included, err := r.include(strings.TrimSpace(n.Value), file)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n.Line, err)
+		}
+		*n = *included
+		return nil
+	}
+	if n.Kind == yaml3.AliasNode {
+		// the anchor may be defined out of the tree, e.g. in the base config
+		if r.aliased[n.Alias] {
+			return nil
+		}
+		r.aliased[n.Alias] = true
+		return r.resolve(n.Alias, file)
+	}
+	for _, c := range n.Content {
+		if err := r.resolve(c, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *tagResolver) include(name, file string) (*yaml3.Node, error) {
+	if file == "" {
+		return nil, fmt.Errorf("%s %s: not supported without a DAG file", tagInclude, name)
+	}
+	f, err := r.path(name, file)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range r.stack {
+		if s == f {
+			return nil, fmt.Errorf("%s cycle detected: %s", tagInclude,
+				strings.Join(append(r.stack, f), " -> "))
+		}
+	}
+	var data []byte
+	if r.fsys != nil {
+		data, err = fs.ReadFile(r.fsys, f)
+	} else {
+		data, err = os.ReadFile(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to include %s: %w", name, err)
+	}
+	var doc yaml3.Node
+	if err := yaml3.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to include %s: %w", name, err)
+	}
+	if len(doc.Content) == 0 {
+		return &yaml3.Node{Kind: yaml3.ScalarNode, Tag: "!!null"}, nil
+	}
+	r.stack = append(r.stack, f)
+	defer func() { r.stack = r.stack[:len(r.stack)-1] }()
+	if err := r.resolve(doc.Content[0], f); err != nil {
+		return nil, err
+	}
+	return doc.Content[0], nil
+}
+
+// path returns the path of the included file relative to the including
+// file. It's an error if the path leaves the root directory, also by a
+// symbolic link.
+func (r *tagResolver) path(name, file string) (string, error) {
+	outside := fmt.Errorf("%s %s: the path must be inside %s", tagInclude, name, r.root)
+	if path.IsAbs(name) || filepath.IsAbs(name) {
+		return "", outside
+	}
+	if r.fsys != nil {
+		f := path.Join(path.Dir(file), name)
+		if !isWithin(r.root, f) {
+			return "", outside
+		}
+		return f, nil
+	}
+	f := filepath.Join(filepath.Dir(file), name)
+	ok, err := isWithinRealPath(r.root, f)
+	if err != nil {
+		return "", fmt.Errorf("failed to include %s: %w", name, err)
+	}
+	if !ok {
+		return "", outside
+	}
+	return f, nil
+}
+
+// isWithin returns true if the path is in the directory lexically.
+func isWithin(dir, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && rel != ".." &&
+		!strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// isWithinRealPath returns true if the file is in the directory after
+// the symbolic links of both are resolved.
+func isWithinRealPath(dir, file string) (bool, error) {
+	if !isWithin(dir, file) {
+		return false, nil
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return false, err
+	}
+	realFile, err := filepath.EvalSymlinks(file)
+	if err != nil {
+		return false, err
+	}
+	return isWithin(realDir, realFile), nil
+}
+
+func (r *tagResolver) dir(file string) string {
+	if r.fsys != nil {
+		return path.Dir(file)
+	}
+	return filepath.Dir(file)
+}
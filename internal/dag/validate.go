@@ -0,0 +1,75 @@
+package dag
+
+import (
+	"fmt"
+)
+
+// Validate re-checks the invariants of the built DAG and returns all
+// the problems found, unlike the build which stops at the first one.
+// It returns nil if the DAG is valid.
+func (c *DAG) Validate() []error {
+	var errs []error
+	if len(c.Steps) == 0 {
+		errs = append(errs, fmt.Errorf("at least one step must be specified"))
+	}
+
+	names := map[string]bool{}
+	for _, s := range c.Steps {
+		if s.Name == "" {
+			errs = append(errs, fmt.Errorf("step name must be specified"))
+			continue
+		}
+		if names[s.Name] {
+			errs = append(errs, fmt.Errorf("duplicate step name: %s", s.Name))
+		}
+		names[s.Name] = true
+	}
+	for _, s := range c.Steps {
+		for _, dep := range s.Depends {
+			if !names[dep] {
+				errs = append(errs, fmt.Errorf("step %s depends on unknown step: %s", s.Name, dep))
+			}
+		}
+	}
+	if err := assertNoCycle(c.Steps); err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, schedules := range []struct {
+		kind      string
+		schedules []*Schedule
+	}{
+		{scheduleStart, c.Schedule},
+		{scheduleStop, c.StopSchedule},
+		{scheduleRestart, c.RestartSchedule},
+	} {
+		for _, s := range schedules.schedules {
+			if !c.validSchedule(s) {
+				expr := ""
+				if s != nil {
+					expr = s.Expression
+				}
+				errs = append(errs, fmt.Errorf("invalid %s schedule: %q", schedules.kind, expr))
+			}
+		}
+	}
+	return errs
+}
+
+// validSchedule returns true if the schedule is parsed and its expression
+// is parsed again by the parser for EnableSeconds. The business day
+// schedule has no expression to parse.
+func (c *DAG) validSchedule(s *Schedule) bool {
+	if s == nil || s.Parsed == nil {
+		return false
+	}
+	if _, ok := s.Parsed.(*BusinessDaySchedule); ok {
+		return true
+	}
+	parser := cronParser
+	if c.EnableSeconds {
+		parser = cronParserWithSeconds
+	}
+	_, err := parseSchedule(parser, []string{s.Expression})
+	return err == nil
+}
@@ -0,0 +1,53 @@
+package dag
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	l := &Loader{}
+	d, err := l.LoadData([]byte(`schedule: "0 1 * * *"
+steps:
+  - name: build
+    command: make
+  - name: test
+    command: make test
+    depends:
+      - build
+`))
+	require.NoError(t, err)
+	require.Nil(t, d.Validate())
+
+	// a duplicated step name and an invalid schedule
+	d.Steps = append(d.Steps, &Step{Name: "build", Command: "make"})
+	d.Schedule = append(d.Schedule, &Schedule{Expression: "0 25 * * *"})
+	errs := d.Validate()
+	require.Len(t, errs, 2)
+	require.EqualError(t, errs[0], "duplicate step name: build")
+	require.EqualError(t, errs[1], `invalid start schedule: "0 25 * * *"`)
+
+	// the expression is parsed again, not only checked to be parsed
+	d.Steps = d.Steps[:2]
+	d.Schedule = []*Schedule{
+		{Expression: "0 25 * * *", Parsed: d.Schedule[0].Parsed},
+		{Expression: "@every 0s", Parsed: d.Schedule[0].Parsed},
+		{Expression: "0 0 1 * * *", Parsed: d.Schedule[0].Parsed},
+	}
+	errs = d.Validate()
+	require.Len(t, errs, 3)
+	d.EnableSeconds = true
+	require.Len(t, d.Validate(), 2)
+
+	d = &DAG{Steps: []*Step{
+		{Name: "a", Depends: []string{"b"}},
+		{Name: "b", Depends: []string{"a", "c"}},
+	}}
+	errs = d.Validate()
+	require.Len(t, errs, 2)
+	require.EqualError(t, errs[0], "step b depends on unknown step: c")
+	require.EqualError(t, errs[1], "cycle detected: a -> b -> a")
+
+	require.Len(t, (&DAG{}).Validate(), 1)
+}
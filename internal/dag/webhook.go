@@ -0,0 +1,88 @@
+package dag
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/template"
+)
+
+// Webhook is an endpoint the result of a run is posted to.
+type Webhook struct {
+	// URL is kept as it's written, and expanded with the env of the DAG
+	// only when the webhook is sent, so that the tokens in the variables
+	// don't end up in the status or the definition of the DAG.
+	URL string
+	// Format is the name of the template of the payload. Template is the
+	// text/template of the payload when Format is WebhookFormatCustom.
+	Format   string
+	Template string
+}
+
+const (
+	WebhookFormatGeneric = "generic"
+	WebhookFormatSlack   = "slack"
+	WebhookFormatDiscord = "discord"
+	WebhookFormatCustom  = "custom"
+)
+
+type webhookDef struct {
+	URL      string `yaml:"url,omitempty"`
+	Format   string `yaml:"format,omitempty"`
+	Template string `yaml:"template,omitempty"`
+}
+
+// WebhookFuncs are the functions available in the webhook templates.
+var WebhookFuncs = template.FuncMap{
+	"json": jsonString,
+}
+
+// jsonString returns v encoded as JSON so that it can be embedded in a
+// JSON payload without escaping issues.
+func jsonString(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+func (b *builder) buildWebhooks(def *configDefinition, d *DAG) error {
+	for i, w := range def.Webhooks {
+		if w.URL == "" {
+			return fmt.Errorf("webhooks[%d].url is required", i)
+		}
+		wh := &Webhook{
+			URL:      w.URL,
+			Format:   w.Format,
+			Template: w.Template,
+		}
+		if wh.Format == "" {
+			wh.Format = WebhookFormatGeneric
+			if wh.Template != "" {
+				wh.Format = WebhookFormatCustom
+			}
+		}
+		switch wh.Format {
+		case WebhookFormatGeneric, WebhookFormatSlack, WebhookFormatDiscord:
+			if wh.Template != "" {
+				return fmt.Errorf("webhooks[%d].template is only allowed for the %s format", i, WebhookFormatCustom)
+			}
+		case WebhookFormatCustom:
+			if wh.Template == "" {
+				return fmt.Errorf("webhooks[%d].template is required for the %s format", i, WebhookFormatCustom)
+			}
+			if _, err := template.New("webhook").Funcs(WebhookFuncs).Parse(wh.Template); err != nil {
+				return fmt.Errorf("invalid webhooks[%d].template: %w", i, err)
+			}
+		default:
+			return fmt.Errorf("invalid webhooks[%d].format: %s", i, wh.Format)
+		}
+		d.Webhooks = append(d.Webhooks, wh)
+	}
+	return nil
+}
+
+func (c *DAG) webhooksToDefinition() []*webhookDef {
+	var ret []*webhookDef
+	for _, w := range c.Webhooks {
+		ret = append(ret, &webhookDef{URL: w.URL, Format: w.Format, Template: w.Template})
+	}
+	return ret
+}
@@ -0,0 +1,322 @@
+package dag
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	yaml3 "gopkg.in/yaml.v3"
+)
+
+// parseYAML parses the first document of the data into a node tree. It
+// returns nil if the data has no document. The anchors are the data of a
+// YAML document defining anchors the data may refer to, or nil. It's
+// parsed before the data in the same stream so that the parser resolves
+// the aliases, and the lines of the nodes and of the errors are made
+// relative to the data again.
+func parseYAML(data, anchors []byte) (*yaml3.Node, error) {
+	var (
+		r      io.Reader = bytes.NewReader(data)
+		offset int
+	)
+	if anchors != nil {
+		sep := "...\n"
+		if !hasDocumentStart(data) {
+			sep += "---\n"
+		}
+		offset = bytes.Count(anchors, []byte("\n")) + strings.Count(sep, "\n")
+		r = io.MultiReader(bytes.NewReader(anchors), strings.NewReader(sep), r)
+	}
+	dec := yaml3.NewDecoder(r)
+	if anchors != nil {
+		if err := dec.Decode(&yaml3.Node{}); err != nil {
+			return nil, err
+		}
+	}
+	doc := &yaml3.Node{}
+	if err := dec.Decode(doc); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, shiftErrorLine(err, offset)
+	}
+	shiftLines(doc, offset)
+	return doc, nil
+}
+
+// hasDocumentStart returns true if the data begins with directives or a
+// document start marker, following only blank and comment lines.
+func hasDocumentStart(data []byte) bool {
+	for _, line := range strings.Split(string(data), "\n") {
+		l := strings.TrimSpace(line)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		return strings.HasPrefix(l, "%") || l == "---" ||
+			strings.HasPrefix(l, "--- ") || strings.HasPrefix(l, "---\t")
+	}
+	return false
+}
+
+var errorLinePattern = regexp.MustCompile(`^yaml: line (\d+):`)
+
+func shiftErrorLine(err error, offset int) error {
+	if offset == 0 {
+		return err
+	}
+	m := errorLinePattern.FindStringSubmatch(err.Error())
+	if m == nil {
+		return err
+	}
+	line, _ := strconv.Atoi(m[1])
+	if line <= offset {
+		return err
+	}
+	return fmt.Errorf("yaml: line %d:%s", line-offset, err.Error()[len(m[0]):])
+}
+
+// shiftLines subtracts the offset from the lines of the node tree. The
+// nodes of the aliases are not in the tree, so they are left as they are.
+func shiftLines(n *yaml3.Node, offset int) {
+	if offset == 0 {
+		return
+	}
+	n.Line -= offset
+	for _, c := range n.Content {
+		shiftLines(c, offset)
+	}
+}
+
+// hasAnchors returns true if any node in the tree defines an anchor.
+func hasAnchors(n *yaml3.Node) bool {
+	if n.Anchor != "" {
+		return true
+	}
+	for _, c := range n.Content {
+		if hasAnchors(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// yamlDecoder decodes a node tree of yaml.v3 into the same values as
+// yaml.v2 decodes the YAML data into. The plain scalars are typed by the
+// YAML 1.1 rules of yaml.v2, e.g. `yes` is a bool, and the duplicate keys
+// are errors in the strict mode.
+type yamlDecoder struct {
+	strict bool
+	// terrors are the errors of the values that are skipped, which are
+	// reported together as yaml.v2 does.
+	terrors []string
+	// aliases are the nodes of the aliases being decoded to detect the
+	// recursive ones.
+	aliases map[*yaml3.Node]bool
+}
+
+// decodeYAML decodes the document into a map as yaml.v2 decodes the
+// YAML data into map[string]interface{}.
+func decodeYAML(doc *yaml3.Node, strict bool) (map[string]interface{}, error) {
+	d := &yamlDecoder{strict: strict, aliases: map[*yaml3.Node]bool{}}
+	n := doc
+	if n.Kind == yaml3.DocumentNode {
+		if len(n.Content) == 0 {
+			return nil, nil
+		}
+		n = n.Content[0]
+	}
+	if n.Kind == yaml3.AliasNode {
+		n = n.Alias
+	}
+	var cm map[string]interface{}
+	switch {
+	case n.Kind == yaml3.MappingNode:
+		m := map[interface{}]interface{}{}
+		if err := d.mapping(n, m, d.stringKey); err != nil {
+			return nil, err
+		}
+		cm = make(map[string]interface{}, len(m))
+		for k, v := range m {
+			cm[k.(string)] = v
+		}
+	case n.Kind == yaml3.ScalarNode && n.ShortTag() == "!!null":
+	default:
+		d.terror(n, "map[string]interface {}")
+	}
+	if len(d.terrors) > 0 {
+		return cm, &yaml.TypeError{Errors: d.terrors}
+	}
+	return cm, nil
+}
+
+func (d *yamlDecoder) terror(n *yaml3.Node, typ string) {
+	value := ""
+	if n.Kind == yaml3.ScalarNode {
+		value = " `" + n.Value + "`"
+	}
+	d.terrors = append(d.terrors, fmt.Sprintf("line %d: cannot unmarshal %s%s into %s",
+		n.Line, n.ShortTag(), value, typ))
+}
+
+func (d *yamlDecoder) value(n *yaml3.Node) (interface{}, error) {
+	switch n.Kind {
+	case yaml3.AliasNode:
+		if d.aliases[n.Alias] {
+			return nil, fmt.Errorf("yaml: anchor '%s' value contains itself", n.Value)
+		}
+		d.aliases[n.Alias] = true
+		defer delete(d.aliases, n.Alias)
+		return d.value(n.Alias)
+	case yaml3.ScalarNode:
+		return d.scalar(n)
+	case yaml3.SequenceNode:
+		s := make([]interface{}, 0, len(n.Content))
+		for _, c := range n.Content {
+			v, err := d.value(c)
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, v)
+		}
+		return s, nil
+	case yaml3.MappingNode:
+		m := map[interface{}]interface{}{}
+		if err := d.mapping(n, m, d.value); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("yaml: line %d: unexpected node", n.Line)
+}
+
+// scalar returns the value of the scalar node. The plain scalars are
+// decoded by yaml.v2 as the value of a mapping, so that the markers like
+// `---` are kept as they are. The scalars with an explicit tag are encoded
+// again with the tag for yaml.v2 to resolve it.
+func (d *yamlDecoder) scalar(n *yaml3.Node) (interface{}, error) {
+	const quoted = yaml3.DoubleQuotedStyle | yaml3.SingleQuotedStyle |
+		yaml3.LiteralStyle | yaml3.FoldedStyle
+	switch {
+	case n.Style&yaml3.TaggedStyle != 0:
+		data, err := yaml3.Marshal(n)
+		if err != nil {
+			return nil, err
+		}
+		var v interface{}
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n.Line, err)
+		}
+		return v, nil
+	case n.Style&quoted != 0 || strings.Contains(n.Value, "\n"):
+		return n.Value, nil
+	}
+	var m map[string]interface{}
+	if err := yaml.Unmarshal([]byte("v: "+n.Value), &m); err != nil || len(m) != 1 {
+		return n.Value, nil
+	}
+	switch v := m["v"].(type) {
+	case map[interface{}]interface{}, []interface{}:
+		return n.Value, nil
+	default:
+		return v, nil
+	}
+}
+
+// stringKey returns the key of the top-level mapping. yaml.v2 takes the
+// text of any scalar as a string key.
+func (d *yamlDecoder) stringKey(n *yaml3.Node) (interface{}, error) {
+	if n.Kind == yaml3.AliasNode {
+		n = n.Alias
+	}
+	if n.Kind != yaml3.ScalarNode {
+		d.terror(n, "string")
+		return nil, errSkipKey
+	}
+	if n.ShortTag() == "!!null" {
+		return "", nil
+	}
+	return n.Value, nil
+}
+
+// mapping decodes the pairs of the mapping node into the map. The merge
+// keys are applied in place as yaml.v2 does, so that the later keys
+// override the merged ones.
+func (d *yamlDecoder) mapping(n *yaml3.Node, m map[interface{}]interface{},
+	key func(*yaml3.Node) (interface{}, error)) error {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		kn, vn := n.Content[i], n.Content[i+1]
+		if isMergeKey(kn) {
+			if err := d.merge(vn, m, key); err != nil {
+				return err
+			}
+			continue
+		}
+		k, err := key(kn)
+		if err == errSkipKey {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		switch k.(type) {
+		case map[interface{}]interface{}, []interface{}:
+			return fmt.Errorf("yaml: invalid map key: %#v", k)
+		}
+		v, err := d.value(vn)
+		if err != nil {
+			return err
+		}
+		if _, ok := m[k]; ok && d.strict {
+			d.terrors = append(d.terrors, fmt.Sprintf("line %d: key %#v already set in map", vn.Line, k))
+			continue
+		}
+		m[k] = v
+	}
+	return nil
+}
+
+func isMergeKey(n *yaml3.Node) bool {
+	return n.Kind == yaml3.ScalarNode && n.Value == "<<" && n.Tag == "!!merge"
+}
+
+// merge merges the mapping, or the mappings of the sequence, into the
+// map. The earlier mappings of the sequence take precedence.
+func (d *yamlDecoder) merge(n *yaml3.Node, m map[interface{}]interface{},
+	key func(*yaml3.Node) (interface{}, error)) error {
+	mapping := func(n *yaml3.Node) *yaml3.Node {
+		if n.Kind == yaml3.AliasNode {
+			n = n.Alias
+		}
+		if n.Kind != yaml3.MappingNode {
+			return nil
+		}
+		return n
+	}
+	if n.Kind == yaml3.SequenceNode {
+		for i := len(n.Content) - 1; i >= 0; i-- {
+			c := mapping(n.Content[i])
+			if c == nil {
+				return errMergeWantMap
+			}
+			if err := d.mapping(c, m, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	c := mapping(n)
+	if c == nil {
+		return errMergeWantMap
+	}
+	return d.mapping(c, m, key)
+}
+
+// errSkipKey is returned by the key function of a mapping to skip the
+// pair after the error is recorded.
+var errSkipKey = fmt.Errorf("skip the key")
+
+var errMergeWantMap = fmt.Errorf("yaml: map merge requires map or sequence of maps as the value")
@@ -16,6 +16,7 @@ import (
 	"time"
 
 	"github.com/yohamta/dagu/internal/models"
+	"github.com/yohamta/dagu/internal/scheduler"
 	"github.com/yohamta/dagu/internal/settings"
 	"github.com/yohamta/dagu/internal/utils"
 )
@@ -101,6 +102,37 @@ func (db *Database) ReadStatusHist(configPath string, n int) []*models.StatusFil
 	return ret
 }
 
+// EstimatedDuration returns the average duration of the latest
+// successful runs. It returns ErrNoSuccessfulRuns when there is none.
+func (db *Database) EstimatedDuration(configPath string) (time.Duration, error) {
+	matches, _ := filepath.Glob(db.pattern(configPath) + "*.dat")
+	var total time.Duration
+	count := 0
+	for _, file := range filterLatest(matches, len(matches)) {
+		if count >= estimationSamples {
+			break
+		}
+		status, err := ParseFile(file)
+		if err != nil || status.Status != scheduler.SchedulerStatus_Success {
+			continue
+		}
+		startedAt, err := utils.ParseTime(status.StartedAt)
+		if err != nil || startedAt.IsZero() {
+			continue
+		}
+		finishedAt, err := utils.ParseTime(status.FinishedAt)
+		if err != nil || finishedAt.IsZero() {
+			continue
+		}
+		total += finishedAt.Sub(startedAt)
+		count++
+	}
+	if count == 0 {
+		return 0, ErrNoSuccessfulRuns
+	}
+	return total / time.Duration(count), nil
+}
+
 // ReadStatusToday returns a list of status files.
 func (db *Database) ReadStatusToday(configPath string) (*models.Status, error) {
 	file, err := db.latestToday(configPath, time.Now())
@@ -138,12 +170,27 @@ func (db *Database) FindByRequestId(configPath string, requestId string) (*model
 	return nil, fmt.Errorf("%w : %s", ErrRequestIdNotFound, requestId)
 }
 
+// ReadDefinition returns the definition of the DAG recorded in the status
+// of the request id. It's given to dag.Loader to load the past versions.
+func (db *Database) ReadDefinition(configPath, requestId string) (string, error) {
+	f, err := db.FindByRequestId(configPath, requestId)
+	if err != nil {
+		return "", err
+	}
+	if f.Status.Definition == "" {
+		return "", fmt.Errorf("definition is not recorded: %s", requestId)
+	}
+	return f.Status.Definition, nil
+}
+
 // RemoveAll removes all files in a directory.
 func (db *Database) RemoveAll(configPath string) error {
 	return db.RemoveOld(configPath, 0)
 }
 
-// RemoveOld removes old files.
+// RemoveOld removes the history data older than the retention days.
+// A negative retention days, e.g. dag.HistRetentionForever, retains
+// the history forever.
 func (db *Database) RemoveOld(configPath string, retentionDays int) error {
 	pattern := db.pattern(configPath) + "*.dat"
 	var lastErr error = nil
@@ -271,8 +318,12 @@ var (
 	ErrRequestIdNotFound = fmt.Errorf("request id not found")
 	ErrNoStatusDataToday = fmt.Errorf("no status data today")
 	ErrNoStatusData      = fmt.Errorf("no status data")
+	ErrNoSuccessfulRuns  = fmt.Errorf("no successful runs")
 )
 
+// estimationSamples is the number of successful runs used to estimate the duration.
+const estimationSamples = 10
+
 var rTimestamp = regexp.MustCompile(`2\d{7}.\d{2}:\d{2}:\d{2}`)
 
 func filterLatest(files []string, n int) []string {
@@ -33,6 +33,7 @@ func TestDatabase(t *testing.T) {
 		"test compaction":                     testCompactFile,
 		"test error read file":                testErrorReadFile,
 		"test error parse file":               testErrorParseFile,
+		"test estimated duration":             testEstimatedDuration,
 	} {
 		t.Run(scenario, func(t *testing.T) {
 			dir, err := os.MkdirTemp("", "test-database")
@@ -177,6 +178,11 @@ func testRemoveOldFiles(t *testing.T, db *Database) {
 	files := db.latest(db.pattern(d.Location)+"*.dat", 3)
 	require.Equal(t, 3, len(files))
 
+	require.NoError(t, db.RemoveOld(d.Location, dag.HistRetentionForever))
+
+	files = db.latest(db.pattern(d.Location)+"*.dat", 3)
+	require.Equal(t, 3, len(files))
+
 	db.RemoveOld(d.Location, 0)
 
 	files = db.latest(db.pattern(d.Location)+"*.dat", 3)
@@ -346,6 +352,36 @@ func testErrorParseFile(t *testing.T, db *Database) {
 	require.NoError(t, err)
 }
 
+func testEstimatedDuration(t *testing.T, db *Database) {
+	d := &dag.DAG{
+		Name:     "test_estimated_duration",
+		Location: "test_estimated_duration.yaml",
+	}
+
+	_, err := db.EstimatedDuration(d.Location)
+	require.ErrorIs(t, err, ErrNoSuccessfulRuns)
+
+	base := time.Date(2022, 1, 1, 0, 0, 0, 0, time.Local)
+	for i, data := range []struct {
+		Status   scheduler.SchedulerStatus
+		Duration time.Duration
+	}{
+		{scheduler.SchedulerStatus_Success, time.Minute},
+		{scheduler.SchedulerStatus_Error, time.Hour},
+		{scheduler.SchedulerStatus_Success, time.Minute * 3},
+	} {
+		start := base.AddDate(0, 0, i)
+		finish := start.Add(data.Duration)
+		status := models.NewStatus(d, nil, data.Status, 10000, &start, &finish)
+		status.RequestId = fmt.Sprintf("request-id-%d", i)
+		testWriteStatus(t, db, d, status, start)
+	}
+
+	ret, err := db.EstimatedDuration(d.Location)
+	require.NoError(t, err)
+	require.Equal(t, time.Minute*2, ret)
+}
+
 func testWriteStatus(t *testing.T, db *Database, d *dag.DAG, status *models.Status, tm time.Time) {
 	t.Helper()
 	dw, _, err := db.NewWriter(d.Location, tm, status.RequestId)
@@ -2,19 +2,33 @@ package executor
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 
 	"github.com/yohamta/dagu/internal/dag"
 )
 
 type CommandExecutor struct {
-	cmd *exec.Cmd
+	cmd       *exec.Cmd
+	stdinFile string
 }
 
 func (e *CommandExecutor) Run() error {
+	if e.stdinFile != "" {
+		f, err := os.Open(e.stdinFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		e.cmd.Stdin = f
+	}
 	return e.cmd.Run()
 }
 
@@ -33,22 +47,89 @@ func (e *CommandExecutor) Kill(sig os.Signal) error {
 	return syscall.Kill(-e.cmd.Process.Pid, sig.(syscall.Signal))
 }
 
-func CreateCommandExecutor(ctx context.Context, step *dag.Step) (Executor, error) {
-	cmd := exec.CommandContext(ctx, step.Command, step.Args...)
+func CreateCommandExecutor(ctx context.Context, step *dag.Step, env *dag.Environment) (Executor, error) {
+	var setup []string
+	if step.Umask != nil {
+		// the umask can't be set via SysProcAttr, so it's set in the shell
+		// which executes the command.
+		setup = append(setup, fmt.Sprintf("umask %04o", *step.Umask))
+	}
+	if step.Limits != nil {
+		cmds, err := limitsCommands(step.Limits)
+		if err != nil {
+			return nil, err
+		}
+		setup = append(setup, cmds...)
+	}
+	cmd := newCommand(ctx, setup, step.Command, step.Args)
 	cmd.Dir = step.Dir
-	cmd.Env = append(cmd.Env, step.Variables...)
-	step.OutputVariables.Range(func(key, value interface{}) bool {
-		cmd.Env = append(cmd.Env, value.(string))
-		return true
-	})
+	cmd.Env = append(cmd.Env, env.MarshalForExec()...)
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Setpgid: true,
 		Pgid:    0,
 	}
+	if step.RunAs != "" {
+		cred, err := lookupCredential(step.RunAs)
+		if err != nil {
+			return nil, err
+		}
+		cmd.SysProcAttr.Credential = cred
+	}
 
-	return &CommandExecutor{
+	e := &CommandExecutor{
 		cmd: cmd,
-	}, nil
+	}
+	if step.Stdin != "" {
+		cmd.Stdin = strings.NewReader(step.Stdin)
+	}
+	if step.StdinFile != "" {
+		e.stdinFile = step.StdinFile
+		if !filepath.IsAbs(e.stdinFile) {
+			e.stdinFile = filepath.Join(step.Dir, e.stdinFile)
+		}
+	}
+	return e, nil
+}
+
+// newCommand returns the command to run the program. If there are setup
+// commands, the program is run by the shell after them with exec, so that
+// the setup is applied to the process of the program before it starts.
+func newCommand(ctx context.Context, setup []string, program string, args []string) *exec.Cmd {
+	if len(setup) == 0 {
+		return exec.CommandContext(ctx, program, args...)
+	}
+	if !strings.Contains(program, "/") {
+		// the program is looked up as exec.Command does. If it's not found,
+		// the shell reports it.
+		if p, err := exec.LookPath(program); err == nil {
+			program = p
+		}
+	}
+	script := strings.Join(append(setup, `exec "$@"`), " && ")
+	return exec.CommandContext(ctx, "/bin/sh",
+		append([]string{"-c", script, "sh", program}, args...)...)
+}
+
+// lookupCredential returns the credential to run a command as the user.
+func lookupCredential(name string) (*syscall.Credential, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		if u, err = user.LookupId(name); err != nil {
+			return nil, fmt.Errorf("runAs user not found: %s", name)
+		}
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	if euid := os.Geteuid(); euid != 0 && uint64(euid) != uid {
+		return nil, fmt.Errorf("running as %s is not permitted: dagu must run as root", name)
+	}
+	return &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}, nil
 }
 
 func init() {
@@ -0,0 +1,145 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yohamta/dagu/internal/dag"
+)
+
+func TestRunAs(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("runAs requires root")
+	}
+	u, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip("user nobody does not exist")
+	}
+
+	step := &dag.Step{
+		Command:         "id",
+		RunAs:           "nobody",
+		OutputVariables: &sync.Map{},
+	}
+	e, err := CreateCommandExecutor(context.Background(), step, nil)
+	require.NoError(t, err)
+
+	cred := e.(*CommandExecutor).cmd.SysProcAttr.Credential
+	require.Equal(t, u.Uid, strconv.Itoa(int(cred.Uid)))
+	require.Equal(t, u.Gid, strconv.Itoa(int(cred.Gid)))
+
+	step.RunAs = "not-existing-user"
+	_, err = CreateCommandExecutor(context.Background(), step, nil)
+	require.Error(t, err)
+}
+
+func TestUmask(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("umask is not supported on Windows")
+	}
+	file := filepath.Join(t.TempDir(), "created")
+	umask := 0077
+	step := &dag.Step{
+		Command:         "touch",
+		Args:            []string{file},
+		Umask:           &umask,
+		OutputVariables: &sync.Map{},
+	}
+	e, err := CreateCommandExecutor(context.Background(), step, nil)
+	require.NoError(t, err)
+	require.NoError(t, e.Run())
+
+	info, err := os.Stat(file)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestLimits(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("limits are only supported on Linux")
+	}
+	step := &dag.Step{
+		Command: "sh",
+		Args: []string{"-c",
+			"ulimit -n; head -c 200000000 /dev/zero | tail > /dev/null"},
+		Limits:          &dag.Limits{MemoryMB: 64, Nofile: 64},
+		OutputVariables: &sync.Map{},
+	}
+	e, err := CreateCommandExecutor(context.Background(), step, nil)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	e.SetStdout(&out)
+	require.Error(t, e.Run())
+	require.Equal(t, "64\n", out.String())
+
+	step.Limits = &dag.Limits{MemoryMB: 1024}
+	e, err = CreateCommandExecutor(context.Background(), step, nil)
+	require.NoError(t, err)
+	require.NoError(t, e.Run())
+
+	// the arguments are passed as they are
+	step = &dag.Step{
+		Command: "printf",
+		Args:    []string{"%s|", "a b", "$HOME"},
+		Limits:  &dag.Limits{Nofile: 64},
+	}
+	e, err = CreateCommandExecutor(context.Background(), step, nil)
+	require.NoError(t, err)
+	out.Reset()
+	e.SetStdout(&out)
+	require.NoError(t, e.Run())
+	require.Equal(t, "a b|$HOME|", out.String())
+}
+
+func TestStdin(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "input.txt"), []byte("from file"), 0644))
+
+	for _, step := range []*dag.Step{
+		{Command: "cat", Stdin: "from string"},
+		{Command: "cat", Dir: dir, StdinFile: "input.txt"},
+	} {
+		step.OutputVariables = &sync.Map{}
+		e, err := CreateCommandExecutor(context.Background(), step, nil)
+		require.NoError(t, err)
+
+		var out bytes.Buffer
+		e.SetStdout(&out)
+		require.NoError(t, e.Run())
+		if step.Stdin != "" {
+			require.Equal(t, "from string", out.String())
+		} else {
+			require.Equal(t, "from file", out.String())
+		}
+	}
+
+	step := &dag.Step{Command: "cat", StdinFile: filepath.Join(dir, "not_existing.txt"), OutputVariables: &sync.Map{}}
+	e, err := CreateCommandExecutor(context.Background(), step, nil)
+	require.NoError(t, err)
+	require.Error(t, e.Run())
+}
+
+func TestCommandEnv(t *testing.T) {
+	step := &dag.Step{
+		Command: "sh",
+		Args:    []string{"-c", "echo $COMMAND_ENV_TEST"},
+	}
+	env := dag.NewEnvironment("COMMAND_ENV_TEST=from env")
+	e, err := CreateCommandExecutor(context.Background(), step, env)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	e.SetStdout(&out)
+	require.NoError(t, e.Run())
+	require.Equal(t, "from env\n", out.String())
+	require.Empty(t, os.Getenv("COMMAND_ENV_TEST"))
+}
@@ -2,6 +2,7 @@ package executor
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"os"
 
@@ -33,7 +34,7 @@ func (e *DockerExecutor) Run() error {
 	return nil
 }
 
-func CreateDockerExecutor(ctx context.Context, step *dag.Step) (Executor, error) {
+func CreateDockerExecutor(ctx context.Context, step *dag.Step, env *dag.Environment) (Executor, error) {
 	step.Executor = "docker"
 	cfg := &container.Config{}
 	md, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
@@ -48,6 +49,12 @@ func CreateDockerExecutor(ctx context.Context, step *dag.Step) (Executor, error)
 		return nil, err
 	}
 
+	passEnv, err := passEnvVariables(step.ExecutorConfig["passEnv"])
+	if err != nil {
+		return nil, err
+	}
+	cfg.Env = append(cfg.Env, passEnv...)
+
 	// TODO: validate config if necessary
 
 	return &DockerExecutor{
@@ -56,6 +63,29 @@ func CreateDockerExecutor(ctx context.Context, step *dag.Step) (Executor, error)
 	}, nil
 }
 
+// passEnvVariables returns the host env variables to forward
+// into the container as "KEY=VALUE".
+func passEnvVariables(value interface{}) ([]string, error) {
+	ret := []string{}
+	if value == nil {
+		return ret, nil
+	}
+	names, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("passEnv must be an array of strings")
+	}
+	for _, n := range names {
+		name, ok := n.(string)
+		if !ok {
+			return nil, fmt.Errorf("passEnv must be an array of strings")
+		}
+		if v, ok := os.LookupEnv(name); ok {
+			ret = append(ret, fmt.Sprintf("%s=%s", name, v))
+		}
+	}
+	return ret, nil
+}
+
 func init() {
 	Register("docker", CreateDockerExecutor)
 }
@@ -0,0 +1,33 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yohamta/dagu/internal/dag"
+)
+
+func TestDockerPassEnv(t *testing.T) {
+	os.Setenv("TEST_PASS_ENV", "ap-northeast-1")
+	defer os.Unsetenv("TEST_PASS_ENV")
+
+	step := &dag.Step{
+		ExecutorConfig: map[string]interface{}{
+			"image":   "alpine",
+			"env":     []interface{}{"FOO=bar"},
+			"passEnv": []interface{}{"TEST_PASS_ENV", "NOT_EXISTING_ENV"},
+		},
+	}
+	e, err := CreateDockerExecutor(context.Background(), step, nil)
+	require.NoError(t, err)
+
+	cfg := e.(*DockerExecutor).config
+	require.Equal(t, "alpine", cfg.Image)
+	require.Equal(t, []string{"FOO=bar", "TEST_PASS_ENV=ap-northeast-1"}, cfg.Env)
+
+	step.ExecutorConfig["passEnv"] = "TEST_PASS_ENV"
+	_, err = CreateDockerExecutor(context.Background(), step, nil)
+	require.Error(t, err)
+}
@@ -16,7 +16,10 @@ type Executor interface {
 	Run() error
 }
 
-type Creator func(ctx context.Context, step *dag.Step) (Executor, error)
+// Creator creates the executor of the step. env is the environment the
+// step runs with, i.e. the variables of the step and the outputs of the
+// steps run before it.
+type Creator func(ctx context.Context, step *dag.Step, env *dag.Environment) (Executor, error)
 
 var executors = make(map[string]Creator)
 
@@ -24,10 +27,10 @@ func Register(name string, register Creator) {
 	executors[name] = register
 }
 
-func CreateExecutor(ctx context.Context, step *dag.Step) (Executor, error) {
+func CreateExecutor(ctx context.Context, step *dag.Step, env *dag.Environment) (Executor, error) {
 	f, ok := executors[step.Executor]
 	if ok {
-		return f(ctx, step)
+		return f(ctx, step, env)
 	}
 	return nil, fmt.Errorf("invalid executor: %s", step.Executor)
 }
@@ -3,7 +3,7 @@ package executor
 import (
 	"context"
 	"encoding/json"
-	"errors"
+	"fmt"
 	"io"
 	"os"
 	"strings"
@@ -19,6 +19,9 @@ type HTTPExecutor struct {
 	reqCancel context.CancelFunc
 	url       string
 	method    string
+	// bodyOnly writes only the response body to stdout so that the
+	// output of the step is the body.
+	bodyOnly bool
 }
 
 type HTTPConfig struct {
@@ -46,22 +49,27 @@ func (e *HTTPExecutor) Run() error {
 	if err != nil {
 		return err
 	}
-	if _, err := e.stdout.Write([]byte(rsp.Status() + "\n")); err != nil {
-		return err
-	}
-	if err := rsp.Header().Write(e.stdout); err != nil {
-		return err
+	if !e.bodyOnly {
+		if _, err := e.stdout.Write([]byte(rsp.Status() + "\n")); err != nil {
+			return err
+		}
+		if err := rsp.Header().Write(e.stdout); err != nil {
+			return err
+		}
 	}
 	if _, err := e.stdout.Write(rsp.Body()); err != nil {
 		return err
 	}
-	if rsp.StatusCode() != 200 {
-		return errors.New("http status code not 200")
+	if rsp.StatusCode() < 200 || rsp.StatusCode() >= 300 {
+		return fmt.Errorf("http status code not 2xx: %s", rsp.Status())
 	}
 	return nil
 }
 
-func CreateHTTPExecutor(ctx context.Context, step *dag.Step) (Executor, error) {
+func CreateHTTPExecutor(ctx context.Context, step *dag.Step, env *dag.Environment) (Executor, error) {
+	if step.HTTP != nil {
+		return newHTTPExecutor(ctx, step, step.HTTP.Expand(env)), nil
+	}
 	var reqCfg HTTPConfig
 	if len(step.Script) > 0 {
 		if err := json.Unmarshal([]byte(step.Script), &reqCfg); err != nil {
@@ -69,27 +77,40 @@ func CreateHTTPExecutor(ctx context.Context, step *dag.Step) (Executor, error) {
 		}
 	}
 
+	cfg := &dag.HTTPConfig{
+		Method:  step.Command,
+		URL:     step.Args[0],
+		Headers: reqCfg.Headers,
+		Query:   reqCfg.QueryParams,
+		Body:    reqCfg.Body,
+		Timeout: time.Second * time.Duration(reqCfg.Timeout),
+	}
+	return newHTTPExecutor(ctx, step, cfg.Expand(env)), nil
+}
+
+func newHTTPExecutor(ctx context.Context, step *dag.Step, cfg *dag.HTTPConfig) *HTTPExecutor {
 	ctx, cancel := context.WithCancel(ctx)
 	client := resty.New()
-	if reqCfg.Timeout > 0 {
-		client.SetTimeout(time.Second * time.Duration(reqCfg.Timeout))
+	if cfg.Timeout > 0 {
+		client.SetTimeout(cfg.Timeout)
 	}
 	req := client.R().SetContext(ctx)
-	if len(reqCfg.Headers) > 0 {
-		req = req.SetHeaders(reqCfg.Headers)
+	if len(cfg.Headers) > 0 {
+		req = req.SetHeaders(cfg.Headers)
 	}
-	if len(reqCfg.QueryParams) > 0 {
-		req = req.SetQueryParams(reqCfg.QueryParams)
+	if len(cfg.Query) > 0 {
+		req = req.SetQueryParams(cfg.Query)
 	}
-	req = req.SetBody([]byte(reqCfg.Body))
+	req = req.SetBody([]byte(cfg.Body))
 
 	return &HTTPExecutor{
 		stdout:    os.Stdout,
 		req:       req,
 		reqCancel: cancel,
-		method:    step.Command,
-		url:       step.Args[0],
-	}, nil
+		method:    cfg.Method,
+		url:       cfg.URL,
+		bodyOnly:  step.Output != "",
+	}
 }
 
 func init() {
@@ -0,0 +1,63 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yohamta/dagu/internal/dag"
+)
+
+func TestHTTPExecutor(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":1}`))
+	}))
+	defer srv.Close()
+
+	step := &dag.Step{
+		Executor: dag.ExecutorHTTP,
+		Output:   "RESULT",
+		HTTP: &dag.HTTPConfig{
+			Method:  "POST",
+			URL:     srv.URL + "/items",
+			Headers: map[string]string{"Authorization": "Bearer secret"},
+		},
+		OutputVariables: &sync.Map{},
+	}
+	e, err := CreateExecutor(context.Background(), step, nil)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	e.SetStdout(&out)
+	require.NoError(t, e.Run())
+	require.Equal(t, `{"id":1}`, out.String())
+
+	step.HTTP.URL = srv.URL + "/missing"
+	e, err = CreateExecutor(context.Background(), step, nil)
+	require.NoError(t, err)
+	e.SetStdout(&out)
+	require.Error(t, e.Run())
+
+	// the variables are expanded when it's run
+	step.HTTP.URL = "${HTTP_TEST_SERVER}/items"
+	step.HTTP.Headers = map[string]string{"Authorization": "Bearer ${HTTP_TEST_TOKEN}"}
+	env := dag.NewEnvironment("HTTP_TEST_SERVER="+srv.URL, "HTTP_TEST_TOKEN=secret")
+	e, err = CreateExecutor(context.Background(), step, env)
+	require.NoError(t, err)
+	out.Reset()
+	e.SetStdout(&out)
+	require.NoError(t, e.Run())
+	require.Equal(t, `{"id":1}`, out.String())
+	require.Equal(t, "Bearer ${HTTP_TEST_TOKEN}", step.HTTP.Headers["Authorization"])
+}
@@ -0,0 +1,25 @@
+//go:build linux
+
+package executor
+
+import (
+	"fmt"
+
+	"github.com/yohamta/dagu/internal/dag"
+)
+
+// limitsCommands returns the shell commands to apply the resource limits.
+// They're run in the shell which executes the command, so that the limits
+// are applied before the command starts. The processes it spawns inherit
+// the limits.
+func limitsCommands(limits *dag.Limits) ([]string, error) {
+	ret := []string{}
+	if limits.MemoryMB > 0 {
+		// the virtual memory size of ulimit is in kilobytes.
+		ret = append(ret, fmt.Sprintf("ulimit -v %d", limits.MemoryMB<<10))
+	}
+	if limits.Nofile > 0 {
+		ret = append(ret, fmt.Sprintf("ulimit -n %d", limits.Nofile))
+	}
+	return ret, nil
+}
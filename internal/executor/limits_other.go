@@ -0,0 +1,16 @@
+//go:build !linux
+
+package executor
+
+import (
+	"fmt"
+
+	"github.com/yohamta/dagu/internal/dag"
+)
+
+func limitsCommands(limits *dag.Limits) ([]string, error) {
+	if limits.MemoryMB > 0 || limits.Nofile > 0 {
+		return nil, fmt.Errorf("limits are only supported on Linux")
+	}
+	return nil, nil
+}
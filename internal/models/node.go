@@ -2,6 +2,8 @@ package models
 
 import (
 	"fmt"
+	"math"
+	"time"
 
 	"github.com/yohamta/dagu/internal/dag"
 	"github.com/yohamta/dagu/internal/scheduler"
@@ -15,9 +17,17 @@ type Node struct {
 	FinishedAt string               `json:"FinishedAt"`
 	Status     scheduler.NodeStatus `json:"Status"`
 	RetryCount int                  `json:"RetryCount"`
-	DoneCount  int                  `json:"DoneCount"`
-	Error      string               `json:"Error"`
-	StatusText string               `json:"StatusText"`
+	// DurationSeconds is the execution time of the step in seconds.
+	DurationSeconds float64               `json:"DurationSeconds"`
+	ExitCode        *int                  `json:"ExitCode,omitempty"`
+	DoneCount       int                   `json:"DoneCount"`
+	Error           string                `json:"Error"`
+	StatusText      string                `json:"StatusText"`
+	SkipReason      *dag.ConditionResult  `json:"SkipReason,omitempty"`
+	OutputValue     string                `json:"OutputValue,omitempty"`
+	ArtifactFiles   []*scheduler.Artifact `json:"ArtifactFiles,omitempty"`
+	// Hook is the onSuccess or onFailure hook run after the step.
+	Hook *Node `json:"Hook,omitempty"`
 }
 
 func (n *Node) ToNode() *scheduler.Node {
@@ -30,13 +40,18 @@ func (n *Node) ToNode() *scheduler.Node {
 	ret := &scheduler.Node{
 		Step: n.Step,
 		NodeState: scheduler.NodeState{
-			Status:     n.Status,
-			Log:        n.Log,
-			StartedAt:  startedAt,
-			FinishedAt: finishedAt,
-			RetryCount: n.RetryCount,
-			DoneCount:  n.DoneCount,
-			Error:      err,
+			Status:        n.Status,
+			Log:           n.Log,
+			StartedAt:     startedAt,
+			FinishedAt:    finishedAt,
+			RetryCount:    n.RetryCount,
+			Duration:      time.Duration(math.Round(n.DurationSeconds * float64(time.Second))),
+			ExitCode:      n.ExitCode,
+			DoneCount:     n.DoneCount,
+			Error:         err,
+			SkipReason:    n.SkipReason,
+			OutputValue:   n.OutputValue,
+			ArtifactFiles: n.ArtifactFiles,
 		},
 	}
 	return ret
@@ -44,18 +59,26 @@ func (n *Node) ToNode() *scheduler.Node {
 
 func FromNode(n *scheduler.Node) *Node {
 	node := &Node{
-		Step:       n.Step,
-		Log:        n.Log,
-		StartedAt:  utils.FormatTime(n.StartedAt),
-		FinishedAt: utils.FormatTime(n.FinishedAt),
-		Status:     n.ReadStatus(),
-		StatusText: n.ReadStatus().String(),
-		RetryCount: n.ReadRetryCount(),
-		DoneCount:  n.ReadDoneCount(),
+		Step:            n.Step,
+		Log:             n.Log,
+		StartedAt:       utils.FormatTime(n.StartedAt),
+		FinishedAt:      utils.FormatTime(n.FinishedAt),
+		Status:          n.ReadStatus(),
+		StatusText:      n.ReadStatus().String(),
+		RetryCount:      n.ReadRetryCount(),
+		DurationSeconds: n.ReadDuration().Seconds(),
+		ExitCode:        n.ReadExitCode(),
+		DoneCount:       n.ReadDoneCount(),
+		SkipReason:      n.SkipReason,
+		OutputValue:     n.OutputValue,
+		ArtifactFiles:   n.ArtifactFiles,
 	}
 	if n.Error != nil {
 		node.Error = n.Error.Error()
 	}
+	if h := n.HookNode(); h != nil {
+		node.Hook = FromNode(h)
+	}
 	return node
 }
 
@@ -1,7 +1,9 @@
 package models
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/yohamta/dagu/internal/dag"
@@ -42,12 +44,40 @@ func TestToNode(t *testing.T) {
 	}
 	nodes := FromNodes(orig)
 	for i := range nodes {
+		require.Greater(t, nodes[i].DurationSeconds, 0.0)
 		n := nodes[i].ToNode()
 		require.Equal(t, n.Step, orig[i].Step)
 		require.Equal(t, n.NodeState, orig[i].NodeState)
 	}
 }
 
+func TestNodeDurationJSON(t *testing.T) {
+	n := &scheduler.Node{Step: makeStep("true")}
+	n.Duration = time.Millisecond * 1500
+	js, err := json.Marshal(FromNode(n))
+	require.NoError(t, err)
+	require.Contains(t, string(js), `"DurationSeconds":1.5`)
+
+	node := &Node{}
+	require.NoError(t, json.Unmarshal(js, node))
+	require.Equal(t, time.Millisecond*1500, node.ToNode().Duration)
+}
+
+func TestFromNodeHook(t *testing.T) {
+	step := makeStep("true")
+	step.OnSuccess = makeStep("true")
+	step.OnSuccess.Name = "hook"
+	g, err := scheduler.NewExecutionGraph(step)
+	require.NoError(t, err)
+	sc := &scheduler.Scheduler{Config: &scheduler.Config{LogDir: t.TempDir()}}
+	require.NoError(t, sc.Schedule(g, nil))
+
+	ret := FromNodes(g.Nodes())
+	require.NotNil(t, ret[0].Hook)
+	require.Equal(t, "hook", ret[0].Hook.Name)
+	require.Equal(t, scheduler.NodeStatus_Success, ret[0].Hook.Status)
+}
+
 func testRunSteps(t *testing.T, steps ...*dag.Step) *scheduler.ExecutionGraph {
 	g, err := scheduler.NewExecutionGraph(steps...)
 	require.NoError(t, err)
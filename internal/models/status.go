@@ -45,6 +45,12 @@ type Status struct {
 	FinishedAt string                    `json:"FinishedAt"`
 	Log        string                    `json:"Log"`
 	Params     string                    `json:"Params"`
+	// HandlerOutputs is the output of each handler step.
+	HandlerOutputs map[string]string `json:"HandlerOutputs,omitempty"`
+	// Definition is the YAML of the definition of the DAG as it was run.
+	Definition string `json:"Definition,omitempty"`
+	// Schedule is the expression of the schedule that triggered the run.
+	Schedule string `json:"Schedule,omitempty"`
 }
 
 type StatusFile struct {
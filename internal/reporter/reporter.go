@@ -2,14 +2,22 @@ package reporter
 
 import (
 	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"os/exec"
+	"path"
 	"strings"
+	"time"
 
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/yohamta/dagu/internal/dag"
 	"github.com/yohamta/dagu/internal/models"
 	"github.com/yohamta/dagu/internal/scheduler"
+	"github.com/yohamta/dagu/internal/utils"
 )
 
 // Reporter is responsible for reporting the status of the scheduler
@@ -21,6 +29,9 @@ type Reporter struct {
 // Config is the configuration for the reporter.
 type Config struct {
 	Mailer Mailer
+	// StateDir is the directory to keep the time of the last failure mail
+	// of each DAG. It is required to throttle mails by mailOn.minIntervalSec.
+	StateDir string
 }
 
 // Mailer is a mailer interface.
@@ -42,6 +53,15 @@ func (rp *Reporter) ReportStep(d *dag.DAG, status *models.Status, node *schedule
 			renderHTML(status.Nodes),
 		)
 	}
+	if st == scheduler.NodeStatus_None && node.ReadRetryCount() > 0 &&
+		d.MailOn != nil && d.MailOn.Retry {
+		return rp.Mailer.SendMail(
+			d.ErrorMail.From,
+			[]string{d.ErrorMail.To},
+			fmt.Sprintf("%s %s (%s retry %d)", d.ErrorMail.Prefix, d.Name, node.Name, node.ReadRetryCount()),
+			renderHTML(status.Nodes),
+		)
+	}
 	return nil
 }
 
@@ -61,14 +81,27 @@ func (rp *Reporter) ReportSummary(status *models.Status, err error) {
 func (rp *Reporter) SendMail(d *dag.DAG, status *models.Status, err error) error {
 	if err != nil || status.Status == scheduler.SchedulerStatus_Error {
 		if d.MailOn != nil && d.MailOn.Failure {
-			return rp.Mailer.SendMail(
+			if code, ok := exitCode(status, err); ok && excepted(d.MailOn, code) {
+				log.Printf("failure mail suppressed: exit code %d is excepted", code)
+				return nil
+			}
+			if rp.throttled(d) {
+				log.Printf("failure mail suppressed: last mail was sent within %s", d.MailOn.MinInterval)
+				return nil
+			}
+			err := rp.Mailer.SendMail(
 				d.ErrorMail.From,
 				[]string{d.ErrorMail.To},
 				fmt.Sprintf("%s %s (%s)", d.ErrorMail.Prefix, d.Name, status.Status),
 				renderHTML(status.Nodes),
 			)
+			if err == nil {
+				rp.recordMailSent(d)
+			}
+			return err
 		}
-	} else if status.Status == scheduler.SchedulerStatus_Success {
+	} else if status.Status == scheduler.SchedulerStatus_Success ||
+		status.Status == scheduler.SchedulerStatus_PartialSuccess {
 		if d.MailOn != nil && d.MailOn.Success {
 			rp.Mailer.SendMail(
 				d.InfoMail.From,
@@ -81,6 +114,71 @@ func (rp *Reporter) SendMail(d *dag.DAG, status *models.Status, err error) error
 	return nil
 }
 
+// exitCode returns the exit code of the failure of the run. It is taken
+// from the error of the run, or from the exit code recorded for the last
+// failed step when the error is not available.
+func exitCode(status *models.Status, err error) (int, bool) {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), true
+	}
+	for i := len(status.Nodes) - 1; i >= 0; i-- {
+		n := status.Nodes[i]
+		if n.Status != scheduler.NodeStatus_Error {
+			continue
+		}
+		if n.ExitCode == nil {
+			return 0, false
+		}
+		return *n.ExitCode, true
+	}
+	return 0, false
+}
+
+func excepted(mailOn *dag.MailOn, code int) bool {
+	for _, c := range mailOn.ExceptExitCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// throttled returns true if a failure mail for the DAG was already sent
+// within mailOn.minIntervalSec.
+func (rp *Reporter) throttled(d *dag.DAG) bool {
+	if d.MailOn.MinInterval <= 0 || rp.StateDir == "" {
+		return false
+	}
+	info, err := os.Stat(rp.mailStateFile(d))
+	if err != nil {
+		return false
+	}
+	return time.Since(info.ModTime()) < d.MailOn.MinInterval
+}
+
+func (rp *Reporter) recordMailSent(d *dag.DAG) {
+	if d.MailOn.MinInterval <= 0 || rp.StateDir == "" {
+		return
+	}
+	if err := os.MkdirAll(rp.StateDir, 0755); err != nil {
+		log.Printf("failed to create mail state dir: %v", err)
+		return
+	}
+	f := rp.mailStateFile(d)
+	if err := os.WriteFile(f, []byte(utils.FormatTime(time.Now())), 0644); err != nil {
+		log.Printf("failed to write mail state file: %v", err)
+	}
+}
+
+// mailStateFile returns the state file of the DAG. It's keyed by the
+// location of the DAG since DAG files can have the same name.
+func (rp *Reporter) mailStateFile(d *dag.DAG) string {
+	h := md5.Sum([]byte(d.Location))
+	return path.Join(rp.StateDir, fmt.Sprintf("%s-%s.mail",
+		utils.ValidFilename(d.Name, "-"), hex.EncodeToString(h[:])))
+}
+
 func renderSummary(status *models.Status, err error) string {
 	t := table.NewWriter()
 	var errText = ""
@@ -2,11 +2,15 @@ package reporter
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"testing"
 	"time"
 
@@ -25,6 +29,9 @@ func TestReporter(t *testing.T) {
 		"create errormail":   testErrorMail,
 		"no errormail":       testNoErrorMail,
 		"create successmail": testSuccessMail,
+		"throttle errormail": testThrottleErrorMail,
+		"excepted exit code": testExceptedExitCode,
+		"create retrymail":   testRetryMail,
 		"create summary":     testRenderSummary,
 		"create node list":   testRenderTable,
 		"report summary":     testReportSummary,
@@ -107,6 +114,97 @@ func testNoErrorMail(t *testing.T, rp *Reporter, d *dag.DAG, nodes []*models.Nod
 	require.Equal(t, 0, mock.count)
 }
 
+func testThrottleErrorMail(t *testing.T, rp *Reporter, d *dag.DAG, nodes []*models.Node) {
+	tmpDir := utils.MustTempDir("test-reporter-mail-state")
+	defer os.RemoveAll(tmpDir)
+
+	rp.StateDir = tmpDir
+	d.Location = "/dags/a/test.yaml"
+	d.MailOn.Failure = true
+	d.MailOn.MinInterval = time.Hour
+
+	status := &models.Status{
+		Status: scheduler.SchedulerStatus_Error,
+		Nodes:  nodes,
+	}
+	require.NoError(t, rp.SendMail(d, status, nil))
+	require.NoError(t, rp.SendMail(d, status, nil))
+
+	mock := rp.Mailer.(*mockMailer)
+	require.Equal(t, 1, mock.count)
+
+	// the DAG of the same name in another file is not throttled
+	other := *d
+	other.Location = "/dags/b/test.yaml"
+	require.NoError(t, rp.SendMail(&other, status, nil))
+	require.Equal(t, 2, mock.count)
+	require.NoError(t, rp.SendMail(&other, status, nil))
+	require.Equal(t, 2, mock.count)
+
+	// the interval has passed
+	f := rp.mailStateFile(d)
+	past := time.Now().Add(-time.Hour * 2)
+	require.NoError(t, os.Chtimes(f, past, past))
+	require.NoError(t, rp.SendMail(d, status, nil))
+	require.Equal(t, 3, mock.count)
+}
+
+func testExceptedExitCode(t *testing.T, rp *Reporter, d *dag.DAG, nodes []*models.Node) {
+	d.MailOn.Failure = true
+	d.MailOn.ExceptExitCodes = []int{42}
+
+	err := exec.Command("sh", "-c", "exit 42").Run()
+	require.Error(t, err)
+	require.NoError(t, rp.SendMail(d, &models.Status{
+		Status: scheduler.SchedulerStatus_Error,
+		Nodes:  nodes,
+	}, err))
+
+	// the exit code is recorded even if the error is wrapped
+	code := 42
+	nodes[0].Status = scheduler.NodeStatus_Error
+	nodes[0].Error = "timeout exceeded: 1s: exit status 42"
+	nodes[0].ExitCode = &code
+	require.NoError(t, rp.SendMail(d, &models.Status{
+		Status: scheduler.SchedulerStatus_Error,
+		Nodes:  nodes,
+	}, nil))
+
+	mock := rp.Mailer.(*mockMailer)
+	require.Equal(t, 0, mock.count)
+
+	code = 1
+	nodes[0].Error = "exit status 1"
+	require.NoError(t, rp.SendMail(d, &models.Status{
+		Status: scheduler.SchedulerStatus_Error,
+		Nodes:  nodes,
+	}, nil))
+	require.Equal(t, 1, mock.count)
+}
+
+func testRetryMail(t *testing.T, rp *Reporter, d *dag.DAG, nodes []*models.Node) {
+	status := &models.Status{
+		Status: scheduler.SchedulerStatus_Running,
+		Nodes:  nodes,
+	}
+	node := &scheduler.Node{
+		Step: d.Steps[0],
+		NodeState: scheduler.NodeState{
+			Status:     scheduler.NodeStatus_None,
+			RetryCount: 1,
+		},
+	}
+
+	require.NoError(t, rp.ReportStep(d, status, node))
+	mock := rp.Mailer.(*mockMailer)
+	require.Equal(t, 0, mock.count)
+
+	d.MailOn.Retry = true
+	require.NoError(t, rp.ReportStep(d, status, node))
+	require.Equal(t, 1, mock.count)
+	require.Contains(t, mock.subject, "test-step retry 1")
+}
+
 func testSuccessMail(t *testing.T, rp *Reporter, d *dag.DAG, nodes []*models.Node) {
 	d.MailOn.Failure = true
 	d.MailOn.Success = true
@@ -226,3 +324,89 @@ func (m *mockMailer) SendMail(from string, to []string, subject, body string) er
 	m.body = body
 	return nil
 }
+
+func TestRenderWebhook(t *testing.T) {
+	status := &models.Status{
+		Name:       "test DAG",
+		RequestId:  "req-1",
+		Status:     scheduler.SchedulerStatus_Error,
+		StatusText: scheduler.SchedulerStatus_Error.String(),
+		StartedAt:  "2022-01-01 00:00:00",
+		FinishedAt: "2022-01-01 00:01:00",
+		Nodes: []*models.Node{
+			{Step: &dag.Step{Name: "step \"1\""}, Status: scheduler.NodeStatus_Error},
+		},
+	}
+	data := newWebhookData(status, errors.New("exit status 1"))
+	require.Equal(t, webhookEventFailure, data.Event)
+
+	render := func(w *dag.Webhook) map[string]interface{} {
+		b, err := renderWebhook(w, data)
+		require.NoError(t, err)
+		ret := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(b, &ret), string(b))
+		return ret
+	}
+
+	generic := render(&dag.Webhook{Format: dag.WebhookFormatGeneric})
+	require.Equal(t, "test DAG", generic["name"])
+	require.Equal(t, "failure", generic["event"])
+	require.Equal(t, "exit status 1", generic["error"])
+	require.Equal(t, []interface{}{"step \"1\""}, generic["failedSteps"])
+
+	slack := render(&dag.Webhook{Format: dag.WebhookFormatSlack})
+	require.Equal(t, "test DAG failed (req-1)", slack["text"])
+	blocks := slack["blocks"].([]interface{})
+	require.Len(t, blocks, 2)
+	require.Equal(t, "*Error*\nexit status 1",
+		blocks[1].(map[string]interface{})["text"].(map[string]interface{})["text"])
+
+	discord := render(&dag.Webhook{Format: dag.WebhookFormatDiscord})
+	require.Equal(t, "test DAG failed (req-1)", discord["content"])
+	embed := discord["embeds"].([]interface{})[0].(map[string]interface{})
+	require.Equal(t, float64(15158332), embed["color"])
+	require.Len(t, embed["fields"], 3)
+
+	custom := render(&dag.Webhook{
+		Format:   dag.WebhookFormatCustom,
+		Template: `{"msg": {{ json (printf "%s is %s" .Name .Event) }}}`,
+	})
+	require.Equal(t, "test DAG is failure", custom["msg"])
+}
+
+func TestSendWebhooks(t *testing.T) {
+	received := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		received <- string(b)
+	}))
+	defer srv.Close()
+
+	rp := &Reporter{Config: &Config{Mailer: &mockMailer{}}}
+	d := &dag.DAG{
+		Name: "test DAG",
+		Webhooks: []*dag.Webhook{
+			{URL: srv.URL, Format: dag.WebhookFormatCustom, Template: `{{ .Event }}`},
+		},
+	}
+
+	err := rp.SendWebhooks(d, &models.Status{Status: scheduler.SchedulerStatus_Success}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "success", <-received)
+
+	// nothing is sent for a cancelled run
+	err = rp.SendWebhooks(d, &models.Status{Status: scheduler.SchedulerStatus_Cancel}, nil)
+	require.NoError(t, err)
+	require.Len(t, received, 0)
+
+	// the URL is expanded with the env of the DAG when it's sent
+	d.Env = []string{"HOOK_URL=" + srv.URL}
+	d.Webhooks[0].URL = "${HOOK_URL}"
+	err = rp.SendWebhooks(d, &models.Status{Status: scheduler.SchedulerStatus_Success}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "success", <-received)
+
+	d.Webhooks[0].URL = srv.URL + "x"
+	err = rp.SendWebhooks(d, &models.Status{Status: scheduler.SchedulerStatus_Success}, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,120 @@
+package reporter
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"text/template"
+
+	"github.com/yohamta/dagu/internal/dag"
+	"github.com/yohamta/dagu/internal/models"
+	"github.com/yohamta/dagu/internal/scheduler"
+	"github.com/yohamta/dagu/internal/utils"
+)
+
+const (
+	webhookEventFailure = "failure"
+	webhookEventSuccess = "success"
+)
+
+// webhookData is the data the webhook templates are rendered with.
+type webhookData struct {
+	Name        string   `json:"name"`
+	RequestId   string   `json:"requestId"`
+	Event       string   `json:"event"`
+	Status      string   `json:"status"`
+	StartedAt   string   `json:"startedAt"`
+	FinishedAt  string   `json:"finishedAt"`
+	Error       string   `json:"error,omitempty"`
+	FailedSteps []string `json:"failedSteps,omitempty"`
+}
+
+// Summary is the one line description of the run.
+func (w *webhookData) Summary() string {
+	return fmt.Sprintf("%s %s (%s)", w.Name, w.Status, w.RequestId)
+}
+
+var webhookTemplates = map[string]string{
+	dag.WebhookFormatGeneric: `{{ json . }}`,
+	dag.WebhookFormatSlack: `{"text": {{ json .Summary }}, "blocks": [` +
+		`{"type": "section", "text": {"type": "mrkdwn", "text": {{ json (printf "*%s* %s" .Name .Status) }}}, ` +
+		`"fields": [{"type": "mrkdwn", "text": {{ json (printf "*Request ID*\n%s" .RequestId) }}}, ` +
+		`{"type": "mrkdwn", "text": {{ json (printf "*Finished At*\n%s" .FinishedAt) }}}]}` +
+		`{{ if .Error }}, {"type": "section", "text": {"type": "mrkdwn", "text": {{ json (printf "*Error*\n%s" .Error) }}}}{{ end }}]}`,
+	dag.WebhookFormatDiscord: `{"content": {{ json .Summary }}, "embeds": [{"title": {{ json .Name }}, ` +
+		`"color": {{ if eq .Event "failure" }}15158332{{ else }}3066993{{ end }}, ` +
+		`"fields": [{"name": "Status", "value": {{ json .Status }}}, {"name": "Request ID", "value": {{ json .RequestId }}}` +
+		`{{ if .Error }}, {"name": "Error", "value": {{ json .Error }}}{{ end }}]}]}`,
+}
+
+// SendWebhooks posts the result of the run to the webhooks of the DAG.
+// Nothing is sent when the run neither failed nor succeeded.
+func (rp *Reporter) SendWebhooks(d *dag.DAG, status *models.Status, err error) error {
+	if len(d.Webhooks) == 0 {
+		return nil
+	}
+	data := newWebhookData(status, err)
+	if data.Event == "" {
+		return nil
+	}
+	var lastErr error
+	for _, w := range d.Webhooks {
+		if err := sendWebhook(d, w, data); err != nil {
+			log.Printf("failed to send webhook to %s: %v", w.URL, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func newWebhookData(status *models.Status, err error) *webhookData {
+	ret := &webhookData{
+		Name:       status.Name,
+		RequestId:  status.RequestId,
+		Status:     status.StatusText,
+		StartedAt:  status.StartedAt,
+		FinishedAt: status.FinishedAt,
+	}
+	switch {
+	case err != nil || status.Status == scheduler.SchedulerStatus_Error:
+		ret.Event = webhookEventFailure
+	case status.Status == scheduler.SchedulerStatus_Success ||
+		status.Status == scheduler.SchedulerStatus_PartialSuccess:
+		ret.Event = webhookEventSuccess
+	}
+	if err != nil {
+		ret.Error = err.Error()
+	}
+	for _, n := range status.Nodes {
+		if n.Status == scheduler.NodeStatus_Error {
+			ret.FailedSteps = append(ret.FailedSteps, n.Name)
+		}
+	}
+	return ret
+}
+
+func renderWebhook(w *dag.Webhook, data *webhookData) ([]byte, error) {
+	text := w.Template
+	if w.Format != dag.WebhookFormatCustom {
+		text = webhookTemplates[w.Format]
+	}
+	tmpl, err := template.New(w.Format).Funcs(dag.WebhookFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sendWebhook posts the data to the webhook. The URL is expanded with
+// the env of the DAG only when it's sent.
+func sendWebhook(d *dag.DAG, w *dag.Webhook, data *webhookData) error {
+	body, err := renderWebhook(w, data)
+	if err != nil {
+		return err
+	}
+	return utils.PostJSON(dag.NewEnvironment(d.Env...).Expand(w.URL), body)
+}
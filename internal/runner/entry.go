@@ -2,6 +2,7 @@ package runner
 
 import (
 	"log"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"strings"
@@ -9,9 +10,12 @@ import (
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/robfig/cron/v3"
 	"github.com/yohamta/dagu/internal/admin"
+	"github.com/yohamta/dagu/internal/controller"
 	"github.com/yohamta/dagu/internal/dag"
 	"github.com/yohamta/dagu/internal/runner/filenotify"
+	"github.com/yohamta/dagu/internal/scheduler"
 	"github.com/yohamta/dagu/internal/settings"
 	"github.com/yohamta/dagu/internal/storage"
 	"github.com/yohamta/dagu/internal/suspend"
@@ -30,6 +34,11 @@ type Entry struct {
 	Next      time.Time
 	Job       Job
 	EntryType EntryType
+	// Jitter is the max random delay of the start.
+	Jitter time.Duration
+	// Schedule is the schedule of the entry to compute the next time
+	// after it's invoked. It's nil for the entries that don't repeat.
+	Schedule cron.Schedule
 }
 
 func (e *Entry) Invoke() error {
@@ -38,6 +47,11 @@ func (e *Entry) Invoke() error {
 	}
 	switch e.EntryType {
 	case EntryTypeStart:
+		if e.Jitter > 0 {
+			delay := time.Duration(rand.Int63n(int64(e.Jitter) + 1))
+			log.Printf("delay %s by %s", e.Job.String(), delay)
+			time.Sleep(delay)
+		}
 		log.Printf("[%s] start %s", e.Next.Format("2006-01-02 15:04:05"), e.Job.String())
 		return e.Job.Start()
 	case EntryTypeStop:
@@ -54,6 +68,13 @@ type EntryReader interface {
 	Read(now time.Time) ([]*Entry, error)
 }
 
+// CatchUpReader is implemented by the EntryReader that returns the
+// entries to start the DAGs with catchUp whose scheduled start before
+// now was missed since the last run.
+type CatchUpReader interface {
+	ReadCatchUp(now time.Time) ([]*Entry, error)
+}
+
 func newEntryReader(cfg *admin.Config) *entryReader {
 	er := &entryReader{
 		Admin: cfg,
@@ -64,6 +85,8 @@ func newEntryReader(cfg *admin.Config) *entryReader {
 		),
 		dagsLock: sync.Mutex{},
 		dags:     map[string]*dag.DAG{},
+		defs:     map[string]*dag.DAG{},
+		queue:    newRunQueue(queueInterval),
 	}
 	if err := er.initDags(); err != nil {
 		log.Printf("failed to init entry dags %v", err)
@@ -77,8 +100,16 @@ type entryReader struct {
 	suspendChecker *suspend.SuspendChecker
 	dagsLock       sync.Mutex
 	dags           map[string]*dag.DAG
+	// defs are the DAGs with onChange loaded without evaluation to
+	// compute the diff when the files change.
+	defs  map[string]*dag.DAG
+	queue *runQueue
 }
 
+// queueInterval is the interval to check if the DAG with queued starts
+// is still running.
+const queueInterval = time.Second
+
 var _ EntryReader = (*entryReader)(nil)
 
 func (er *entryReader) Read(now time.Time) ([]*Entry, error) {
@@ -89,14 +120,27 @@ func (er *entryReader) Read(now time.Time) ([]*Entry, error) {
 	f := func(d *dag.DAG, s []*dag.Schedule, e EntryType) {
 		for _, ss := range s {
 			next := ss.Parsed.Next(now)
+			if next.IsZero() {
+				// the schedule never fires again, e.g. a business day
+				// which no month has.
+				continue
+			}
+			j := &job{
+				DAG:      d,
+				Config:   er.Admin,
+				Next:     next,
+				Queue:    er.queue,
+				Schedule: ss.Expression,
+			}
+			if d.SkipIfSuccessful && e == EntryTypeStart {
+				j.Prev = ss.Prev(next)
+			}
 			entries = append(entries, &Entry{
-				Next: ss.Parsed.Next(now),
-				Job: &job{
-					DAG:    d,
-					Config: er.Admin,
-					Next:   next,
-				},
+				Next:      next,
+				Job:       j,
 				EntryType: e,
+				Jitter:    ss.Jitter,
+				Schedule:  ss.Parsed,
 			})
 		}
 	}
@@ -113,6 +157,55 @@ func (er *entryReader) Read(now time.Time) ([]*Entry, error) {
 	return entries, nil
 }
 
+var _ CatchUpReader = (*entryReader)(nil)
+
+func (er *entryReader) ReadCatchUp(now time.Time) ([]*Entry, error) {
+	entries := []*Entry{}
+	er.dagsLock.Lock()
+	defer er.dagsLock.Unlock()
+
+	for _, d := range er.dags {
+		if !d.CatchUp || er.suspendChecker.IsSuspended(d) {
+			continue
+		}
+		// a single run for the latest missed start
+		var prev time.Time
+		schedule := ""
+		for _, s := range d.Schedule {
+			if p := s.Prev(now); p.After(prev) {
+				prev = p
+				schedule = s.Expression
+			}
+		}
+		if prev.IsZero() || !er.missed(d, prev) {
+			continue
+		}
+		entries = append(entries, &Entry{
+			Next:      prev,
+			Job:       &job{DAG: d, Config: er.Admin, Next: prev, Schedule: schedule},
+			EntryType: EntryTypeStart,
+		})
+	}
+	return entries, nil
+}
+
+// missed returns true if the DAG has run before and the last run started
+// before the scheduled time. The last run is read from the whole history
+// since it may have been on a previous day.
+func (er *entryReader) missed(d *dag.DAG, scheduled time.Time) bool {
+	c := controller.New(d)
+	if s, err := c.GetStatus(); err != nil ||
+		s.Status == scheduler.SchedulerStatus_Running {
+		return false
+	}
+	hist := c.GetStatusHist(1)
+	if len(hist) == 0 || hist[0].Status.Status == scheduler.SchedulerStatus_None {
+		return false
+	}
+	t, err := utils.ParseTime(hist[0].Status.StartedAt)
+	return err == nil && t.Before(scheduled)
+}
+
 func (er *entryReader) initDags() error {
 	er.dagsLock.Lock()
 	defer er.dagsLock.Unlock()
@@ -123,13 +216,14 @@ func (er *entryReader) initDags() error {
 	}
 	fileNames := []string{}
 	for _, fi := range fis {
-		if utils.MatchExtension(fi.Name(), dag.EXTENSIONS) {
+		if utils.MatchExtension(fi.Name(), dag.EXTENSIONS) && !dag.IsProjectFile(fi.Name()) {
 			dag, err := cl.LoadHeadOnly(filepath.Join(er.Admin.DAGs, fi.Name()))
 			if err != nil {
 				log.Printf("init dags failed to read dag config: %s", err)
 				continue
 			}
 			er.dags[fi.Name()] = dag
+			er.loadDef(fi.Name(), dag)
 			fileNames = append(fileNames, fi.Name())
 		}
 	}
@@ -138,7 +232,6 @@ func (er *entryReader) initDags() error {
 }
 
 func (er *entryReader) watchDags() {
-	cl := dag.Loader{}
 	watcher, err := filenotify.New(time.Minute)
 	if err != nil {
 		log.Fatal(err)
@@ -151,24 +244,10 @@ func (er *entryReader) watchDags() {
 			if !ok {
 				return
 			}
-			if !utils.MatchExtension(event.Name, dag.EXTENSIONS) {
+			if !utils.MatchExtension(event.Name, dag.EXTENSIONS) || dag.IsProjectFile(event.Name) {
 				continue
 			}
-			er.dagsLock.Lock()
-			if event.Op == fsnotify.Create || event.Op == fsnotify.Write {
-				dag, err := cl.LoadHeadOnly(filepath.Join(er.Admin.DAGs, filepath.Base(event.Name)))
-				if err != nil {
-					log.Printf("failed to read dag config: %s", err)
-				} else {
-					er.dags[filepath.Base(event.Name)] = dag
-					log.Printf("reload dag entry %s", event.Name)
-				}
-			}
-			if event.Op == fsnotify.Rename || event.Op == fsnotify.Remove {
-				delete(er.dags, filepath.Base(event.Name))
-				log.Printf("remove dag entry %s", event.Name)
-			}
-			er.dagsLock.Unlock()
+			er.handleEvent(event)
 		case err, ok := <-watcher.Errors():
 			if !ok {
 				return
@@ -176,5 +255,56 @@ func (er *entryReader) watchDags() {
 			log.Println("watch entry dags error:", err)
 		}
 	}
+}
 
+func (er *entryReader) handleEvent(event fsnotify.Event) {
+	name := filepath.Base(event.Name)
+	var (
+		url    string
+		change *changeNotification
+	)
+	er.dagsLock.Lock()
+	if event.Op == fsnotify.Create || event.Op == fsnotify.Write {
+		cl := dag.Loader{}
+		d, err := cl.LoadHeadOnly(filepath.Join(er.Admin.DAGs, name))
+		if err != nil {
+			log.Printf("failed to read dag config: %s", err)
+		} else {
+			er.dags[name] = d
+			log.Printf("reload dag entry %s", event.Name)
+			prev := er.defs[name]
+			if cur := er.loadDef(name, d); prev != nil && cur != nil {
+				if diff := prev.Diff(cur); len(diff) > 0 {
+					url, change = cur.OnChange, newChangeNotification(name, cur, diff)
+				}
+			}
+		}
+	}
+	if event.Op == fsnotify.Rename || event.Op == fsnotify.Remove {
+		delete(er.dags, name)
+		delete(er.defs, name)
+		log.Printf("remove dag entry %s", event.Name)
+	}
+	er.dagsLock.Unlock()
+	if change != nil {
+		utils.LogErr("notify change", notifyChange(url, change))
+	}
+}
+
+// loadDef loads the definition of the DAG with onChange to compute the
+// diff on the next change. It returns nil if the DAG has no onChange.
+func (er *entryReader) loadDef(name string, head *dag.DAG) *dag.DAG {
+	if head.OnChange == "" {
+		delete(er.defs, name)
+		return nil
+	}
+	cl := dag.Loader{}
+	d, err := cl.LoadWithoutEval(filepath.Join(er.Admin.DAGs, name))
+	if err != nil {
+		log.Printf("failed to read dag config: %s", err)
+		delete(er.defs, name)
+		return nil
+	}
+	er.defs[name] = d
+	return d
 }
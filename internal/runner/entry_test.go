@@ -1,13 +1,25 @@
 package runner
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"path"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
+
 	"github.com/stretchr/testify/require"
 
 	"github.com/yohamta/dagu/internal/admin"
+	"github.com/yohamta/dagu/internal/dag"
+	"github.com/yohamta/dagu/internal/database"
+	"github.com/yohamta/dagu/internal/models"
+	"github.com/yohamta/dagu/internal/scheduler"
 	"github.com/yohamta/dagu/internal/settings"
 	"github.com/yohamta/dagu/internal/storage"
 	"github.com/yohamta/dagu/internal/suspend"
@@ -54,3 +66,177 @@ func TestReadEntries(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, len(entries)-1, len(lives))
 }
+
+func TestReadEntriesNoNext(t *testing.T) {
+	d := &dag.DAG{
+		Name:     "no_next",
+		Location: filepath.Join(t.TempDir(), "no_next.yaml"),
+		Schedule: []*dag.Schedule{{
+			Expression: "businessDay 24 00:00",
+			Parsed:     &dag.BusinessDaySchedule{Day: 24},
+		}},
+	}
+	er := &entryReader{
+		Admin: testConfig,
+		suspendChecker: suspend.NewSuspendChecker(
+			storage.NewStorage(settings.MustGet(settings.SETTING__SUSPEND_FLAGS_DIR)),
+		),
+		dags: map[string]*dag.DAG{"no_next.yaml": d},
+	}
+
+	// the schedule which never fires is not due
+	entries, err := er.Read(time.Now())
+	require.NoError(t, err)
+	require.Len(t, entries, 0)
+}
+
+func TestEntryOnChange(t *testing.T) {
+	received := make(chan *changeNotification, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := &changeNotification{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(n))
+		received <- n
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "on_change.yaml")
+	write := func(command string) {
+		require.NoError(t, os.WriteFile(file, []byte(fmt.Sprintf(`onChange: %s
+steps:
+  - name: "1"
+    command: "%s"
+`, srv.URL, command)), 0644))
+	}
+	write("true")
+
+	er := &entryReader{
+		Admin: &admin.Config{DAGs: dir},
+		dags:  map[string]*dag.DAG{},
+		defs:  map[string]*dag.DAG{},
+	}
+	require.NoError(t, er.initDags())
+
+	write("false")
+	er.handleEvent(fsnotify.Event{Name: file, Op: fsnotify.Write})
+
+	select {
+	case n := <-received:
+		require.Equal(t, &changeNotification{
+			Name: "on_change",
+			File: "on_change.yaml",
+			Diff: []string{`steps[1].command changed: "true" -> "false"`},
+		}, n)
+	case <-time.After(time.Second * 5):
+		t.Fatal("onChange webhook was not called")
+	}
+
+	// no notification without changes
+	er.handleEvent(fsnotify.Event{Name: file, Op: fsnotify.Write})
+	select {
+	case n := <-received:
+		t.Fatalf("unexpected notification: %v", n)
+	default:
+	}
+}
+
+func TestReadCatchUp(t *testing.T) {
+	file := path.Join(testdataDir, "catch_up.yaml")
+	cl := dag.Loader{}
+	d, err := cl.LoadHeadOnly(file)
+	require.NoError(t, err)
+	require.True(t, d.CatchUp)
+
+	er := &entryReader{
+		Admin: testConfig,
+		suspendChecker: suspend.NewSuspendChecker(
+			storage.NewStorage(settings.MustGet(settings.SETTING__SUSPEND_FLAGS_DIR)),
+		),
+		dags: map[string]*dag.DAG{"catch_up.yaml": d},
+	}
+
+	// never run
+	entries, err := er.ReadCatchUp(time.Now())
+	require.NoError(t, err)
+	require.Len(t, entries, 0)
+
+	require.NoError(t, (&job{DAG: d, Config: testConfig}).start())
+
+	// no start was missed since the last run
+	entries, err = er.ReadCatchUp(time.Now())
+	require.NoError(t, err)
+	require.Len(t, entries, 0)
+
+	// a single run for the missed starts
+	now := time.Now().Add(time.Hour * 3)
+	entries, err = er.ReadCatchUp(now)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, EntryTypeStart, entries[0].EntryType)
+	latest := d.Schedule[0].Prev(now)
+	if p := d.Schedule[1].Prev(now); p.After(latest) {
+		latest = p
+	}
+	require.Equal(t, latest, entries[0].Next)
+}
+
+func TestEntryJitter(t *testing.T) {
+	jitter := time.Millisecond * 300
+	for i := 0; i < 5; i++ {
+		j := &startTimeJob{}
+		e := &Entry{
+			Job:       j,
+			EntryType: EntryTypeStart,
+			Jitter:    jitter,
+		}
+		start := time.Now()
+		require.NoError(t, e.Invoke())
+		require.False(t, j.startedAt.Before(start))
+		require.LessOrEqual(t, j.startedAt.Sub(start), jitter+time.Millisecond*50)
+	}
+}
+
+type startTimeJob struct {
+	mockJob
+	startedAt time.Time
+}
+
+func (j *startTimeJob) Start() error {
+	j.startedAt = time.Now()
+	return nil
+}
+
+func TestReadCatchUpPreviousDay(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "catch_up_previous_day.yaml")
+	b, err := os.ReadFile(path.Join(testdataDir, "catch_up.yaml"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(file, b, 0644))
+
+	cl := dag.Loader{}
+	d, err := cl.LoadHeadOnly(file)
+	require.NoError(t, err)
+
+	er := &entryReader{
+		Admin: testConfig,
+		suspendChecker: suspend.NewSuspendChecker(
+			storage.NewStorage(settings.MustGet(settings.SETTING__SUSPEND_FLAGS_DIR)),
+		),
+		dags: map[string]*dag.DAG{"catch_up_previous_day.yaml": d},
+	}
+
+	// the last run was on the previous day
+	startedAt := time.Now().Add(-time.Hour * 24)
+	db := &database.Database{Config: database.DefaultConfig()}
+	w, _, err := db.NewWriter(d.Location, startedAt, "previous-day")
+	require.NoError(t, err)
+	require.NoError(t, w.Open())
+	status := models.NewStatus(d, nil, scheduler.SchedulerStatus_Success,
+		int(models.PidNotRunning), &startedAt, &startedAt)
+	require.NoError(t, w.Write(status))
+	require.NoError(t, w.Close())
+
+	entries, err := er.ReadCatchUp(time.Now())
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, EntryTypeStart, entries[0].EntryType)
+}
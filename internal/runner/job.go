@@ -22,6 +22,14 @@ type job struct {
 	DAG    *dag.DAG
 	Config *admin.Config
 	Next   time.Time
+	// Prev is the previous scheduled time before Next. It's set when the
+	// DAG enables skipIfSuccessful.
+	Prev time.Time
+	// Queue queues the start while the DAG is running if the DAG
+	// enables the queue.
+	Queue *runQueue
+	// Schedule is the expression of the schedule that triggers the job.
+	Schedule string
 }
 
 var _ Job = (*job)(nil)
@@ -30,6 +38,7 @@ var (
 	ErrJobRunning      = errors.New("job already running")
 	ErrJobIsNotRunning = errors.New("job is not running")
 	ErrJobFinished     = errors.New("job already finished")
+	ErrJobSuccess      = errors.New("job already successful since the previous schedule")
 )
 
 func (j *job) Start() error {
@@ -41,6 +50,9 @@ func (j *job) Start() error {
 	switch s.Status {
 	case scheduler.SchedulerStatus_Running:
 		// already running
+		if j.DAG.Queue && j.Queue != nil {
+			return j.Queue.push(j.DAG.Location, j.DAG.QueueLimit, j.isRunning, j.start)
+		}
 		return ErrJobRunning
 	case scheduler.SchedulerStatus_None:
 	default:
@@ -51,12 +63,31 @@ func (j *job) Start() error {
 			if t.After(j.Next) || j.Next.Equal(t) {
 				return ErrJobFinished
 			}
+			// the run at Prev is the previous scheduled run, which
+			// doesn't skip this one.
+			if j.DAG.SkipIfSuccessful && !j.Prev.IsZero() &&
+				s.Status == scheduler.SchedulerStatus_Success && t.After(j.Prev) {
+				return ErrJobSuccess
+			}
 		}
 		// should not be here
 	}
+	return j.start()
+}
+
+func (j *job) start() error {
+	c := controller.New(j.DAG)
+	if j.Schedule != "" {
+		return c.StartScheduled(j.Config.Command, j.Config.WorkDir, j.Schedule)
+	}
 	return c.Start(j.Config.Command, j.Config.WorkDir, "")
 }
 
+func (j *job) isRunning() bool {
+	s, err := controller.New(j.DAG).GetLastStatus()
+	return err == nil && s.Status == scheduler.SchedulerStatus_Running
+}
+
 func (j *job) Stop() error {
 	c := controller.New(j.DAG)
 	s, err := c.GetLastStatus()
@@ -77,3 +108,8 @@ func (j *job) Restart() error {
 func (j *job) String() string {
 	return j.DAG.Name
 }
+
+// Location returns the location of the DAG file of the job.
+func (j *job) Location() string {
+	return j.DAG.Location
+}
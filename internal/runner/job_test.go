@@ -8,7 +8,12 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/yohamta/dagu/internal/controller"
+	"github.com/yohamta/dagu/internal/dag"
 	"github.com/yohamta/dagu/internal/scheduler"
+	"github.com/yohamta/dagu/internal/settings"
+	"github.com/yohamta/dagu/internal/storage"
+	"github.com/yohamta/dagu/internal/suspend"
+	"github.com/yohamta/dagu/internal/utils"
 )
 
 func TestJobStart(t *testing.T) {
@@ -68,3 +73,77 @@ func TestJobSop(t *testing.T) {
 	s, _ := c.GetLastStatus()
 	require.Equal(t, scheduler.SchedulerStatus_Cancel, s.Status)
 }
+
+func TestJobSkipIfSuccessful(t *testing.T) {
+	file := path.Join(testdataDir, "skip_if_successful.yaml")
+	dr := controller.NewDAGReader()
+	dag, err := dr.ReadDAG(file, false)
+	require.NoError(t, err)
+	require.True(t, dag.DAG.SkipIfSuccessful)
+
+	j := &job{
+		DAG:    dag.DAG,
+		Config: testConfig,
+	}
+	require.NoError(t, j.start())
+
+	c := controller.New(dag.DAG)
+	s, _ := c.GetLastStatus()
+	require.Equal(t, scheduler.SchedulerStatus_Success, s.Status)
+
+	// succeeded since the previous scheduled time
+	requestId := s.RequestId
+	startedAt, err := utils.ParseTime(s.StartedAt)
+	require.NoError(t, err)
+	prev := startedAt.Truncate(time.Minute).Add(-time.Minute)
+	j.Prev = prev
+	j.Next = prev.Add(time.Hour)
+	require.Equal(t, ErrJobSuccess, j.Start())
+
+	// the run at the previous scheduled time doesn't skip the next one
+	prev = startedAt.Truncate(time.Minute)
+	j.Prev = prev
+	j.Next = prev.Add(time.Hour)
+	// the history is ordered by the second the runs started at
+	time.Sleep(time.Second)
+	require.NoError(t, j.Start())
+	s, _ = c.GetLastStatus()
+	require.NotEqual(t, requestId, s.RequestId)
+	require.Equal(t, scheduler.SchedulerStatus_Success, s.Status)
+}
+
+func TestJobSchedule(t *testing.T) {
+	file := path.Join(testdataDir, "catch_up.yaml")
+	cl := dag.Loader{}
+	d, err := cl.LoadHeadOnly(file)
+	require.NoError(t, err)
+	require.Len(t, d.Schedule, 2)
+
+	er := &entryReader{
+		Admin: testConfig,
+		suspendChecker: suspend.NewSuspendChecker(
+			storage.NewStorage(settings.MustGet(settings.SETTING__SUSPEND_FLAGS_DIR)),
+		),
+		dags: map[string]*dag.DAG{"catch_up.yaml": d},
+	}
+
+	// the second schedule fires first
+	now := time.Now().Truncate(time.Hour).Add(time.Minute * 10)
+	entries, err := er.Read(now)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	first := entries[0]
+	for _, e := range entries[1:] {
+		if e.Next.Before(first.Next) {
+			first = e
+		}
+	}
+	j := first.Job.(*job)
+	require.Equal(t, "30 * * * *", j.Schedule)
+	require.NoError(t, j.start())
+
+	s, err := controller.New(d).GetLastStatus()
+	require.NoError(t, err)
+	require.Equal(t, scheduler.SchedulerStatus_Success, s.Status)
+	require.Equal(t, "30 * * * *", s.Schedule)
+}
@@ -0,0 +1,89 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/yohamta/dagu/internal/utils"
+	"golang.org/x/sys/unix"
+)
+
+// Locker is a lock shared by scheduler instances to ensure that
+// only one of them fires an entry.
+type Locker interface {
+	// TryLock acquires the lock of the key without blocking.
+	// It returns false if the lock is held by others.
+	TryLock(key string) (bool, error)
+	// Unlock releases the lock of the key.
+	Unlock(key string) error
+}
+
+// FileLocker is a Locker using flock on files in a directory.
+// The directory can be shared by schedulers on the same host.
+type FileLocker struct {
+	Dir string
+
+	mu    sync.Mutex
+	files map[string]*os.File
+}
+
+var _ Locker = (*FileLocker)(nil)
+
+func NewFileLocker(dir string) *FileLocker {
+	return &FileLocker{
+		Dir:   dir,
+		files: map[string]*os.File{},
+	}
+}
+
+func (l *FileLocker) TryLock(key string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.files[key]; ok {
+		return false, nil
+	}
+	if err := os.MkdirAll(l.Dir, 0755); err != nil {
+		return false, err
+	}
+	f, err := os.OpenFile(l.lockFile(key), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return false, err
+	}
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		_ = f.Close()
+		if errors.Is(err, unix.EWOULDBLOCK) {
+			return false, nil
+		}
+		return false, err
+	}
+	l.files[key] = f
+	return true, nil
+}
+
+func (l *FileLocker) Unlock(key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, ok := l.files[key]
+	if !ok {
+		return fmt.Errorf("lock is not held: %s", key)
+	}
+	delete(l.files, key)
+	err := unix.Flock(int(f.Fd()), unix.LOCK_UN)
+	_ = f.Close()
+	if err != nil {
+		return err
+	}
+	// the runner doesn't lock the key again after it's released, so the
+	// file is removed not to leave a file for every entry fired.
+	if err := os.Remove(f.Name()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (l *FileLocker) lockFile(key string) string {
+	return path.Join(l.Dir, fmt.Sprintf("%s.lock", utils.ValidFilename(key, "_")))
+}
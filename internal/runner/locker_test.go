@@ -0,0 +1,113 @@
+package runner
+
+import (
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yohamta/dagu/internal/dag"
+)
+
+func TestFileLocker(t *testing.T) {
+	dir, err := os.MkdirTemp("", "test-file-locker")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	l1 := NewFileLocker(dir)
+	l2 := NewFileLocker(dir)
+
+	locked, err := l1.TryLock("test")
+	require.NoError(t, err)
+	require.True(t, locked)
+
+	for _, l := range []*FileLocker{l1, l2} {
+		locked, err = l.TryLock("test")
+		require.NoError(t, err)
+		require.False(t, locked)
+	}
+
+	require.NoError(t, l1.Unlock("test"))
+	require.Error(t, l1.Unlock("test"))
+
+	locked, err = l2.TryLock("test")
+	require.NoError(t, err)
+	require.True(t, locked)
+	require.NoError(t, l2.Unlock("test"))
+}
+
+func TestRunnerLock(t *testing.T) {
+	dir, err := os.MkdirTemp("", "test-runner-lock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	j := &slowJob{}
+	er := &mockEntryReader{
+		Entries: []*Entry{
+			{
+				Job:  j,
+				Next: now,
+			},
+		},
+	}
+
+	r1 := NewWithLocker(er, NewFileLocker(dir))
+	r2 := NewWithLocker(er, NewFileLocker(dir))
+	r1.now = func() time.Time { return now }
+	r2.now = func() time.Time { return now }
+
+	r1.run(now)
+	r2.run(now)
+	time.Sleep(time.Millisecond * 300)
+	require.Equal(t, int32(1), atomic.LoadInt32(&j.count))
+
+	// the lock is held after the job finished until the fire time passed
+	r2.run(now)
+	time.Sleep(time.Millisecond * 300)
+	require.Equal(t, int32(1), atomic.LoadInt32(&j.count))
+
+	// the next fire time has another lock
+	next := now.Add(time.Minute)
+	er.Entries = []*Entry{
+		{
+			Job:  j,
+			Next: next,
+		},
+	}
+	r3 := NewWithLocker(er, NewFileLocker(dir))
+	r3.now = func() time.Time { return next.Add(lockHoldTime) }
+	r3.run(next)
+	time.Sleep(time.Millisecond * 300)
+	require.Equal(t, int32(2), atomic.LoadInt32(&j.count))
+
+	// the lock is released and its file is removed once the job finished
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestLockKey(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	entry := func(location string, next time.Time) *Entry {
+		return &Entry{
+			Job:  &job{DAG: &dag.DAG{Name: "same", Location: location}},
+			Next: next,
+		}
+	}
+	require.NotEqual(t, lockKey(entry("a/same.yaml", now)), lockKey(entry("b/same.yaml", now)))
+	require.NotEqual(t, lockKey(entry("a/same.yaml", now)), lockKey(entry("a/same.yaml", now.Add(time.Minute))))
+	require.Equal(t, lockKey(entry("a/same.yaml", now)), lockKey(entry("a/same.yaml", now)))
+}
+
+type slowJob struct {
+	mockJob
+	count int32
+}
+
+func (j *slowJob) Start() error {
+	atomic.AddInt32(&j.count, 1)
+	time.Sleep(time.Millisecond * 100)
+	return nil
+}
@@ -0,0 +1,32 @@
+package runner
+
+import (
+	"encoding/json"
+
+	"github.com/yohamta/dagu/internal/dag"
+	"github.com/yohamta/dagu/internal/utils"
+)
+
+// changeNotification is the payload posted to the onChange webhook
+// of a DAG when its file changed.
+type changeNotification struct {
+	Name string
+	File string
+	Diff []string
+}
+
+func newChangeNotification(file string, d *dag.DAG, diff []dag.FieldDiff) *changeNotification {
+	ret := &changeNotification{Name: d.Name, File: file}
+	for _, f := range diff {
+		ret.Diff = append(ret.Diff, f.String())
+	}
+	return ret
+}
+
+func notifyChange(url string, n *changeNotification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	return utils.PostJSON(url, body)
+}
@@ -0,0 +1,78 @@
+package runner
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrQueueFull is returned when the start of a DAG is triggered while
+// the queue of the DAG is full.
+var ErrQueueFull = errors.New("job queue is full")
+
+// runQueue holds the starts of the DAGs triggered while they are
+// running, and runs them one by one when the running one finishes.
+type runQueue struct {
+	// interval is the interval to check if the DAG is still running.
+	interval time.Duration
+
+	mu       sync.Mutex
+	pending  map[string][]func() error
+	draining map[string]bool
+}
+
+func newRunQueue(interval time.Duration) *runQueue {
+	return &runQueue{
+		interval: interval,
+		pending:  map[string][]func() error{},
+		draining: map[string]bool{},
+	}
+}
+
+// push queues the start of the DAG of the key. It returns ErrQueueFull
+// if the limit of the queued starts is reached.
+func (q *runQueue) push(key string, limit int, running func() bool, start func() error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending[key]) >= limit {
+		return ErrQueueFull
+	}
+	q.pending[key] = append(q.pending[key], start)
+	if !q.draining[key] {
+		q.draining[key] = true
+		go q.drain(key, running)
+	}
+	return nil
+}
+
+// drain runs the queued starts of the DAG in order, each one after the
+// DAG is not running, until the queue is empty.
+func (q *runQueue) drain(key string, running func() bool) {
+	for {
+		for running() {
+			time.Sleep(q.interval)
+		}
+		q.mu.Lock()
+		if len(q.pending[key]) == 0 {
+			delete(q.pending, key)
+			delete(q.draining, key)
+			q.mu.Unlock()
+			return
+		}
+		start := q.pending[key][0]
+		q.pending[key] = q.pending[key][1:]
+		q.mu.Unlock()
+
+		if err := start(); err != nil {
+			log.Printf("runner: queued start failed %s: %v", key, err)
+		}
+	}
+}
+
+// len returns the number of the queued starts of the DAG.
+func (q *runQueue) len(key string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending[key])
+}
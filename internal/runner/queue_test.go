@@ -0,0 +1,54 @@
+package runner
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunQueue(t *testing.T) {
+	q := newRunQueue(time.Millisecond * 10)
+
+	var running int32 = 1
+	var mu sync.Mutex
+	started := []int{}
+	isRunning := func() bool { return atomic.LoadInt32(&running) == 1 }
+	start := func(id int) func() error {
+		return func() error {
+			atomic.StoreInt32(&running, 1)
+			mu.Lock()
+			started = append(started, id)
+			mu.Unlock()
+			time.Sleep(time.Millisecond * 50)
+			atomic.StoreInt32(&running, 0)
+			return nil
+		}
+	}
+
+	// the DAG is running, so the starts are queued up to the limit
+	require.NoError(t, q.push("dag", 2, isRunning, start(1)))
+	require.NoError(t, q.push("dag", 2, isRunning, start(2)))
+	require.Equal(t, ErrQueueFull, q.push("dag", 2, isRunning, start(3)))
+	require.Equal(t, 2, q.len("dag"))
+
+	time.Sleep(time.Millisecond * 50)
+	mu.Lock()
+	require.Empty(t, started)
+	mu.Unlock()
+
+	// the queued starts run one by one when the slot frees
+	atomic.StoreInt32(&running, 0)
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(started) == 2
+	}, time.Second, time.Millisecond*10)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []int{1, 2}, started)
+	require.Equal(t, 0, q.len("dag"))
+}
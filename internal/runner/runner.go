@@ -1,29 +1,45 @@
 package runner
 
 import (
+	"fmt"
 	"log"
 	"sort"
 	"time"
 
+	"github.com/yohamta/dagu/internal/settings"
 	"github.com/yohamta/dagu/internal/utils"
 )
 
 type Runner struct {
 	entryReader EntryReader
+	locker      Locker
+	next        time.Time
 	running     bool
 	stop        chan struct{}
+	// now returns the current time to hold the locks of the entries.
+	now func() time.Time
 }
 
+// New returns a runner that uses the file locker in the locks directory.
 func New(er EntryReader) *Runner {
+	return NewWithLocker(er, NewFileLocker(settings.MustGet(settings.SETTING__LOCKS_DIR)))
+}
+
+// NewWithLocker returns a runner that fires an entry only
+// when it acquires the lock of the entry.
+func NewWithLocker(er EntryReader, l Locker) *Runner {
 	return &Runner{
 		entryReader: er,
+		locker:      l,
 		stop:        make(chan struct{}),
+		now:         utils.Now,
 	}
 }
 
 func (r *Runner) Start() {
 	r.init()
 	t := utils.Now().Truncate(time.Second * 60)
+	r.catchUp(t)
 	timer := time.NewTimer(0)
 	for {
 		select {
@@ -48,22 +64,106 @@ func (r *Runner) run(now time.Time) {
 	sort.SliceStable(entries, func(i, j int) bool {
 		return entries[i].Next.Before(entries[j].Next)
 	})
+	r.next = time.Time{}
 	for _, e := range entries {
 		t := e.Next
 		if t.After(now) {
+			r.setNext(t)
 			break
 		}
-		go func(e *Entry) {
-			err := e.Invoke()
-			if err != nil {
-				log.Printf("runner: entry failed %s: %v", e.Job, err)
-			}
-		}(e)
+		r.invoke(e)
+		if e.Schedule != nil {
+			// the next time of the invoked entry may come before the
+			// next entry, e.g. for a schedule with seconds.
+			r.setNext(e.Schedule.Next(now))
+		}
 	}
 }
 
+// setNext sets the time of the next entry if it's earlier.
+func (r *Runner) setNext(t time.Time) {
+	if !t.IsZero() && (r.next.IsZero() || t.Before(r.next)) {
+		r.next = t
+	}
+}
+
+// catchUp invokes the entries of the starts missed while the scheduler
+// was down if the entry reader supports it.
+func (r *Runner) catchUp(now time.Time) {
+	cr, ok := r.entryReader.(CatchUpReader)
+	if !ok {
+		return
+	}
+	entries, err := cr.ReadCatchUp(now)
+	utils.LogErr("failed to read catch-up entries", err)
+	for _, e := range entries {
+		log.Printf("runner: catch up %s missed at %s", e.Job, e.Next.Format("2006-01-02 15:04:05"))
+		r.invoke(e)
+	}
+}
+
+// lockHoldTime is how long the lock of an entry is held after the fire
+// time, so that a scheduler which ticks later doesn't fire it again.
+const lockHoldTime = time.Minute
+
+// locatedJob is a job of a DAG file. The location identifies the DAG in
+// the lock key since DAG files can have the same name.
+type locatedJob interface {
+	Location() string
+}
+
+// lockKey returns the key of the lock of the entry, which is unique to
+// the DAG, the entry type and the fire time.
+func lockKey(e *Entry) string {
+	id := e.Job.String()
+	if j, ok := e.Job.(locatedJob); ok {
+		id = j.Location()
+	}
+	return fmt.Sprintf("%s.%d.%d", id, e.EntryType, e.Next.Unix())
+}
+
+// invoke invokes the entry in a goroutine if it acquires the lock
+// of the entry. The lock is held until the entry finished and the
+// lock hold time after the fire time has passed.
+func (r *Runner) invoke(e *Entry) {
+	key := lockKey(e)
+	locked, err := r.locker.TryLock(key)
+	if err != nil {
+		log.Printf("runner: failed to lock %s: %v", e.Job, err)
+		return
+	}
+	if !locked {
+		log.Printf("runner: %s is locked by another scheduler", e.Job)
+		return
+	}
+	// the time to release the lock is fixed before the entry is invoked.
+	releaseAt := time.Now().Add(e.Next.Add(lockHoldTime).Sub(r.now()))
+	go func(e *Entry) {
+		defer func() {
+			unlock := func() {
+				utils.LogErr("unlock entry", r.locker.Unlock(key))
+			}
+			if d := time.Until(releaseAt); d > 0 {
+				time.AfterFunc(d, unlock)
+				return
+			}
+			unlock()
+		}()
+		err := e.Invoke()
+		if err != nil {
+			log.Printf("runner: entry failed %s: %v", e.Job, err)
+		}
+	}(e)
+}
+
+// nextTick returns the next minute or the time of the next entry
+// if it comes earlier, e.g. for a schedule with seconds.
 func (r *Runner) nextTick(now time.Time) time.Time {
-	return now.Add(time.Minute).Truncate(time.Second * 60)
+	next := now.Add(time.Minute).Truncate(time.Second * 60)
+	if r.next.After(now) && r.next.Before(next) {
+		return r.next
+	}
+	return next
 }
 
 func (r *Runner) Stop() {
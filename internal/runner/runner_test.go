@@ -3,9 +3,11 @@ package runner
 import (
 	"os"
 	"path"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/robfig/cron/v3"
 	"github.com/stretchr/testify/require"
 
 	"github.com/yohamta/dagu/internal/admin"
@@ -91,6 +93,106 @@ func TestNextTick(t *testing.T) {
 	require.Equal(t, time.Date(2020, 1, 1, 1, 1, 0, 0, time.UTC), next)
 }
 
+func TestNextTickWithSeconds(t *testing.T) {
+	n := time.Date(2020, 1, 1, 1, 0, 0, 0, time.UTC)
+	er := &mockEntryReader{
+		Entries: []*Entry{
+			{
+				Job:  &mockJob{},
+				Next: n.Add(time.Second * 30),
+			},
+		},
+	}
+	r := New(er)
+	r.run(n)
+	require.Equal(t, n.Add(time.Second*30), r.nextTick(n))
+
+	r.run(n.Add(time.Second * 30))
+	require.Equal(t, n.Add(time.Minute), r.nextTick(n.Add(time.Second*30)))
+}
+
+func TestNextTickAfterInvoke(t *testing.T) {
+	n := time.Date(2020, 1, 1, 1, 0, 0, 0, time.UTC)
+	parsed, err := cron.NewParser(cron.Second | cron.Minute | cron.Hour |
+		cron.Dom | cron.Month | cron.Dow).Parse("*/30 * * * * *")
+	require.NoError(t, err)
+	j := &mockJob{}
+	er := &scheduleEntryReader{Job: j, Schedule: parsed}
+	r := NewWithLocker(er, &mockLocker{})
+
+	// fires at :00 and then at :30 before the next minute
+	r.run(n)
+	require.Eventually(t, func() bool { return j.ReadRunCount() == 1 },
+		time.Second, time.Millisecond*10)
+	next := r.nextTick(n)
+	require.Equal(t, n.Add(time.Second*30), next)
+
+	r.run(next)
+	require.Eventually(t, func() bool { return j.ReadRunCount() == 2 },
+		time.Second, time.Millisecond*10)
+	require.Equal(t, n.Add(time.Minute), r.nextTick(next))
+}
+
+// scheduleEntryReader reads the entry of the job at the next time of
+// the schedule as the entry reader does.
+type scheduleEntryReader struct {
+	Job      Job
+	Schedule cron.Schedule
+}
+
+func (er *scheduleEntryReader) Read(now time.Time) ([]*Entry, error) {
+	return []*Entry{{
+		Next:     er.Schedule.Next(now),
+		Job:      er.Job,
+		Schedule: er.Schedule,
+	}}, nil
+}
+
+func TestCatchUp(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	utils.FixedTime = now
+
+	missed := &mockJob{Name: "catch_up"}
+	er := &mockCatchUpReader{
+		mockEntryReader: mockEntryReader{
+			Entries: []*Entry{
+				{
+					Job:  &mockJob{Name: "catch_up_next"},
+					Next: now.Add(time.Minute),
+				},
+			},
+		},
+		CatchUp: []*Entry{
+			{
+				Job:  missed,
+				Next: now.Add(-time.Hour),
+			},
+		},
+	}
+
+	r := New(er)
+	go func() {
+		r.Start()
+	}()
+
+	time.Sleep(time.Second + time.Millisecond*100)
+	r.Stop()
+
+	require.Equal(t, 1, missed.RunCount)
+	require.Equal(t, 0, er.Entries[0].Job.(*mockJob).RunCount)
+}
+
+type mockCatchUpReader struct {
+	mockEntryReader
+	CatchUp []*Entry
+}
+
+var _ CatchUpReader = (*mockCatchUpReader)(nil)
+
+func (er *mockCatchUpReader) ReadCatchUp(now time.Time) ([]*Entry, error) {
+	return er.CatchUp, nil
+}
+
 type mockEntryReader struct {
 	Entries []*Entry
 }
@@ -101,7 +203,15 @@ func (er *mockEntryReader) Read(now time.Time) ([]*Entry, error) {
 	return er.Entries, nil
 }
 
+type mockLocker struct{}
+
+var _ Locker = (*mockLocker)(nil)
+
+func (l *mockLocker) TryLock(key string) (bool, error) { return true, nil }
+func (l *mockLocker) Unlock(key string) error          { return nil }
+
 type mockJob struct {
+	mu           sync.Mutex
 	Name         string
 	RunCount     int
 	StopCount    int
@@ -116,13 +226,21 @@ func (j *mockJob) String() string {
 }
 
 func (j *mockJob) Start() error {
+	j.mu.Lock()
 	j.RunCount++
+	j.mu.Unlock()
 	if j.Panic != nil {
 		panic(j.Panic)
 	}
 	return nil
 }
 
+func (j *mockJob) ReadRunCount() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.RunCount
+}
+
 func (j *mockJob) Stop() error {
 	j.StopCount++
 	return nil
@@ -0,0 +1,74 @@
+package scheduler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Artifact is a file produced by a step which matches one of the
+// artifacts patterns of the step.
+type Artifact struct {
+	Path     string
+	Size     int64
+	Checksum string
+}
+
+// collectArtifacts returns the files matching the patterns. Relative
+// patterns are resolved against the working directory of the step.
+func collectArtifacts(dir string, patterns []string) ([]*Artifact, error) {
+	ret := []*Artifact{}
+	seen := map[string]bool{}
+	for _, p := range patterns {
+		if !filepath.IsAbs(p) && dir != "" {
+			p = filepath.Join(dir, p)
+		}
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to collect artifacts %s: %w", p, err)
+		}
+		for _, m := range matches {
+			if seen[m] {
+				continue
+			}
+			seen[m] = true
+			a, err := newArtifact(m)
+			if err != nil {
+				return nil, fmt.Errorf("failed to collect artifact %s: %w", m, err)
+			}
+			if a != nil {
+				ret = append(ret, a)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// newArtifact returns the artifact of the file, or nil if the path is
+// a directory.
+func newArtifact(file string) (*Artifact, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, nil
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return &Artifact{
+		Path:     file,
+		Size:     info.Size(),
+		Checksum: hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
@@ -4,15 +4,20 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/yohamta/dagu/internal/constants"
 	"github.com/yohamta/dagu/internal/dag"
 	"github.com/yohamta/dagu/internal/executor"
 	"github.com/yohamta/dagu/internal/utils"
@@ -64,10 +69,53 @@ type Node struct {
 	stdoutWriter *bufio.Writer
 	stderrFile   *os.File
 	stderrWriter *bufio.Writer
-	outputWriter *os.File
-	outputReader *os.File
+	output       *outputBuffer
 	scriptFile   *os.File
+	retryOutput  *outputBuffer
+	prevOutput   *string
 	done         bool
+	// firstStartedAt is the start time of the first attempt, from which
+	// the elapsed time of the retries is measured.
+	firstStartedAt time.Time
+	// hook is the node of the onSuccess or onFailure hook run after
+	// the step.
+	hook *Node
+}
+
+// outputBuffer captures the output of a command, e.g. to be matched for
+// retry. The bytes beyond max are discarded if max is greater than zero.
+type outputBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	max int
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.max <= 0 {
+		return b.buf.Write(p)
+	}
+	if rest := b.max - b.buf.Len(); rest > 0 {
+		if len(p) > rest {
+			b.buf.Write(p[:rest])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (b *outputBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *outputBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte{}, b.buf.Bytes()...)
 }
 
 // NodeState is the state of a node.
@@ -78,8 +126,16 @@ type NodeState struct {
 	FinishedAt time.Time
 	RetryCount int
 	RetriedAt  time.Time
-	DoneCount  int
-	Error      error
+	// Duration is the execution time of the command of the last attempt.
+	Duration time.Duration
+	// ExitCode is the exit code of the command of the last attempt. It's
+	// nil if the command didn't exit, e.g. it failed to start.
+	ExitCode      *int
+	DoneCount     int
+	Error         error
+	SkipReason    *dag.ConditionResult
+	OutputValue   string
+	ArtifactFiles []*Artifact
 }
 
 // Execute runs the command synchronously and returns error if any.
@@ -87,8 +143,31 @@ func (n *Node) Execute() error {
 	ctx, fn := context.WithCancel(context.Background())
 	n.cancelFunc = fn
 
-	if n.CmdWithArgs != "" {
-		n.Command, n.Args = utils.SplitCommand(n.CmdWithArgs, true)
+	if n.Output != "" && n.ReadRetryCount() > 0 {
+		// the output of the failed attempt must not be seen by the retry.
+		n.OutputVariables.Delete(n.Output)
+		n.OutputValue = ""
+	}
+
+	step := n.Step
+	if n.RepeatPolicy.Repeat {
+		s := *n.Step
+		s.Variables = append(append([]string{}, n.Variables...),
+			fmt.Sprintf("%s=%d", constants.EnvRepeatIndex, n.ReadDoneCount()))
+		step = &s
+	}
+	env := stepEnvironment(step)
+
+	if len(n.CmdArgv) > 0 {
+		// each argument is expanded as it is without word-splitting.
+		n.Command, n.Args = env.Expand(n.CmdArgv[0]), []string{}
+		for _, a := range n.CmdArgv[1:] {
+			n.Args = append(n.Args, env.Expand(a))
+		}
+		n.Args = append(n.Args, n.FileArgs...)
+	} else if n.CmdWithArgs != "" {
+		n.Command, n.Args = utils.SplitCommandWithEnv(n.CmdWithArgs, env.Expand)
+		n.Args = append(n.Args, n.FileArgs...)
 	}
 
 	if n.scriptFile != nil {
@@ -97,7 +176,7 @@ func (n *Node) Execute() error {
 		n.Args = append(args, n.scriptFile.Name())
 	}
 
-	cmd, err := executor.CreateExecutor(ctx, n.Step)
+	cmd, err := executor.CreateExecutor(ctx, step, env)
 	if err != nil {
 		return err
 	}
@@ -115,34 +194,131 @@ func (n *Node) Execute() error {
 	}
 
 	if n.Output != "" {
-		var err error
-		if n.outputReader, n.outputWriter, err = os.Pipe(); err != nil {
-			return err
+		// the output is captured while the command writes it, so that
+		// it doesn't block on a full pipe and maxBytes bounds the memory.
+		n.output = &outputBuffer{max: n.OutputMaxBytes}
+		if stdout == nil {
+			stdout = n.output
+		} else {
+			stdout = io.MultiWriter(stdout, n.output)
 		}
-		stdout = io.MultiWriter(stdout, n.outputWriter)
 	}
 
-	cmd.SetStdout(stdout)
+	var stderr io.Writer
 	if n.stderrWriter != nil {
-		cmd.SetStderr(n.stderrWriter)
+		stderr = n.stderrWriter
+	}
+	if n.RetryPolicy != nil && n.RetryPolicy.RetryOnOutput != "" {
+		n.retryOutput = &outputBuffer{}
+		if stdout == nil {
+			stdout = n.retryOutput
+		} else {
+			stdout = io.MultiWriter(stdout, n.retryOutput)
+		}
+		if stderr != nil {
+			stderr = io.MultiWriter(stderr, n.retryOutput)
+		}
+	}
+
+	cmd.SetStdout(stdout)
+	if stderr != nil {
+		cmd.SetStderr(stderr)
 	} else {
 		cmd.SetStderr(stdout)
 	}
 
+	stopTimeout := n.watchTimeout(cmd)
+	started := time.Now()
 	n.Error = cmd.Run()
+	n.setDuration(time.Since(started))
+	n.setExitCode(n.Error)
+	if stopTimeout() && n.Error != nil {
+		n.Error = fmt.Errorf("%w: %s: %v", ErrTimeout, n.Timeout, n.Error)
+	}
 
-	if n.outputReader != nil && n.Output != "" {
-		utils.LogErr("close pipe writer", n.outputWriter.Close())
-		var buf bytes.Buffer
-		_, _ = io.Copy(&buf, n.outputReader)
-		ret := strings.TrimSpace(buf.String())
-		os.Setenv(n.Output, ret)
+	if n.output != nil && n.Output != "" {
+		ret := n.encodeOutput(n.output.Bytes())
 		n.OutputVariables.Store(n.Output, fmt.Sprintf("%s=%s", n.Output, ret))
+		if n.OutputAlertOnChange {
+			n.OutputValue = ret
+			if n.Error == nil && n.prevOutput != nil && *n.prevOutput != ret {
+				n.Error = fmt.Errorf("output %s changed from the previous run", n.Output)
+			}
+		}
+	}
+
+	if n.Error == nil && len(n.Step.Artifacts) > 0 {
+		n.ArtifactFiles, n.Error = collectArtifacts(n.Dir, n.Step.Artifacts)
 	}
 
 	return n.Error
 }
 
+// stepEnvironment returns the environment to run the step with: the
+// variables of the step and the outputs of the steps run before it.
+func stepEnvironment(step *dag.Step) *dag.Environment {
+	env := dag.NewEnvironment(step.Variables...)
+	if step.OutputVariables != nil {
+		step.OutputVariables.Range(func(_, value interface{}) bool {
+			kv := strings.SplitN(value.(string), "=", 2)
+			env.SetUnordered(kv[0], kv[1])
+			return true
+		})
+	}
+	return env
+}
+
+// stepTimeoutGracePeriod is the time to wait for the step to exit after
+// SIGTERM is sent on timeout before it's killed.
+var stepTimeoutGracePeriod = time.Second * 5
+
+// watchTimeout sends SIGTERM to the command when the timeout of the step
+// expires, and SIGKILL if it's still running after the grace period.
+// The returned function stops watching and reports if the step timed out.
+func (n *Node) watchTimeout(cmd executor.Executor) func() bool {
+	if n.Timeout <= 0 {
+		return func() bool { return false }
+	}
+	done := make(chan struct{})
+	timedOut := make(chan struct{})
+	go func() {
+		select {
+		case <-done:
+			return
+		case <-time.After(n.Timeout):
+		}
+		close(timedOut)
+		log.Printf("%s timed out after %s", n.Name, n.Timeout)
+		utils.LogErr("terminate step", cmd.Kill(unix.SIGTERM))
+		select {
+		case <-done:
+		case <-time.After(stepTimeoutGracePeriod):
+			utils.LogErr("kill step", cmd.Kill(unix.SIGKILL))
+		}
+	}()
+	return func() bool {
+		close(done)
+		select {
+		case <-timedOut:
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+// encodeOutput truncates the captured output to the max bytes and
+// encodes it according to the output options of the step.
+func (n *Node) encodeOutput(out []byte) string {
+	if n.OutputMaxBytes > 0 && len(out) > n.OutputMaxBytes {
+		out = out[:n.OutputMaxBytes]
+	}
+	if n.OutputEncoding == dag.OutputEncodingBase64 {
+		return base64.StdEncoding.EncodeToString(out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
 // ReadStatus reads the status of a node.
 func (n *Node) ReadStatus() NodeStatus {
 	n.mu.RLock()
@@ -157,6 +333,18 @@ func (n *Node) ReadRetryCount() int {
 	return n.RetryCount
 }
 
+func (n *Node) setDuration(d time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.Duration = d
+}
+
+func (n *Node) ReadDuration() time.Duration {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.Duration
+}
+
 func (n *Node) SetRetriedAt(retriedAt time.Time) {
 	n.mu.Lock()
 	defer n.mu.Unlock()
@@ -169,12 +357,126 @@ func (n *Node) ReadRetriedAt() time.Time {
 	return n.RetriedAt
 }
 
+func (n *Node) ReadStartedAt() time.Time {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.StartedAt
+}
+
+func (n *Node) ReadFinishedAt() time.Time {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.FinishedAt
+}
+
+// HookNode returns the node of the hook run after the step, or nil if
+// no hook has been run.
+func (n *Node) HookNode() *Node {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.hook
+}
+
+func (n *Node) setHook(hook *Node) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.hook = hook
+}
+
+func (n *Node) setFinishedAt(t time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.FinishedAt = t
+}
+
 func (n *Node) ReadDoneCount() int {
 	n.mu.RLock()
 	defer n.mu.RUnlock()
 	return n.DoneCount
 }
 
+// continueOnFailure returns true if the failure of the node doesn't stop
+// the downstream nodes, either by continueOn.failure or by the exit code
+// listed in continueOn.exitCode.
+func (n *Node) continueOnFailure() bool {
+	if n.ContinueOn.Failure {
+		return true
+	}
+	exitCode := n.ReadExitCode()
+	if exitCode == nil {
+		return false
+	}
+	for _, code := range n.ContinueOn.ExitCode {
+		if code == *exitCode {
+			return true
+		}
+	}
+	return false
+}
+
+// setExitCode records the exit code of the command from the error
+// returned by it.
+func (n *Node) setExitCode(err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		code := 0
+		n.ExitCode = &code
+	case errors.As(err, &exitErr):
+		code := exitErr.ExitCode()
+		n.ExitCode = &code
+	default:
+		n.ExitCode = nil
+	}
+}
+
+// ReadExitCode returns the exit code of the command of the last attempt,
+// or nil if the command didn't exit.
+func (n *Node) ReadExitCode() *int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.ExitCode
+}
+
+// canRetry returns true if the retry policy allows another retry. The
+// retries are bounded by the limit and by the time elapsed since the
+// first attempt, either or both of which can be specified.
+func (n *Node) canRetry() bool {
+	p := n.RetryPolicy
+	if p == nil {
+		return false
+	}
+	if (p.Limit > 0 || p.MaxElapsed == 0) && n.ReadRetryCount() >= p.Limit {
+		return false
+	}
+	if p.MaxElapsed > 0 {
+		n.mu.RLock()
+		elapsed := time.Since(n.firstStartedAt)
+		n.mu.RUnlock()
+		if elapsed >= p.MaxElapsed {
+			log.Printf("%s exhausted the retry budget of %s", n.Name, p.MaxElapsed)
+			return false
+		}
+	}
+	return true
+}
+
+// matchRetryOutput returns true if the output of the last run
+// matches the retryOnOutput pattern of the retry policy.
+func (n *Node) matchRetryOutput() bool {
+	if n.RetryPolicy == nil || n.RetryPolicy.RetryOnOutput == "" {
+		return true
+	}
+	if n.retryOutput == nil {
+		return false
+	}
+	matched, err := regexp.MatchString(n.RetryPolicy.RetryOnOutput, n.retryOutput.String())
+	utils.LogErr("match retry output", err)
+	return matched
+}
+
 func (n *Node) clearState() {
 	n.NodeState = NodeState{}
 }
@@ -216,13 +518,19 @@ func (n *Node) cancel() {
 }
 
 func (n *Node) setup(logDir string, requestId string) error {
+	n.mu.Lock()
 	n.StartedAt = time.Now()
+	if n.firstStartedAt.IsZero() {
+		n.firstStartedAt = n.StartedAt
+	}
+	n.mu.Unlock()
 	n.Log = filepath.Join(logDir, fmt.Sprintf("%s.%s.%s.log",
 		utils.ValidFilename(n.Name, "_"),
 		n.StartedAt.Format("20060102.15:04:05.000"),
 		utils.TruncString(requestId, 8),
 	))
 	setup := []func() error{
+		n.setupDir,
 		n.setupLog,
 		n.setupStdout,
 		n.setupStderr,
@@ -238,6 +546,24 @@ func (n *Node) setup(logDir string, requestId string) error {
 	return nil
 }
 
+func (n *Node) setupDir() error {
+	if n.Dir == "" {
+		return nil
+	}
+	fi, err := os.Stat(n.Dir)
+	switch {
+	case os.IsNotExist(err) && n.CreateDir:
+		return os.MkdirAll(n.Dir, 0755)
+	case os.IsNotExist(err):
+		return fmt.Errorf("directory does not exist: %s", n.Dir)
+	case err != nil:
+		return err
+	case !fi.IsDir():
+		return fmt.Errorf("not a directory: %s", n.Dir)
+	}
+	return nil
+}
+
 func (n *Node) setupScript() (err error) {
 	if n.Script != "" {
 		n.scriptFile, _ = os.CreateTemp(n.Dir, "dagu_script-")
@@ -1,10 +1,15 @@
 package scheduler
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"math/rand"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
 	"sync"
 	"syscall"
 	"testing"
@@ -12,6 +17,7 @@ import (
 
 	"github.com/stretchr/testify/require"
 	"github.com/yohamta/dagu/internal/dag"
+	"github.com/yohamta/dagu/internal/utils"
 )
 
 func TestExecute(t *testing.T) {
@@ -76,6 +82,30 @@ func TestSignalSpecified(t *testing.T) {
 	require.Equal(t, n.Status, NodeStatus_Cancel)
 }
 
+func TestSignalOnStopSent(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "signal")
+	n := &Node{
+		Step: &dag.Step{
+			Command: "sh",
+			Args: []string{"-c", fmt.Sprintf(
+				`trap "echo INT > %[1]s; exit 0" INT; trap "echo TERM > %[1]s; exit 0" TERM; sleep 5 & wait`, file)},
+			OutputVariables: &sync.Map{},
+			SignalOnStop:    "SIGINT",
+		}}
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		n.signal(syscall.SIGTERM, true)
+	}()
+
+	n.updateStatus(NodeStatus_Running)
+	_ = n.Execute()
+
+	dat, err := os.ReadFile(file)
+	require.NoError(t, err)
+	require.Equal(t, "INT\n", string(dat))
+}
+
 func TestLog(t *testing.T) {
 	n := &Node{
 		Step: &dag.Step{
@@ -160,11 +190,12 @@ func TestNode(t *testing.T) {
 }
 
 func TestOutput(t *testing.T) {
+	outputs := &sync.Map{}
 	n := &Node{
 		Step: &dag.Step{
 			CmdWithArgs:     "echo hello",
 			Output:          "OUTPUT_TEST",
-			OutputVariables: &sync.Map{},
+			OutputVariables: outputs,
 		},
 	}
 	err := n.setup(os.Getenv("HOME"), "test-request-id-output")
@@ -177,19 +208,21 @@ func TestOutput(t *testing.T) {
 
 	dat, _ := os.ReadFile(n.logFile.Name())
 	require.Equal(t, "hello\n", string(dat))
-	require.Equal(t, "hello", os.ExpandEnv("$OUTPUT_TEST"))
+	require.Equal(t, "hello", testOutput(t, n, "OUTPUT_TEST"))
+	// the output is not published to the process environment
+	require.Empty(t, os.Getenv("OUTPUT_TEST"))
 
 	// Use the previous output in the subsequent step
 	n2 := &Node{
 		Step: &dag.Step{
 			CmdWithArgs:     "echo $OUTPUT_TEST",
 			Output:          "OUTPUT_TEST2",
-			OutputVariables: &sync.Map{},
+			OutputVariables: outputs,
 		},
 	}
 
 	runTestNode(t, n2)
-	require.Equal(t, "hello", os.ExpandEnv("$OUTPUT_TEST2"))
+	require.Equal(t, "hello", testOutput(t, n2, "OUTPUT_TEST2"))
 
 	// Use the previous output in the subsequent step inside a script
 	n3 := &Node{
@@ -197,12 +230,136 @@ func TestOutput(t *testing.T) {
 			Command:         "sh",
 			Script:          "echo $OUTPUT_TEST2",
 			Output:          "OUTPUT_TEST3",
-			OutputVariables: &sync.Map{},
+			OutputVariables: outputs,
 		},
 	}
 
 	runTestNode(t, n3)
-	require.Equal(t, "hello", os.ExpandEnv("$OUTPUT_TEST3"))
+	require.Equal(t, "hello", testOutput(t, n3, "OUTPUT_TEST3"))
+}
+
+func TestArtifacts(t *testing.T) {
+	dir := utils.MustTempDir("node-artifacts")
+	defer os.RemoveAll(dir)
+
+	n := &Node{
+		Step: &dag.Step{
+			Dir:             dir,
+			CmdWithArgs:     "sh -c 'mkdir -p dist && printf abc > dist/a.tar.gz && printf x > dist/b.txt'",
+			Artifacts:       []string{"dist/*.tar.gz"},
+			OutputVariables: &sync.Map{},
+		},
+	}
+	runTestNode(t, n)
+
+	require.Len(t, n.ArtifactFiles, 1)
+	a := n.ArtifactFiles[0]
+	require.Equal(t, filepath.Join(dir, "dist", "a.tar.gz"), a.Path)
+	require.Equal(t, int64(3), a.Size)
+	sum := sha256.Sum256([]byte("abc"))
+	require.Equal(t, hex.EncodeToString(sum[:]), a.Checksum)
+}
+
+func TestOutputEncoding(t *testing.T) {
+	for _, test := range []struct {
+		CmdWithArgs string
+		Encoding    string
+		MaxBytes    int
+		Want        string
+	}{
+		{
+			CmdWithArgs: `printf '\000\001\002\377'`,
+			Encoding:    dag.OutputEncodingBase64,
+			Want:        base64.StdEncoding.EncodeToString([]byte{0, 1, 2, 255}),
+		},
+		{
+			CmdWithArgs: `printf '\000\001\002\377'`,
+			Encoding:    dag.OutputEncodingBase64,
+			MaxBytes:    2,
+			Want:        base64.StdEncoding.EncodeToString([]byte{0, 1}),
+		},
+		{
+			CmdWithArgs: "echo 0123456789",
+			MaxBytes:    4,
+			Want:        "0123",
+		},
+	} {
+		n := &Node{
+			Step: &dag.Step{
+				CmdWithArgs:     test.CmdWithArgs,
+				Output:          "OUTPUT_ENCODING_TEST",
+				OutputEncoding:  test.Encoding,
+				OutputMaxBytes:  test.MaxBytes,
+				OutputVariables: &sync.Map{},
+			},
+		}
+		runTestNode(t, n)
+		require.Equal(t, test.Want, testOutput(t, n, "OUTPUT_ENCODING_TEST"))
+
+		v, ok := n.OutputVariables.Load("OUTPUT_ENCODING_TEST")
+		require.True(t, ok)
+		require.Equal(t, fmt.Sprintf("OUTPUT_ENCODING_TEST=%s", test.Want), v)
+	}
+}
+
+func TestOutputLarge(t *testing.T) {
+	size := 200 * 1024
+	for _, test := range []struct {
+		MaxBytes int
+		Want     int
+	}{
+		{MaxBytes: 0, Want: size},
+		{MaxBytes: 1000, Want: 1000},
+	} {
+		n := &Node{
+			Step: &dag.Step{
+				Command:         "sh",
+				Args:            []string{"-c", fmt.Sprintf("head -c %d /dev/zero | tr '\\000' a", size)},
+				Output:          "OUTPUT_LARGE_TEST",
+				OutputMaxBytes:  test.MaxBytes,
+				OutputVariables: &sync.Map{},
+			},
+		}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			runTestNode(t, n)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second * 5):
+			t.Fatal("the step with a large output didn't finish")
+		}
+		require.Len(t, testOutput(t, n, "OUTPUT_LARGE_TEST"), test.Want)
+	}
+}
+
+func TestFileArgs(t *testing.T) {
+	n := &Node{
+		Step: &dag.Step{
+			CmdWithArgs:     "echo first",
+			FileArgs:        []string{"--name", "dagu", "two words"},
+			Output:          "FILE_ARGS_TEST",
+			OutputVariables: &sync.Map{},
+		},
+	}
+	runTestNode(t, n)
+	require.Equal(t, "first --name dagu two words", testOutput(t, n, "FILE_ARGS_TEST"))
+	require.Equal(t, []string{"first", "--name", "dagu", "two words"}, n.Args)
+}
+
+func TestCmdArgv(t *testing.T) {
+	n := &Node{
+		Step: &dag.Step{
+			CmdArgv:         []string{"printf", "%s|", "A B C", "${CMD_ARGV_TEST_VAR}"},
+			Variables:       []string{"CMD_ARGV_TEST_VAR=x y"},
+			Output:          "CMD_ARGV_TEST",
+			OutputVariables: &sync.Map{},
+		},
+	}
+	runTestNode(t, n)
+	require.Equal(t, []string{"%s|", "A B C", "x y"}, n.Args)
+	require.Equal(t, "A B C|x y|", testOutput(t, n, "CMD_ARGV_TEST"))
 }
 
 func TestOutputJson(t *testing.T) {
@@ -242,7 +399,6 @@ func TestOutputJson(t *testing.T) {
 
 			v, _ := n.OutputVariables.Load("OUTPUT_JSON_TEST")
 			require.Equal(t, fmt.Sprintf("OUTPUT_JSON_TEST=%s", test.Want), v)
-			require.Equal(t, test.Want, os.ExpandEnv("$OUTPUT_JSON_TEST"))
 		})
 	}
 }
@@ -294,7 +450,6 @@ func TestOutputSpecialchar(t *testing.T) {
 
 			v, _ := n.OutputVariables.Load("OUTPUT_SPECIALCHAR_TEST")
 			require.Equal(t, fmt.Sprintf("OUTPUT_SPECIALCHAR_TEST=%s", test.Want), v)
-			require.Equal(t, test.Want, os.ExpandEnv("$OUTPUT_SPECIALCHAR_TEST"))
 		})
 	}
 }
@@ -326,10 +481,53 @@ func TestRunScript(t *testing.T) {
 	err = n.teardown()
 	require.NoError(t, err)
 
-	require.Equal(t, "hello", os.Getenv("SCRIPT_TEST"))
+	require.Equal(t, "hello", testOutput(t, n, "SCRIPT_TEST"))
 	require.NoFileExists(t, n.scriptFile.Name())
 }
 
+func TestSetupDir(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "test-setup-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// create the directory
+	dir := path.Join(tmpDir, "work")
+	n := &Node{
+		Step: &dag.Step{
+			Command:         "true",
+			Dir:             dir,
+			CreateDir:       true,
+			OutputVariables: &sync.Map{},
+		},
+	}
+	runTestNode(t, n)
+	require.DirExists(t, dir)
+
+	// missing directory
+	n = &Node{
+		Step: &dag.Step{
+			Command:         "true",
+			Dir:             path.Join(tmpDir, "missing"),
+			OutputVariables: &sync.Map{},
+		},
+	}
+	require.Error(t, n.setup(tmpDir, "test-request-id"))
+	require.NoDirExists(t, path.Join(tmpDir, "missing"))
+
+	// path is a file
+	file := path.Join(tmpDir, "file")
+	require.NoError(t, os.WriteFile(file, []byte{}, 0644))
+	n = &Node{
+		Step: &dag.Step{
+			Command:         "true",
+			Dir:             file,
+			CreateDir:       true,
+			OutputVariables: &sync.Map{},
+		},
+	}
+	require.Error(t, n.setup(tmpDir, "test-request-id"))
+}
+
 func TestTeardown(t *testing.T) {
 	n := &Node{
 		Step: &dag.Step{
@@ -353,6 +551,14 @@ func TestTeardown(t *testing.T) {
 	require.Error(t, n.Error)
 }
 
+// testOutput returns the value of the output variable of the node.
+func testOutput(t *testing.T, n *Node, name string) string {
+	t.Helper()
+	v, ok := n.OutputVariables.Load(name)
+	require.True(t, ok)
+	return strings.TrimPrefix(v.(string), name+"=")
+}
+
 func runTestNode(t *testing.T, n *Node) {
 	t.Helper()
 	err := n.setup(os.Getenv("HOME"),
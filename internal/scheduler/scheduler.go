@@ -1,9 +1,11 @@
 package scheduler
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -21,6 +23,9 @@ const (
 	SchedulerStatus_Cancel
 	SchedulerStatus_Success
 	SchedulerStatus_Skipped_Unused
+	// SchedulerStatus_PartialSuccess means some steps failed but all of
+	// them were continued on failure.
+	SchedulerStatus_PartialSuccess
 )
 
 func (s SchedulerStatus) String() string {
@@ -33,6 +38,8 @@ func (s SchedulerStatus) String() string {
 		return "canceled"
 	case SchedulerStatus_Success:
 		return "finished"
+	case SchedulerStatus_PartialSuccess:
+		return "partial success"
 	case SchedulerStatus_None:
 		fallthrough
 	default:
@@ -40,11 +47,15 @@ func (s SchedulerStatus) String() string {
 	}
 }
 
+// ErrTimeout is the error of the steps which didn't finish within the timeout.
+var ErrTimeout = errors.New("timeout exceeded")
+
 // Scheduler is a scheduler that runs a graph of steps.
 type Scheduler struct {
 	*Config
 
 	canceled  int32
+	timedOut  bool
 	mu        sync.RWMutex
 	pause     time.Duration
 	lastError error
@@ -61,6 +72,14 @@ type Config struct {
 	OnFailure     *dag.Step
 	OnCancel      *dag.Step
 	RequestId     string
+	// Timeout is the max duration of the steps except the handlers.
+	Timeout time.Duration
+	// HandlerTimeout is the max duration of the handlers. It starts
+	// after the steps are finished or timed out.
+	HandlerTimeout time.Duration
+	// PrevOutputs is the outputs of the previous run by step name,
+	// compared with the steps that alert on output change.
+	PrevOutputs map[string]string
 }
 
 // Schedule runs the graph of steps.
@@ -76,6 +95,17 @@ func (sc *Scheduler) Schedule(g *ExecutionGraph, done chan *Node) error {
 
 	var wg = sync.WaitGroup{}
 
+	var timer *time.Timer
+	if sc.Timeout > 0 {
+		timer = time.AfterFunc(sc.Timeout, func() {
+			log.Printf("timeout exceeded: %s", sc.Timeout)
+			sc.mu.Lock()
+			sc.timedOut = true
+			sc.mu.Unlock()
+			sc.Cancel(g)
+		})
+	}
+
 	for !sc.isFinished(g) {
 		if sc.IsCanceled() {
 			break
@@ -96,10 +126,14 @@ func (sc *Scheduler) Schedule(g *ExecutionGraph, done chan *Node) error {
 			}
 			if len(node.Preconditions) > 0 {
 				log.Printf("checking pre conditions for \"%s\"", node.Name)
-				if err := dag.EvalConditions(node.Preconditions); err != nil {
+				if err := dag.EvalConditions(node.Preconditions, stepEnvironment(node.Step)); err != nil {
 					log.Printf("%s", err.Error())
 					node.updateStatus(NodeStatus_Skipped)
 					node.Error = err
+					var condErr *dag.ConditionError
+					if errors.As(err, &condErr) {
+						node.SkipReason = &condErr.ConditionResult
+					}
 					continue
 				}
 			}
@@ -109,10 +143,14 @@ func (sc *Scheduler) Schedule(g *ExecutionGraph, done chan *Node) error {
 			node.updateStatus(NodeStatus_Running)
 			go func(node *Node) {
 				defer func() {
-					node.FinishedAt = time.Now()
+					node.setFinishedAt(time.Now())
 					wg.Done()
 				}()
 
+				if v, ok := sc.PrevOutputs[node.Name]; ok {
+					node.prevOutput = &v
+				}
+
 				setup := true
 				if !sc.Dry {
 					if err := node.setup(sc.LogDir, sc.RequestId); err != nil {
@@ -148,7 +186,7 @@ func (sc *Scheduler) Schedule(g *ExecutionGraph, done chan *Node) error {
 						node.incDoneCount()
 					}
 					if node.RepeatPolicy.Repeat {
-						if err == nil || node.ContinueOn.Failure {
+						if err == nil || node.continueOnFailure() {
 							if !sc.IsCanceled() {
 								time.Sleep(node.RepeatPolicy.Interval)
 								continue
@@ -156,6 +194,9 @@ func (sc *Scheduler) Schedule(g *ExecutionGraph, done chan *Node) error {
 						}
 					}
 					if err != nil {
+						if node.ReadStatus() == NodeStatus_Error {
+							sc.runStepHook(node, node.OnFailure)
+						}
 						if done != nil {
 							done <- node
 						}
@@ -163,6 +204,10 @@ func (sc *Scheduler) Schedule(g *ExecutionGraph, done chan *Node) error {
 					}
 					break
 				}
+				if node.ReadStatus() == NodeStatus_Running {
+					// the dependents wait for the hook.
+					sc.runStepHook(node, node.OnSuccess)
+				}
 				if node.ReadStatus() == NodeStatus_Running {
 					node.updateStatus(NodeStatus_Success)
 				}
@@ -181,10 +226,16 @@ func (sc *Scheduler) Schedule(g *ExecutionGraph, done chan *Node) error {
 		time.Sleep(sc.pause)
 	}
 	wg.Wait()
+	if timer != nil {
+		timer.Stop()
+	}
+	if sc.isTimedOut() {
+		sc.lastError = ErrTimeout
+	}
 
 	handlers := []string{}
 	switch sc.Status(g) {
-	case SchedulerStatus_Success:
+	case SchedulerStatus_Success, SchedulerStatus_PartialSuccess:
 		handlers = append(handlers, constants.OnSuccess)
 	case SchedulerStatus_Error:
 		handlers = append(handlers, constants.OnFailure)
@@ -192,11 +243,21 @@ func (sc *Scheduler) Schedule(g *ExecutionGraph, done chan *Node) error {
 		handlers = append(handlers, constants.OnCancel)
 	}
 	handlers = append(handlers, constants.OnExit)
+	deadline := time.Now().Add(sc.HandlerTimeout)
 	for _, h := range handlers {
 		if n := sc.handlers[h]; n != nil {
 			log.Println(fmt.Sprintf("%s started", n.Name))
 			n.OutputVariables = g.outputVariables
-			err := sc.runHandlerNode(n)
+			n.Step = sc.handlerStep(n.Step, g)
+			var timeout time.Duration
+			if sc.HandlerTimeout > 0 {
+				if timeout = time.Until(deadline); timeout <= 0 {
+					log.Printf("%s skipped: handler timeout exceeded", n.Name)
+					n.updateStatus(NodeStatus_Cancel)
+					continue
+				}
+			}
+			err := sc.runHandlerNode(n, timeout)
 			if err != nil {
 				sc.lastError = err
 			}
@@ -205,6 +266,9 @@ func (sc *Scheduler) Schedule(g *ExecutionGraph, done chan *Node) error {
 			}
 		}
 	}
+	if sc.Status(g) == SchedulerStatus_PartialSuccess {
+		return nil
+	}
 	return sc.lastError
 }
 
@@ -222,6 +286,9 @@ func (sc *Scheduler) Signal(g *ExecutionGraph, sig os.Signal, done chan bool, al
 		} else {
 			node.signal(sig, allowOverride)
 		}
+		if h := node.HookNode(); h != nil {
+			h.signal(sig, allowOverride)
+		}
 	}
 	if done != nil {
 		defer func() {
@@ -238,11 +305,17 @@ func (sc *Scheduler) Cancel(g *ExecutionGraph) {
 	sc.setCanceled()
 	for _, node := range g.Nodes() {
 		node.cancel()
+		if h := node.HookNode(); h != nil {
+			h.cancel()
+		}
 	}
 }
 
 // Status returns the status of the scheduler.
 func (sc *Scheduler) Status(g *ExecutionGraph) SchedulerStatus {
+	if sc.isTimedOut() && !sc.isRunning(g) {
+		return SchedulerStatus_Error
+	}
 	if sc.IsCanceled() && !sc.checkStatus(g, []NodeStatus{
 		NodeStatus_Success, NodeStatus_Skipped,
 	}) {
@@ -255,11 +328,30 @@ func (sc *Scheduler) Status(g *ExecutionGraph) SchedulerStatus {
 		return SchedulerStatus_Running
 	}
 	if sc.lastError != nil {
+		if sc.isContinuedFailure(g) {
+			return SchedulerStatus_PartialSuccess
+		}
 		return SchedulerStatus_Error
 	}
 	return SchedulerStatus_Success
 }
 
+// isContinuedFailure returns true if at least one node failed and all
+// the failed nodes are allowed to continue on failure.
+func (sc *Scheduler) isContinuedFailure(g *ExecutionGraph) bool {
+	failed := false
+	for _, node := range g.Nodes() {
+		if node.ReadStatus() != NodeStatus_Error {
+			continue
+		}
+		if !node.continueOnFailure() {
+			return false
+		}
+		failed = true
+	}
+	return failed
+}
+
 // HandlerNode returns the handler node with the given name.
 func (sc *Scheduler) HandlerNode(name string) *Node {
 	if v, ok := sc.handlers[name]; ok {
@@ -276,6 +368,12 @@ func (sc *Scheduler) IsCanceled() bool {
 	return ret
 }
 
+func (sc *Scheduler) isTimedOut() bool {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.timedOut
+}
+
 func isReady(g *ExecutionGraph, node *Node) (ready bool) {
 	ready = true
 	for _, dep := range g.to[node.id] {
@@ -284,7 +382,7 @@ func isReady(g *ExecutionGraph, node *Node) (ready bool) {
 		case NodeStatus_Success:
 			continue
 		case NodeStatus_Error:
-			if !n.ContinueOn.Failure {
+			if !n.continueOnFailure() {
 				ready = false
 				node.updateStatus(NodeStatus_Cancel)
 				node.Error = fmt.Errorf("upstream failed")
@@ -305,11 +403,62 @@ func isReady(g *ExecutionGraph, node *Node) (ready bool) {
 	return ready
 }
 
-func (sc *Scheduler) runHandlerNode(node *Node) error {
+// handlerStep returns a copy of the handler step with the variables of
+// the result of the run. The handler sees the env of the DAG and its own
+// env, but not the private env of the steps.
+func (sc *Scheduler) handlerStep(step *dag.Step, g *ExecutionGraph) *dag.Step {
+	failed := []string{}
+	for _, n := range g.Nodes() {
+		if n.ReadStatus() == NodeStatus_Error {
+			failed = append(failed, n.Name)
+		}
+	}
+	errText := ""
+	if sc.lastError != nil {
+		errText = sc.lastError.Error()
+	}
+	s := *step
+	s.Variables = append(append([]string{}, step.Variables...),
+		fmt.Sprintf("%s=%s", constants.EnvStatus, sc.Status(g)),
+		fmt.Sprintf("%s=%s", constants.EnvFailedSteps, strings.Join(failed, ",")),
+		fmt.Sprintf("%s=%s", constants.EnvError, errText),
+	)
+	for _, n := range g.Nodes() {
+		s.Variables = append(s.Variables, fmt.Sprintf("%s=%.3f",
+			stepDurationEnv(n.Name), n.ReadDuration().Seconds()))
+	}
+	return &s
+}
+
+// stepDurationEnv returns the env name of the duration of the step.
+func stepDurationEnv(name string) string {
+	return fmt.Sprintf(constants.EnvStepDurationFormat,
+		strings.Map(func(r rune) rune {
+			switch {
+			case r >= 'a' && r <= 'z':
+				return r - 'a' + 'A'
+			case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+				return r
+			}
+			return '_'
+		}, name))
+}
+
+// runHandlerNode runs the handler. The handler is canceled after the
+// timeout if it's greater than zero.
+func (sc *Scheduler) runHandlerNode(node *Node, timeout time.Duration) error {
 	defer func() {
-		node.FinishedAt = time.Now()
+		node.setFinishedAt(time.Now())
 	}()
 
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() {
+			log.Printf("%s timed out after %s", node.Name, timeout)
+			node.cancel()
+		})
+		defer timer.Stop()
+	}
+
 	node.updateStatus(NodeStatus_Running)
 
 	if !sc.Dry {
@@ -328,6 +477,49 @@ func (sc *Scheduler) runHandlerNode(node *Node) error {
 	return nil
 }
 
+// runStepHook runs the hook of the step after it succeeded or failed.
+// The hook is run as the hook node of the step, so that it's signaled
+// and canceled with the step and its result is recorded. The timeout of
+// the step applies to the hook unless it has its own. The failure of the
+// hook is logged but doesn't change the status of the step.
+func (sc *Scheduler) runStepHook(node *Node, hook *dag.Step) {
+	if hook == nil || sc.Dry || sc.IsCanceled() {
+		return
+	}
+	log.Printf("%s started", hook.Name)
+	s := *hook
+	s.OutputVariables = node.OutputVariables
+	if s.Timeout == 0 {
+		s.Timeout = node.Timeout
+	}
+	h := &Node{Step: &s}
+	h.init()
+	h.updateStatus(NodeStatus_Running)
+	node.setHook(h)
+	defer func() {
+		h.setFinishedAt(time.Now())
+	}()
+	if err := h.setup(sc.LogDir, sc.RequestId); err != nil {
+		log.Printf("%s failed: %v", hook.Name, err)
+		h.Error = err
+		h.updateStatus(NodeStatus_Error)
+		return
+	}
+	defer h.teardown()
+	if h.ReadStatus() != NodeStatus_Running {
+		// canceled before the hook started
+		return
+	}
+	if err := h.Execute(); err != nil {
+		log.Printf("%s failed: %v", hook.Name, err)
+		if h.ReadStatus() == NodeStatus_Running {
+			h.updateStatus(NodeStatus_Error)
+		}
+		return
+	}
+	h.updateStatus(NodeStatus_Success)
+}
+
 func (sc *Scheduler) setup() (err error) {
 	sc.pause = time.Millisecond * 100
 	if sc.LogDir == "" {
@@ -360,11 +552,12 @@ func (sc *Scheduler) setup() (err error) {
 func handleError(node *Node) {
 	status := node.ReadStatus()
 	if status != NodeStatus_Cancel && status != NodeStatus_Success {
-		if node.RetryPolicy != nil && node.RetryPolicy.Limit > node.ReadRetryCount() {
+		if node.canRetry() && node.matchRetryOutput() {
 			log.Printf("%s failed but scheduled for retry", node.Name)
 			node.incRetryCount()
-			log.Printf("sleep %s for retry", node.RetryPolicy.Interval)
-			time.Sleep(node.RetryPolicy.Interval)
+			delay := node.RetryPolicy.Delay(node.ReadRetryCount())
+			log.Printf("sleep %s for retry", delay)
+			time.Sleep(delay)
 			node.SetRetriedAt(time.Now())
 			node.updateStatus(NodeStatus_None)
 		} else {
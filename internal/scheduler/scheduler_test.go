@@ -1,8 +1,13 @@
 package scheduler
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"testing"
 	"time"
@@ -103,8 +108,8 @@ func TestSchedulerContinueOnFailure(t *testing.T) {
 		},
 		step("3", testCommand, "2"),
 	)
-	require.Error(t, err)
-	require.Equal(t, sc.Status(g), SchedulerStatus_Error)
+	require.NoError(t, err)
+	require.Equal(t, sc.Status(g), SchedulerStatus_PartialSuccess)
 
 	nodes := g.Nodes()
 	require.Equal(t, NodeStatus_Success, nodes[0].ReadStatus())
@@ -112,6 +117,219 @@ func TestSchedulerContinueOnFailure(t *testing.T) {
 	require.Equal(t, NodeStatus_Success, nodes[2].ReadStatus())
 }
 
+func TestSchedulerContinueOnExitCode(t *testing.T) {
+	g, sc, err := testSchedule(t,
+		&dag.Step{
+			Name:       "1",
+			Command:    "sh",
+			Args:       []string{"-c", "exit 2"},
+			ContinueOn: dag.ContinueOn{ExitCode: []int{1, 2}},
+		},
+		step("2", testCommand, "1"),
+	)
+	require.NoError(t, err)
+	require.Equal(t, SchedulerStatus_PartialSuccess, sc.Status(g))
+	nodes := g.Nodes()
+	require.Equal(t, NodeStatus_Error, nodes[0].ReadStatus())
+	require.Equal(t, NodeStatus_Success, nodes[1].ReadStatus())
+
+	// the exit code not listed stops the downstream steps
+	g, sc, err = testSchedule(t,
+		&dag.Step{
+			Name:       "1",
+			Command:    "sh",
+			Args:       []string{"-c", "exit 3"},
+			ContinueOn: dag.ContinueOn{ExitCode: []int{1, 2}},
+		},
+		step("2", testCommand, "1"),
+	)
+	require.Error(t, err)
+	require.Equal(t, SchedulerStatus_Error, sc.Status(g))
+	nodes = g.Nodes()
+	require.Equal(t, NodeStatus_Error, nodes[0].ReadStatus())
+	require.Equal(t, NodeStatus_Cancel, nodes[1].ReadStatus())
+}
+
+func TestSchedulerPartialSuccess(t *testing.T) {
+	g, sc := newTestSchedule(t,
+		&Config{
+			MaxActiveRuns: 2,
+			OnSuccess:     &dag.Step{Name: constants.OnSuccess, Command: testCommand},
+			OnFailure:     &dag.Step{Name: constants.OnFailure, Command: testCommand},
+		},
+		&dag.Step{
+			Name:       "1",
+			Command:    testCommandFail,
+			ContinueOn: dag.ContinueOn{Failure: true},
+		},
+		step("2", testCommand, "1"),
+		step("3", testCommandFail, "2"),
+	)
+	err := sc.Schedule(g, nil)
+	require.Error(t, err)
+	require.Equal(t, SchedulerStatus_Error, sc.Status(g))
+
+	g, sc = newTestSchedule(t,
+		&Config{
+			MaxActiveRuns: 2,
+			OnSuccess:     &dag.Step{Name: constants.OnSuccess, Command: testCommand},
+			OnFailure:     &dag.Step{Name: constants.OnFailure, Command: testCommand},
+		},
+		&dag.Step{
+			Name:       "1",
+			Command:    testCommandFail,
+			ContinueOn: dag.ContinueOn{Failure: true},
+		},
+		step("2", testCommand, "1"),
+	)
+	err = sc.Schedule(g, nil)
+	require.NoError(t, err)
+	require.Equal(t, SchedulerStatus_PartialSuccess, sc.Status(g))
+	require.Equal(t, "partial success", sc.Status(g).String())
+
+	require.Equal(t, NodeStatus_Success, sc.HandlerNode(constants.OnSuccess).ReadStatus())
+	require.Equal(t, NodeStatus_None, sc.HandlerNode(constants.OnFailure).ReadStatus())
+}
+
+func TestSchedulerHandlerEnv(t *testing.T) {
+	g, sc := newTestSchedule(t,
+		&Config{
+			OnFailure: &dag.Step{
+				Name:            constants.OnFailure,
+				Command:         "sh",
+				Args:            []string{"-c", "echo $SHARED:$PRIVATE:$DAGU_STATUS:$DAGU_FAILED_STEPS:$DAGU_ERROR"},
+				Variables:       []string{"SHARED=shared"},
+				Output:          "HANDLER_ENV",
+				OutputVariables: &sync.Map{},
+			},
+		},
+		&dag.Step{
+			Name:      "1",
+			Command:   "sh",
+			Args:      []string{"-c", "exit 3"},
+			Env:       []string{"PRIVATE=secret"},
+			Variables: []string{"SHARED=shared", "PRIVATE=secret"},
+		},
+	)
+	require.Error(t, sc.Schedule(g, nil))
+
+	h := sc.HandlerNode(constants.OnFailure)
+	require.Equal(t, NodeStatus_Success, h.ReadStatus())
+	v, ok := g.outputVariables.Load("HANDLER_ENV")
+	require.True(t, ok)
+	require.Equal(t, "HANDLER_ENV=shared::failed:1:exit status 3", v)
+	require.NotContains(t, h.Variables, "PRIVATE=secret")
+}
+
+func TestSchedulerStepDuration(t *testing.T) {
+	g, sc := newTestSchedule(t,
+		&Config{
+			OnExit: &dag.Step{
+				Name:            constants.OnExit,
+				Command:         "sh",
+				Args:            []string{"-c", "echo $DAGU_STEP_SLEEP_STEP_DURATION"},
+				Output:          "STEP_DURATION",
+				OutputVariables: &sync.Map{},
+			},
+		},
+		&dag.Step{
+			Name:    "sleep-step",
+			Command: "sleep",
+			Args:    []string{"0.3"},
+		},
+	)
+	require.NoError(t, sc.Schedule(g, nil))
+
+	d := g.Nodes()[0].ReadDuration()
+	require.GreaterOrEqual(t, d, time.Millisecond*300)
+	require.Less(t, d, time.Second*2)
+
+	v, ok := g.outputVariables.Load("STEP_DURATION")
+	require.True(t, ok)
+	secs, err := strconv.ParseFloat(strings.TrimPrefix(v.(string), "STEP_DURATION="), 64)
+	require.NoError(t, err)
+	require.InDelta(t, d.Seconds(), secs, 0.001)
+}
+
+func TestSchedulerStepHooks(t *testing.T) {
+	dir := t.TempDir()
+	hook := func(file string) *dag.Step {
+		return &dag.Step{Name: file, Command: "touch", Args: []string{path.Join(dir, file)}}
+	}
+	g, sc := newTestSchedule(t,
+		&Config{
+			OnFailure: &dag.Step{
+				Name:            constants.OnFailure,
+				Command:         "ls",
+				Args:            []string{dir},
+				Output:          "HOOKS",
+				OutputVariables: &sync.Map{},
+			},
+		},
+		&dag.Step{
+			Name:      "1",
+			Command:   testCommandFail,
+			OnSuccess: hook("1.success"),
+			OnFailure: hook("1.failure"),
+		},
+		&dag.Step{
+			Name:      "2",
+			Command:   testCommand,
+			OnSuccess: hook("2.success"),
+			OnFailure: hook("2.failure"),
+		},
+	)
+	require.Error(t, sc.Schedule(g, nil))
+
+	// the hooks run before the handler of the DAG
+	v, ok := g.outputVariables.Load("HOOKS")
+	require.True(t, ok)
+	require.Equal(t, "HOOKS=1.failure\n2.success", v)
+}
+
+func TestSchedulerStepHookSignal(t *testing.T) {
+	g, sc := newTestSchedule(t, &Config{},
+		&dag.Step{
+			Name:      "1",
+			Command:   testCommand,
+			OnSuccess: step("1.success", "sleep 10"),
+		},
+	)
+
+	done := make(chan bool)
+	go func() {
+		<-time.After(time.Millisecond * 500)
+		sc.Signal(g, syscall.SIGTERM, done, false)
+	}()
+
+	start := time.Now()
+	require.NoError(t, sc.Schedule(g, nil))
+	<-done
+	require.Less(t, time.Since(start), time.Second*5)
+
+	node := g.Nodes()[0]
+	require.Equal(t, NodeStatus_Cancel, node.ReadStatus())
+	require.NotNil(t, node.HookNode())
+	require.Equal(t, "1.success", node.HookNode().Name)
+	require.Equal(t, NodeStatus_Cancel, node.HookNode().ReadStatus())
+}
+
+func TestSchedulerStepHookTimeout(t *testing.T) {
+	s := step("1", testCommandFail)
+	s.Timeout = time.Millisecond * 500
+	s.OnFailure = step("1.failure", "sleep 10")
+	g, sc := newTestSchedule(t, &Config{}, s)
+
+	start := time.Now()
+	require.Error(t, sc.Schedule(g, nil))
+	require.Less(t, time.Since(start), time.Second*5)
+
+	node := g.Nodes()[0]
+	require.Equal(t, NodeStatus_Error, node.ReadStatus())
+	require.Equal(t, NodeStatus_Error, node.HookNode().ReadStatus())
+	require.True(t, errors.Is(node.HookNode().Error, ErrTimeout))
+}
+
 func TestSchedulerAllowSkipped(t *testing.T) {
 	g, sc, err := testSchedule(t,
 		step("1", testCommand),
@@ -201,6 +419,97 @@ func TestSchedulerRetryFail(t *testing.T) {
 	require.Equal(t, nodes[1].ReadRetryCount(), 1)
 }
 
+func TestSchedulerRetryAttempts(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "scheduler_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	tmpFile := path.Join(tmpDir, "attempts")
+
+	g, sc := newTestSchedule(
+		t, &Config{},
+		&dag.Step{
+			Name:    "1",
+			Command: "sh",
+			Args:    []string{"-c", fmt.Sprintf("echo x >> %s; exit 1", tmpFile)},
+			RetryPolicy: &dag.RetryPolicy{
+				Limit:              3,
+				Interval:           time.Millisecond * 10,
+				ExponentialBackoff: true,
+			},
+		},
+	)
+	require.Error(t, sc.Schedule(g, nil))
+	require.Equal(t, SchedulerStatus_Error, sc.Status(g))
+
+	nodes := g.Nodes()
+	require.Equal(t, NodeStatus_Error, nodes[0].ReadStatus())
+	require.Equal(t, 3, nodes[0].ReadRetryCount())
+
+	b, err := os.ReadFile(tmpFile)
+	require.NoError(t, err)
+	require.Equal(t, 4, strings.Count(string(b), "x"))
+}
+
+func TestSchedulerRetryMaxElapsed(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "scheduler_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	tmpFile := path.Join(tmpDir, "attempts")
+
+	g, sc := newTestSchedule(
+		t, &Config{},
+		&dag.Step{
+			Name:    "1",
+			Command: "sh",
+			Args:    []string{"-c", fmt.Sprintf("echo x >> %s; exit 1", tmpFile)},
+			RetryPolicy: &dag.RetryPolicy{
+				Limit:      100,
+				Interval:   time.Millisecond * 100,
+				MaxElapsed: time.Millisecond * 500,
+			},
+		},
+	)
+	started := time.Now()
+	require.Error(t, sc.Schedule(g, nil))
+	require.GreaterOrEqual(t, time.Since(started), time.Millisecond*500)
+
+	// the retries stopped once the budget was exhausted before the limit
+	nodes := g.Nodes()
+	require.Equal(t, NodeStatus_Error, nodes[0].ReadStatus())
+	require.Greater(t, nodes[0].ReadRetryCount(), 0)
+	require.Less(t, nodes[0].ReadRetryCount(), 10)
+
+	b, err := os.ReadFile(tmpFile)
+	require.NoError(t, err)
+	require.Equal(t, nodes[0].ReadRetryCount()+1, strings.Count(string(b), "x"))
+}
+
+func TestSchedulerRetryOutput(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "scheduler_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	flag := path.Join(tmpDir, "flag")
+
+	g, sc := newTestSchedule(
+		t, &Config{},
+		&dag.Step{
+			Name:    "1",
+			Command: "sh",
+			Args: []string{"-c", fmt.Sprintf(
+				"if [ -f %[1]s ]; then echo final:$RETRY_OUT; else touch %[1]s; echo partial; exit 1; fi", flag)},
+			Output:      "RETRY_OUT",
+			RetryPolicy: &dag.RetryPolicy{Limit: 1},
+		},
+	)
+	require.NoError(t, sc.Schedule(g, nil))
+
+	nodes := g.Nodes()
+	require.Equal(t, 1, nodes[0].ReadRetryCount())
+	v, ok := g.outputVariables.Load("RETRY_OUT")
+	require.True(t, ok)
+	require.Equal(t, "RETRY_OUT=final:", v)
+}
+
 func TestSchedulerRetrySuccess(t *testing.T) {
 	cmd := path.Join(utils.MustGetwd(), "testdata/testfile.sh")
 	tmpDir, err := os.MkdirTemp("", "scheduler_test")
@@ -265,6 +574,38 @@ func TestSchedulerRetrySuccess(t *testing.T) {
 	}
 }
 
+func TestSchedulerRetryOnOutput(t *testing.T) {
+	g, sc, err := testSchedule(t,
+		&dag.Step{
+			Name:    "1",
+			Command: "sh",
+			Args:    []string{"-c", "echo connection reset by peer; false"},
+			RetryPolicy: &dag.RetryPolicy{
+				Limit:         2,
+				RetryOnOutput: "connection reset",
+			},
+		},
+		&dag.Step{
+			Name:    "2",
+			Command: "sh",
+			Args:    []string{"-c", "echo permission denied >&2; false"},
+			RetryPolicy: &dag.RetryPolicy{
+				Limit:         2,
+				RetryOnOutput: "connection reset",
+			},
+		},
+	)
+	require.Error(t, err)
+
+	nodes := g.Nodes()
+	require.Equal(t, NodeStatus_Error, nodes[0].ReadStatus())
+	require.Equal(t, NodeStatus_Error, nodes[1].ReadStatus())
+	require.Equal(t, sc.Status(g), SchedulerStatus_Error)
+
+	require.Equal(t, 2, nodes[0].ReadRetryCount())
+	require.Equal(t, 0, nodes[1].ReadRetryCount())
+}
+
 func TestStepPreCondition(t *testing.T) {
 	g, sc, err := testSchedule(t,
 		step("1", testCommand),
@@ -301,6 +642,14 @@ func TestStepPreCondition(t *testing.T) {
 	require.Equal(t, NodeStatus_Skipped, nodes[2].ReadStatus())
 	require.Equal(t, NodeStatus_Success, nodes[3].ReadStatus())
 	require.Equal(t, NodeStatus_Success, nodes[4].ReadStatus())
+
+	require.Equal(t, &dag.ConditionResult{
+		Condition: "`echo 1`",
+		Expected:  "0",
+		Actual:    "1",
+	}, nodes[1].SkipReason)
+	require.Nil(t, nodes[2].SkipReason)
+	require.Nil(t, nodes[3].SkipReason)
 }
 
 func TestSchedulerOnExit(t *testing.T) {
@@ -347,6 +696,89 @@ func TestSchedulerOnExitOnFail(t *testing.T) {
 	require.Equal(t, NodeStatus_Success, sc.HandlerNode(constants.OnExit).ReadStatus())
 }
 
+func TestSchedulerTimeout(t *testing.T) {
+	g, sc := newTestSchedule(t,
+		&Config{
+			Timeout:        time.Millisecond * 500,
+			HandlerTimeout: time.Second * 5,
+			OnExit:         step("onExit", "sleep 1"),
+			OnFailure:      step("onFailure", testCommand),
+		},
+		step("1", "sleep 10"),
+		step("2", testCommand, "1"),
+	)
+
+	start := time.Now()
+	err := sc.Schedule(g, nil)
+	require.Equal(t, ErrTimeout, err)
+	require.Less(t, time.Since(start), time.Second*5)
+	require.Equal(t, SchedulerStatus_Error, sc.Status(g))
+
+	nodes := g.Nodes()
+	require.Equal(t, NodeStatus_Cancel, nodes[0].ReadStatus())
+	require.Equal(t, NodeStatus_None, nodes[1].ReadStatus())
+
+	// the handlers run within their own budget after the timeout
+	require.Equal(t, NodeStatus_Success, sc.HandlerNode(constants.OnFailure).ReadStatus())
+	require.Equal(t, NodeStatus_Success, sc.HandlerNode(constants.OnExit).ReadStatus())
+}
+
+func TestSchedulerStepTimeout(t *testing.T) {
+	s := step("1", "sleep 10")
+	s.Timeout = time.Millisecond * 200
+	g, sc := newTestSchedule(t, &Config{}, s, step("2", testCommand, "1"))
+
+	start := time.Now()
+	err := sc.Schedule(g, nil)
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrTimeout))
+	require.Less(t, time.Since(start), time.Second*5)
+
+	nodes := g.Nodes()
+	require.Equal(t, NodeStatus_Error, nodes[0].ReadStatus())
+	// the exit code is recorded although the error is wrapped
+	require.NotNil(t, nodes[0].ReadExitCode())
+	require.Equal(t, NodeStatus_Cancel, nodes[1].ReadStatus())
+
+	// the step ignoring SIGTERM is killed after the grace period
+	grace := stepTimeoutGracePeriod
+	stepTimeoutGracePeriod = time.Millisecond * 200
+	defer func() {
+		stepTimeoutGracePeriod = grace
+	}()
+	g, sc = newTestSchedule(t, &Config{}, &dag.Step{
+		Name:    "1",
+		Command: "sh",
+		Args:    []string{"-c", "trap '' TERM; sleep 10"},
+		Timeout: time.Millisecond * 200,
+	})
+	start = time.Now()
+	err = sc.Schedule(g, nil)
+	require.True(t, errors.Is(err, ErrTimeout))
+	require.Less(t, time.Since(start), time.Second*5)
+	require.Equal(t, NodeStatus_Error, g.Nodes()[0].ReadStatus())
+}
+
+func TestSchedulerHandlerTimeout(t *testing.T) {
+	g, sc := newTestSchedule(t,
+		&Config{
+			HandlerTimeout: time.Millisecond * 500,
+			OnSuccess:      step("onSuccess", "sleep 10"),
+			OnExit:         step("onExit", testCommand),
+		},
+		step("1", testCommand),
+	)
+
+	start := time.Now()
+	err := sc.Schedule(g, nil)
+	require.NoError(t, err)
+	require.Less(t, time.Since(start), time.Second*5)
+
+	require.Equal(t, NodeStatus_Error, sc.HandlerNode(constants.OnSuccess).ReadStatus())
+	// no budget is left for the exit handler
+	require.Equal(t, NodeStatus_Cancel, sc.HandlerNode(constants.OnExit).ReadStatus())
+}
+
 func TestSchedulerOnSignal(t *testing.T) {
 	g, _ := NewExecutionGraph(
 		&dag.Step{
@@ -472,6 +904,42 @@ func TestRepeat(t *testing.T) {
 	require.Equal(t, nodes[0].DoneCount, 2)
 }
 
+func TestRepeatIndex(t *testing.T) {
+	dir, err := os.MkdirTemp("", "test-repeat-index")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, "index.txt")
+	g, _ := NewExecutionGraph(
+		&dag.Step{
+			Name:    "1",
+			Command: "sh",
+			Args:    []string{"-c", fmt.Sprintf("echo $DAGU_REPEAT_INDEX >> %s", file)},
+			RepeatPolicy: dag.RepeatPolicy{
+				Repeat:   true,
+				Interval: time.Millisecond * 100,
+			},
+		},
+	)
+	sc := &Scheduler{Config: &Config{}}
+
+	go func() {
+		<-time.After(time.Millisecond * 500)
+		sc.Cancel(g)
+	}()
+
+	err = sc.Schedule(g, nil)
+	require.NoError(t, err)
+
+	dat, err := os.ReadFile(file)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(dat)), "\n")
+	require.Greater(t, len(lines), 1)
+	for i, l := range lines {
+		require.Equal(t, fmt.Sprint(i), l)
+	}
+}
+
 func TestRepeatFail(t *testing.T) {
 	g, _ := NewExecutionGraph(
 		&dag.Step{
@@ -607,7 +1075,7 @@ func TestTakeOutputFromPrevStep(t *testing.T) {
 	require.Equal(t, NodeStatus_Success, nodes[0].ReadStatus())
 	require.Equal(t, NodeStatus_Success, nodes[1].ReadStatus())
 
-	require.Equal(t, "take-output", os.ExpandEnv("$TOOK_PREV_OUT"))
+	require.Equal(t, "take-output", testOutput(t, nodes[1], "TOOK_PREV_OUT"))
 }
 
 func step(name, command string, depends ...string) *dag.Step {
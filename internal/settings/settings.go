@@ -21,6 +21,8 @@ const (
 	SETTING__DATA_DIR          = "DAGU__DATA"
 	SETTING__LOGS_DIR          = "DAGU__LOGS"
 	SETTING__SUSPEND_FLAGS_DIR = "DAGU__SUSPEND_FLAGS_DIR"
+	SETTING__LOCKS_DIR         = "DAGU__LOCKS_DIR"
+	SETTING__MAIL_STATE_DIR    = "DAGU__MAIL_STATE_DIR"
 	SETTING__BASE_CONFIG       = "DAGU__BASE_CONFIG"
 	SETTING__ADMIN_CONFIG      = "DAGU__ADMIN_CONFIG"
 	SETTING__ADMIN_LOGS_DIR    = "DAGU__ADMIN_LOGS_DIR"
@@ -74,6 +76,8 @@ func load() {
 	cache[SETTING__DATA_DIR] = path.Join(dh, "/data")
 	cache[SETTING__LOGS_DIR] = path.Join(dh, "/logs")
 	cache[SETTING__SUSPEND_FLAGS_DIR] = path.Join(dh, "/suspend")
+	cache[SETTING__LOCKS_DIR] = path.Join(dh, "/locks")
+	cache[SETTING__MAIL_STATE_DIR] = path.Join(dh, "/mail")
 	cache[SETTING__ADMIN_LOGS_DIR] = path.Join(dh, "/logs/admin")
 	cache[SETTING__ADMIN_DAGS_DIR] = path.Join(dh, "/dags")
 	cache[SETTING__ADMIN_PORT] = "8080"
@@ -1,7 +1,10 @@
 package utils
 
 import (
+	"bytes"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -63,31 +66,56 @@ func FormatDuration(t time.Duration, defaultVal string) string {
 
 // SplitCommand splits command string to program and arguments.
 func SplitCommand(cmd string, parse bool) (program string, args []string) {
-	s := cmd
 	if parse {
-		s = os.ExpandEnv(cmd)
+		return SplitCommandWithEnv(cmd, os.ExpandEnv)
 	}
+	return splitCommandOrJoin(cmd, false)
+}
+
+// SplitCommandWithEnv splits command string to program and arguments
+// like SplitCommand with parse, but the variables are expanded by expand
+// instead of the process environment.
+func SplitCommandWithEnv(cmd string, expand func(string) string) (program string, args []string) {
+	return splitCommandOrJoin(expand(cmd), true)
+}
+
+func splitCommandOrJoin(s string, parse bool) (program string, args []string) {
+	program, args, err := splitCommand(s, parse)
+	if err != nil {
+		log.Printf("failed to parse arguments: %s", err)
+		//if parse shell world error use all substing as args
+		return program, []string{strings.SplitN(s, " ", 2)[1]}
+	}
+	return program, args
+}
+
+// SplitCommandArgs splits command string to program and arguments like
+// SplitCommand without expanding the variables nor evaluating the command
+// substitutions. It returns an error if the arguments can't be parsed.
+func SplitCommandArgs(cmd string) (program string, args []string, err error) {
+	return splitCommand(cmd, false)
+}
+
+func splitCommand(s string, parseBacktick bool) (program string, args []string, err error) {
 	vals := strings.SplitN(s, " ", 2)
 	if len(vals) > 1 {
 		program = vals[0]
 		parser := shellwords.NewParser()
-		parser.ParseBacktick = parse
+		parser.ParseBacktick = parseBacktick
 		parser.ParseEnv = false
 		a := escapeSpecialchars(vals[1])
 		args, err := parser.Parse(a)
 		if err != nil {
-			log.Printf("failed to parse arguments: %s", err)
-			//if parse shell world error use all substing as args
-			return program, []string{vals[1]}
+			return program, nil, err
 		}
 		ret := []string{}
 		for _, v := range args {
 			ret = append(ret, unescapeSpecialchars(v))
 		}
-		return program, ret
+		return program, ret, nil
 
 	}
-	return vals[0], []string{}
+	return vals[0], []string{}, nil
 }
 
 func unescapeSpecialchars(str string) string {
@@ -166,6 +194,39 @@ var tickerMatcher = regexp.MustCompile("`[^`]+`")
 
 // ParseCommand substitutes command in the value string.
 func ParseCommand(value string) (string, error) {
+	return substituteCommands(value, func(str string) *exec.Cmd {
+		prog, args := SplitCommand(str, false)
+		return exec.Command(prog, args...)
+	})
+}
+
+// ParseCommandWithShell substitutes command in the value string. Unlike
+// ParseCommand, the commands are run by the shell with the -c option.
+// The commands are run with env, or with the process environment if it's
+// empty.
+func ParseCommandWithShell(value, shell string, env []string) (string, error) {
+	return substituteCommands(value, func(str string) *exec.Cmd {
+		cmd := exec.Command(shell, "-c", str)
+		cmd.Env = append(cmd.Env, env...)
+		return cmd
+	})
+}
+
+// ExpandOutsideCommands expands the variables in the value with expand,
+// leaving the commands in backticks as they are.
+func ExpandOutsideCommands(value string, expand func(string) string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range tickerMatcher.FindAllStringIndex(value, -1) {
+		b.WriteString(expand(value[last:loc[0]]))
+		b.WriteString(value[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	b.WriteString(expand(value[last:]))
+	return b.String()
+}
+
+func substituteCommands(value string, newCmd func(string) *exec.Cmd) (string, error) {
 	matches := tickerMatcher.FindAllString(strings.TrimSpace(value), -1)
 	if matches == nil {
 		return value, nil
@@ -174,8 +235,7 @@ func ParseCommand(value string) (string, error) {
 	for i := 0; i < len(matches); i++ {
 		command := matches[i]
 		str := strings.ReplaceAll(command, "`", "")
-		prog, args := SplitCommand(str, false)
-		out, err := exec.Command(prog, args...).Output()
+		out, err := newCmd(str).Output()
 		if err != nil {
 			return "", err
 		}
@@ -229,6 +289,23 @@ func MatchExtension(file string, exts []string) bool {
 	return false
 }
 
+var webhookClient = &http.Client{Timeout: time.Second * 10}
+
+// PostJSON posts the JSON body to the URL of a webhook. It's an error if
+// the webhook responds with an error status. The URL is not in the error
+// since it may have a token in it.
+func PostJSON(url string, body []byte) error {
+	resp, err := webhookClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
 var FixedTime time.Time
 
 func Now() time.Time {
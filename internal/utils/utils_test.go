@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"path"
+	"strings"
 	"testing"
 	"time"
 
@@ -62,6 +63,12 @@ func TestSplitCommand(t *testing.T) {
 	require.Equal(t, "test/", args[1])
 }
 
+func TestExpandOutsideCommands(t *testing.T) {
+	expand := func(s string) string { return strings.ReplaceAll(s, "$A", "a") }
+	require.Equal(t, "a `echo $A` a", utils.ExpandOutsideCommands("$A `echo $A` $A", expand))
+	require.Equal(t, "a", utils.ExpandOutsideCommands("$A", expand))
+}
+
 func TestFileExits(t *testing.T) {
 	require.True(t, utils.FileExists("/"))
 }